@@ -0,0 +1,220 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// source is a SplitMix64 random number source, its state is a single integer
+// that is saved in checkpoints
+type source struct {
+	state uint64
+}
+
+// newSource creates a random number source from a seed
+func newSource(seed int64) *source {
+	return &source{state: uint64(seed)}
+}
+
+// Seed seeds the source
+func (s *source) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// Uint64 returns a random 64 bit integer
+func (s *source) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Int63 returns a random non-negative 63 bit integer
+func (s *source) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// statisticsEncoding is the encoding of the statistics of a generation
+type statisticsEncoding struct {
+	Best  number `json:"best"`
+	Mean  number `json:"mean"`
+	Worst number `json:"worst"`
+}
+
+// checkpointEncoding is the encoding of the state of an optimization, the
+// genomes are encoded without the probabilities they share and Refined marks
+// the genomes that have been refined
+type checkpointEncoding struct {
+	Version       int                  `json:"version"`
+	State         uint64               `json:"state"`
+	Width         int                  `json:"width"`
+	Depth         int                  `json:"depth"`
+	Probabilities [][2][]float64       `json:"probabilities"`
+	Generation    int                  `json:"generation"`
+	Evaluated     int                  `json:"evaluated"`
+	Genomes       []*genomeEncoding    `json:"genomes"`
+	Refined       []bool               `json:"refined,omitempty"`
+	Best          *genomeEncoding      `json:"best"`
+	Front         []*genomeEncoding    `json:"front,omitempty"`
+	Statistics    []statisticsEncoding `json:"statistics"`
+	Duration      time.Duration        `json:"duration"`
+}
+
+// checkpoint writes the state of the optimization to a file, replacing the
+// previous checkpoint only once the new one is complete
+func (o *optimizer) checkpoint(name string) error {
+	e := checkpointEncoding{
+		Version:       SchemaVersion,
+		State:         o.source.state,
+		Width:         o.width,
+		Depth:         o.depth,
+		Probabilities: o.probabilities,
+		Generation:    o.generation,
+		Evaluated:     o.evaluated,
+		Genomes:       make([]*genomeEncoding, len(o.genomes)),
+		Best:          o.result.Best.encode(),
+		Statistics:    make([]statisticsEncoding, len(o.result.Statistics)),
+		Duration:      o.elapsed,
+	}
+	for i := range o.genomes {
+		e.Genomes[i] = o.genomes[i].encode()
+		e.Genomes[i].Probabilities = nil
+		if o.genomes[i].refined {
+			if e.Refined == nil {
+				e.Refined = make([]bool, len(o.genomes))
+			}
+			e.Refined[i] = true
+		}
+	}
+	e.Best.Probabilities = nil
+	for _, genome := range o.result.Front {
+		front := genome.encode()
+		front.Probabilities = nil
+		e.Front = append(e.Front, front)
+	}
+	for i, statistics := range o.result.Statistics {
+		e.Statistics[i] = statisticsEncoding{
+			Best:  number(statistics.Best),
+			Mean:  number(statistics.Mean),
+			Worst: number(statistics.Worst),
+		}
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), name)
+}
+
+// restore decodes a genome of a checkpoint, checking that it could have been
+// produced by the optimization
+func (o *optimizer) restore(e *genomeEncoding) (Genome, error) {
+	var genome Genome
+	if err := genome.decode(e); err != nil {
+		return genome, err
+	}
+	if genome.Width != o.width {
+		return genome, fmt.Errorf("genome has width %d not %d", genome.Width, o.width)
+	}
+	min, max := o.bounds()
+	if len(genome.Gates) < min || len(genome.Gates) > max {
+		return genome, fmt.Errorf("genome has %d gates not between %d and %d", len(genome.Gates), min, max)
+	}
+	genome.Probabilities, genome.FitnessFunction = o.probabilities, o.FitnessFunction
+	return genome, nil
+}
+
+// Resume continues the optimization saved in a checkpoint file. The options
+// must be those of the interrupted optimization for the optimization to
+// continue as if it had not been interrupted.
+func Resume(ctx context.Context, name string, options *OptimizerOptions) (*Result, error) {
+	if err := options.checkpoints(); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var e checkpointEncoding
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	if err := version(e.Version); err != nil {
+		return nil, err
+	}
+	if e.Evaluated < 0 || e.Evaluated > len(e.Genomes) || e.Best == nil ||
+		(e.Refined != nil && len(e.Refined) != len(e.Genomes)) {
+		return nil, errors.New("checkpoint has an invalid population")
+	}
+	if e.Generation < 0 || len(e.Statistics) != e.Generation {
+		return nil, errors.New("checkpoint has invalid statistics")
+	}
+	if options.MultiObjective != (len(e.Front) > 0) {
+		return nil, errors.New("checkpoint does not match the multi-objective option")
+	}
+	o, err := newOptimizer(e.Width, e.Depth, e.Probabilities, options)
+	if err != nil {
+		return nil, err
+	}
+	o.source.state = e.State
+	o.genomes = make([]Genome, len(e.Genomes))
+	for i := range e.Genomes {
+		if o.genomes[i], err = o.restore(e.Genomes[i]); err != nil {
+			return nil, err
+		}
+		o.genomes[i].refined = e.Refined != nil && e.Refined[i]
+	}
+	best, err := o.restore(e.Best)
+	if err != nil {
+		return nil, err
+	}
+	var front []Genome
+	for _, genome := range e.Front {
+		restored, err := o.restore(genome)
+		if err != nil {
+			return nil, err
+		}
+		front = append(front, restored)
+	}
+	statistics := make([]Statistics, len(e.Statistics))
+	for i, s := range e.Statistics {
+		statistics[i] = Statistics{
+			Best:  float64(s.Best),
+			Mean:  float64(s.Mean),
+			Worst: float64(s.Worst),
+		}
+	}
+	o.evaluated, o.generation = e.Evaluated, e.Generation
+	o.result = &Result{
+		Best:        best,
+		Front:       front,
+		Statistics:  statistics,
+		Generations: len(statistics),
+	}
+	o.elapsed = e.Duration
+	return o.optimize(ctx)
+}
@@ -0,0 +1,503 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// ClassicalRegister is a named register of classical bits
+type ClassicalRegister struct {
+	Name string
+	Size int
+}
+
+// Circuit is a quantum circuit of Width qubits and a list of gates. The
+// classical bits of the registers are numbered in order, starting with the
+// first bit of the first register.
+type Circuit struct {
+	Width     int
+	Gates     []Gate
+	Registers []ClassicalRegister
+}
+
+// NewCircuit creates a circuit of width qubits
+func NewCircuit(width int) *Circuit {
+	return &Circuit{
+		Width: width,
+	}
+}
+
+// Copy copies a circuit
+func (c *Circuit) Copy() *Circuit {
+	cp := &Circuit{
+		Width:     c.Width,
+		Gates:     make([]Gate, len(c.Gates)),
+		Registers: make([]ClassicalRegister, len(c.Registers)),
+	}
+	for i := range c.Gates {
+		cp.Gates[i] = c.Gates[i].Copy()
+	}
+	copy(cp.Registers, c.Registers)
+	return cp
+}
+
+// Register adds a classical register of size bits
+func (c *Circuit) Register(name string, size int) *Circuit {
+	c.Registers = append(c.Registers, ClassicalRegister{
+		Name: name,
+		Size: size,
+	})
+	return c
+}
+
+// Bits is the number of classical bits of the circuit
+func (c *Circuit) Bits() int {
+	bits := 0
+	for _, register := range c.Registers {
+		bits += register.Size
+	}
+	return bits
+}
+
+// Append appends copies of the gates to the circuit
+func (c *Circuit) Append(gates ...Gate) *Circuit {
+	for i := range gates {
+		c.Gates = append(c.Gates, gates[i].Copy())
+	}
+	return c
+}
+
+// Compose appends the gates of b to the circuit, qubit i of b is mapped to
+// qubits[i], or to qubit i if no qubits are given. Classical bits are mapped
+// to the same bits of the circuit.
+func (c *Circuit) Compose(b *Circuit, qubits ...Qubit) (*Circuit, error) {
+	if len(qubits) == 0 {
+		if b.Width > c.Width {
+			return nil, fmt.Errorf("circuit of %d qubits does not fit in %d qubits", b.Width, c.Width)
+		}
+		for i := 0; i < b.Width; i++ {
+			qubits = append(qubits, Qubit(i))
+		}
+	} else if len(qubits) != b.Width {
+		return nil, fmt.Errorf("circuit of %d qubits is mapped to %d qubits", b.Width, len(qubits))
+	}
+	for _, qubit := range qubits {
+		if int(qubit) >= c.Width {
+			return nil, fmt.Errorf("qubit %d is not in a circuit of %d qubits", qubit, c.Width)
+		}
+	}
+	for i := range b.Gates {
+		gate := b.Gates[i].Copy()
+		for j, qubit := range gate.Qubits {
+			if int(qubit) >= len(qubits) {
+				return nil, fmt.Errorf("qubit %d is not in a circuit of %d qubits", qubit, b.Width)
+			}
+			gate.Qubits[j] = qubits[qubit]
+		}
+		if gate.Controlled() {
+			if int(gate.Target) >= len(qubits) {
+				return nil, fmt.Errorf("qubit %d is not in a circuit of %d qubits", gate.Target, b.Width)
+			}
+			gate.Target = qubits[gate.Target]
+		}
+		c.Gates = append(c.Gates, gate)
+	}
+	return c, nil
+}
+
+// Inverse returns a circuit that undoes the circuit, circuits with
+// measurements can not be inverted
+func (c *Circuit) Inverse() (*Circuit, error) {
+	inverse := &Circuit{
+		Width:     c.Width,
+		Gates:     make([]Gate, 0, len(c.Gates)),
+		Registers: make([]ClassicalRegister, len(c.Registers)),
+	}
+	copy(inverse.Registers, c.Registers)
+	for i := len(c.Gates) - 1; i >= 0; i-- {
+		gates, err := c.Gates[i].Inverse()
+		if err != nil {
+			return nil, err
+		}
+		inverse.Gates = append(inverse.Gates, gates...)
+	}
+	return inverse, nil
+}
+
+// Depth is the number of layers of the circuit, where a layer applies at most
+// one gate to each qubit. Barriers line up the qubits they cross, or all of
+// the qubits if they have none, without adding a layer.
+func (c *Circuit) Depth() int {
+	layers := make([]int, c.Width)
+	depth := 0
+	for i := range c.Gates {
+		gate := &c.Gates[i]
+		operands := gate.Operands()
+		switch gate.GateType {
+		case GateTypeI:
+			continue
+		case GateTypeBarrier:
+			if len(operands) == 0 {
+				for j := range layers {
+					operands = append(operands, Qubit(j))
+				}
+			}
+			layer := 0
+			for _, qubit := range operands {
+				if layers[qubit] > layer {
+					layer = layers[qubit]
+				}
+			}
+			for _, qubit := range operands {
+				layers[qubit] = layer
+			}
+			continue
+		case GateTypeH, GateTypeX, GateTypeY, GateTypeZ, GateTypeS, GateTypeT,
+			GateTypeU, GateTypeRX, GateTypeRY, GateTypeRZ, GateTypeSX, GateTypeSXdg,
+			GateTypeSdg, GateTypeTdg, GateTypeP, GateTypeU1, GateTypeU2, GateTypeU3,
+			GateTypeMeasure:
+			for _, qubit := range operands {
+				layers[qubit]++
+				if layers[qubit] > depth {
+					depth = layers[qubit]
+				}
+			}
+			continue
+		}
+		layer := 0
+		for _, qubit := range operands {
+			if layers[qubit] > layer {
+				layer = layers[qubit]
+			}
+		}
+		layer++
+		for _, qubit := range operands {
+			layers[qubit] = layer
+		}
+		if layer > depth {
+			depth = layer
+		}
+	}
+	return depth
+}
+
+// Size returns the number of gates acting on qubits, identities and barriers
+// excluded
+func (c *Circuit) Size() int {
+	size := 0
+	for i := range c.Gates {
+		gate := &c.Gates[i]
+		switch gate.GateType {
+		case GateTypeI, GateTypeBarrier:
+			continue
+		}
+		if len(gate.Operands()) > 0 {
+			size++
+		}
+	}
+	return size
+}
+
+// MultiQubit returns the number of gates acting jointly on two or more
+// qubits
+func (c *Circuit) MultiQubit() int {
+	count := 0
+	for i := range c.Gates {
+		if c.Gates[i].GateType == GateTypeBarrier {
+			continue
+		}
+		for _, gate := range c.Gates[i].expand() {
+			if len(gate.Operands()) > 1 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Run runs the circuit on a machine and returns the classical bits. Zero
+// qubits are added to the machine until it has the width of the circuit, so
+// qubits added beforehand are the input of the circuit. The rng is only used
+// for measurements.
+func (c *Circuit) Run(machine Machine, rng *rand.Rand) ([]bool, error) {
+	for machine.Width() < c.Width {
+		machine.Zero()
+	}
+	bits := make([]bool, c.Bits())
+	for i := range c.Gates {
+		gate := &c.Gates[i]
+		if err := gate.validate(); err != nil {
+			return nil, fmt.Errorf("gate %d: %v", i, err)
+		}
+		for _, qubit := range gate.Operands() {
+			if int(qubit) >= machine.Width() {
+				return nil, fmt.Errorf("gate %d: qubit %d is not in a machine of %d qubits", i, qubit, machine.Width())
+			}
+		}
+		if gate.GateType != GateTypeMeasure {
+			gate.Apply(machine)
+			continue
+		}
+		for _, bit := range gate.Bits {
+			if bit < 0 || bit >= len(bits) {
+				return nil, fmt.Errorf("gate %d: bit %d is not in a circuit of %d bits", i, bit, len(bits))
+			}
+		}
+		if rng == nil {
+			return nil, fmt.Errorf("gate %d: measurement requires a rng", i)
+		}
+		for j, result := range machine.Measure(rng, gate.Qubits...) {
+			bits[gate.Bits[j]] = result
+		}
+	}
+	return bits, nil
+}
+
+// gate appends a gate to the circuit
+func (c *Circuit) gate(gateType GateType, qubits []Qubit) *Gate {
+	c.Gates = append(c.Gates, Gate{
+		GateType: gateType,
+		Qubits:   append([]Qubit(nil), qubits...),
+	})
+	return &c.Gates[len(c.Gates)-1]
+}
+
+// I multiply by identity
+func (c *Circuit) I(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeI, qubits)
+	return c
+}
+
+// H multiply by Hadamard gate
+func (c *Circuit) H(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeH, qubits)
+	return c
+}
+
+// X multiply by Pauli X matrix
+func (c *Circuit) X(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeX, qubits)
+	return c
+}
+
+// Y multiply by Pauli Y matrix
+func (c *Circuit) Y(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeY, qubits)
+	return c
+}
+
+// Z multiply by Pauli Z matrix
+func (c *Circuit) Z(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeZ, qubits)
+	return c
+}
+
+// S multiply by phase matrix
+func (c *Circuit) S(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeS, qubits)
+	return c
+}
+
+// T multiply by T matrix
+func (c *Circuit) T(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeT, qubits)
+	return c
+}
+
+// U multiply by U matrix
+func (c *Circuit) U(theta, phi, lambda float64, qubits ...Qubit) *Circuit {
+	gate := c.gate(GateTypeU, qubits)
+	gate.Theta, gate.Phi, gate.Lambda = theta, phi, lambda
+	return c
+}
+
+// RX rotate X gate
+func (c *Circuit) RX(theta float64, qubits ...Qubit) *Circuit {
+	c.gate(GateTypeRX, qubits).Theta = theta
+	return c
+}
+
+// RY rotate Y gate
+func (c *Circuit) RY(theta float64, qubits ...Qubit) *Circuit {
+	c.gate(GateTypeRY, qubits).Theta = theta
+	return c
+}
+
+// RZ rotate Z gate
+func (c *Circuit) RZ(theta float64, qubits ...Qubit) *Circuit {
+	c.gate(GateTypeRZ, qubits).Theta = theta
+	return c
+}
+
+// SX multiply by square root of X matrix
+func (c *Circuit) SX(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeSX, qubits)
+	return c
+}
+
+// SXdg multiply by inverse square root of X matrix
+func (c *Circuit) SXdg(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeSXdg, qubits)
+	return c
+}
+
+// Sdg multiply by inverse phase matrix
+func (c *Circuit) Sdg(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeSdg, qubits)
+	return c
+}
+
+// Tdg multiply by inverse T matrix
+func (c *Circuit) Tdg(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeTdg, qubits)
+	return c
+}
+
+// P multiply by phase matrix with angle lambda
+func (c *Circuit) P(lambda float64, qubits ...Qubit) *Circuit {
+	c.gate(GateTypeP, qubits).Lambda = lambda
+	return c
+}
+
+// U1 multiply by U1 matrix
+func (c *Circuit) U1(lambda float64, qubits ...Qubit) *Circuit {
+	c.gate(GateTypeU1, qubits).Lambda = lambda
+	return c
+}
+
+// U2 multiply by U2 matrix
+func (c *Circuit) U2(phi, lambda float64, qubits ...Qubit) *Circuit {
+	gate := c.gate(GateTypeU2, qubits)
+	gate.Phi, gate.Lambda = phi, lambda
+	return c
+}
+
+// U3 multiply by U3 matrix
+func (c *Circuit) U3(theta, phi, lambda float64, qubits ...Qubit) *Circuit {
+	gate := c.gate(GateTypeU3, qubits)
+	gate.Theta, gate.Phi, gate.Lambda = theta, phi, lambda
+	return c
+}
+
+// Swap swaps qubits
+func (c *Circuit) Swap(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeSwap, qubits)
+	return c
+}
+
+// ISwap iSWAP gate
+func (c *Circuit) ISwap(q0, q1 Qubit) *Circuit {
+	c.gate(GateTypeISwap, []Qubit{q0, q1})
+	return c
+}
+
+// SqrtSwap square root of swap gate
+func (c *Circuit) SqrtSwap(q0, q1 Qubit) *Circuit {
+	c.gate(GateTypeSqrtSwap, []Qubit{q0, q1})
+	return c
+}
+
+// RXX XX rotation gate
+func (c *Circuit) RXX(theta float64, q0, q1 Qubit) *Circuit {
+	c.gate(GateTypeRXX, []Qubit{q0, q1}).Theta = theta
+	return c
+}
+
+// RYY YY rotation gate
+func (c *Circuit) RYY(theta float64, q0, q1 Qubit) *Circuit {
+	c.gate(GateTypeRYY, []Qubit{q0, q1}).Theta = theta
+	return c
+}
+
+// RZZ ZZ rotation gate
+func (c *Circuit) RZZ(theta float64, q0, q1 Qubit) *Circuit {
+	c.gate(GateTypeRZZ, []Qubit{q0, q1}).Theta = theta
+	return c
+}
+
+// ECR echoed cross resonance gate
+func (c *Circuit) ECR(q0, q1 Qubit) *Circuit {
+	c.gate(GateTypeECR, []Qubit{q0, q1})
+	return c
+}
+
+// ControlledNot controlled not gate
+func (c *Circuit) ControlledNot(controls []Qubit, t Qubit) *Circuit {
+	c.gate(GateTypeControlledNot, controls).Target = t
+	return c
+}
+
+// CZ controlled Pauli Z gate
+func (c *Circuit) CZ(controls []Qubit, t Qubit) *Circuit {
+	c.gate(GateTypeCZ, controls).Target = t
+	return c
+}
+
+// CH controlled Hadamard gate
+func (c *Circuit) CH(controls []Qubit, t Qubit) *Circuit {
+	c.gate(GateTypeCH, controls).Target = t
+	return c
+}
+
+// CU controlled U gate
+func (c *Circuit) CU(theta, phi, lambda float64, controls []Qubit, t Qubit) *Circuit {
+	gate := c.gate(GateTypeCU, controls)
+	gate.Theta, gate.Phi, gate.Lambda, gate.Target = theta, phi, lambda, t
+	return c
+}
+
+// CRX controlled rotate X gate
+func (c *Circuit) CRX(theta float64, controls []Qubit, t Qubit) *Circuit {
+	gate := c.gate(GateTypeCRX, controls)
+	gate.Theta, gate.Target = theta, t
+	return c
+}
+
+// CRY controlled rotate Y gate
+func (c *Circuit) CRY(theta float64, controls []Qubit, t Qubit) *Circuit {
+	gate := c.gate(GateTypeCRY, controls)
+	gate.Theta, gate.Target = theta, t
+	return c
+}
+
+// CRZ controlled rotate Z gate
+func (c *Circuit) CRZ(theta float64, controls []Qubit, t Qubit) *Circuit {
+	gate := c.gate(GateTypeCRZ, controls)
+	gate.Theta, gate.Target = theta, t
+	return c
+}
+
+// CPhase controlled phase gate
+func (c *Circuit) CPhase(lambda float64, controls []Qubit, t Qubit) *Circuit {
+	gate := c.gate(GateTypeCPhase, controls)
+	gate.Lambda, gate.Target = lambda, t
+	return c
+}
+
+// Toffoli controlled controlled not gate
+func (c *Circuit) Toffoli(c0, c1, t Qubit) *Circuit {
+	return c.ControlledNot([]Qubit{c0, c1}, t)
+}
+
+// Fredkin controlled swap gate
+func (c *Circuit) Fredkin(control, t0, t1 Qubit) *Circuit {
+	c.gate(GateTypeCSwap, []Qubit{control, t0, t1})
+	return c
+}
+
+// Measure measures the qubit into the classical bit
+func (c *Circuit) Measure(qubit Qubit, bit int) *Circuit {
+	c.gate(GateTypeMeasure, []Qubit{qubit}).Bits = []int{bit}
+	return c
+}
+
+// Barrier adds a barrier across the qubits, or all of the qubits if none are
+// given
+func (c *Circuit) Barrier(qubits ...Qubit) *Circuit {
+	c.gate(GateTypeBarrier, qubits)
+	return c
+}
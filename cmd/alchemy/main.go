@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/pointlander/heisenberg"
@@ -15,6 +16,11 @@ func main() {
 	/*q0 := machine.Zero()
 	q1 := machine.One()
 	machine.Swap(q0, q1)*/
-	points := machine.Points()
+	points, err := machine.Points(context.Background(), func(generation int, fitness float64, points []heisenberg.Point) {
+		fmt.Println(fitness)
+	})
+	if err != nil {
+		panic(err)
+	}
 	fmt.Println(points)
 }
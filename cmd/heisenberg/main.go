@@ -5,18 +5,119 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/pointlander/heisenberg"
+	"gopkg.in/yaml.v2"
 )
 
+var (
+	// FlagBackend is the simulator backend used by the optimizer
+	FlagBackend = flag.String("backend", heisenberg.DefaultBackend, "simulator backend")
+	// FlagDraw draws the circuit in an OpenQASM 2.0, JSON or YAML file
+	FlagDraw = flag.String("draw", "", "draw the circuit in an OpenQASM 2.0, JSON or YAML file")
+	// FlagColumns is the terminal width diagrams are wrapped at
+	FlagColumns = flag.Int("columns", 80, "terminal width diagrams are wrapped at")
+	// FlagSVG writes the drawn circuit to an SVG file
+	FlagSVG = flag.String("svg", "", "write the drawn circuit to an SVG file")
+	// FlagLaTeX writes the drawn circuit to a LaTeX quantikz file
+	FlagLaTeX = flag.String("latex", "", "write the drawn circuit to a LaTeX quantikz file")
+	// FlagCheckpoint is the file the state of the optimization is written to
+	FlagCheckpoint = flag.String("checkpoint", "", "file the state of the optimization is written to")
+	// FlagResume resumes the optimization from the checkpoint file
+	FlagResume = flag.Bool("resume", false, "resume the optimization from the checkpoint file")
+)
+
+// load loads a circuit from a file
+func load(name string) (*heisenberg.Circuit, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml":
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		circuit := &heisenberg.Circuit{}
+		if strings.ToLower(filepath.Ext(name)) == ".json" {
+			err = json.Unmarshal(data, circuit)
+		} else {
+			err = yaml.Unmarshal(data, circuit)
+		}
+		return circuit, err
+	}
+	input, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+	return heisenberg.ReadQASM(input)
+}
+
+// export writes a drawing of a circuit to a file
+func export(name string, write func(w io.Writer) error) error {
+	output, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(output); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
+
 func main() {
-	heisenberg.Optimize(8, 8, [][2][]float64{
-		[2][]float64{[]float64{0, 1}, []float64{1, 0}},
-		[2][]float64{[]float64{1, 0}, []float64{0, 1}},
-	})
+	flag.Parse()
+
+	if *FlagDraw != "" {
+		circuit, err := load(*FlagDraw)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Print(circuit.Diagram(*FlagColumns))
+		if *FlagSVG != "" {
+			if err := export(*FlagSVG, circuit.WriteSVG); err != nil {
+				panic(err)
+			}
+		}
+		if *FlagLaTeX != "" {
+			if err := export(*FlagLaTeX, circuit.WriteQuantikz); err != nil {
+				panic(err)
+			}
+		}
+		return
+	}
+
+	options := heisenberg.NewOptimizerOptions()
+	options.Backend = *FlagBackend
+	options.Checkpoint = *FlagCheckpoint
+	options.Observer = func(generation int, fitness float64, best *heisenberg.Genome) {
+		fmt.Println(fitness)
+	}
+	var result *heisenberg.Result
+	var err error
+	if *FlagResume {
+		result, err = heisenberg.Resume(context.Background(), *FlagCheckpoint, options)
+	} else {
+		result, err = heisenberg.OptimizeWithOptions(context.Background(), 8, 8, [][2][]float64{
+			[2][]float64{[]float64{0, 1}, []float64{1, 0}},
+			[2][]float64{[]float64{1, 0}, []float64{0, 1}},
+		}, options)
+	}
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("fitness %f after %d generations in %s\n", result.Best.Fitness, result.Generations, result.Duration)
+	fmt.Print(result.Best.Diagram(*FlagColumns))
 
 	rnd := rand.New(rand.NewSource(1))
 	for i := .1; i <= 1.0; i += .1 {
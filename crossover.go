@@ -0,0 +1,208 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+// Crossover is a crossover operator of the genetic optimizer
+type Crossover int
+
+const (
+	// CrossoverSwap swaps a random gate of each parent
+	CrossoverSwap Crossover = iota
+	// CrossoverOnePoint exchanges the gates after a cut point
+	CrossoverOnePoint
+	// CrossoverTwoPoint exchanges the gates between two cut points
+	CrossoverTwoPoint
+	// CrossoverUniform exchanges each gate with a probability of one half
+	CrossoverUniform
+	// CrossoverLayer exchanges the moments of the circuits after a cut moment
+	CrossoverLayer
+)
+
+// Selection is a parent selection strategy of the genetic optimizer
+type Selection int
+
+const (
+	// SelectionTruncation draws parents uniformly from the fittest genomes
+	SelectionTruncation Selection = iota
+	// SelectionTournament draws the fittest of a random group of genomes
+	SelectionTournament
+	// SelectionRoulette draws genomes with probability decreasing with fitness,
+	// or with the rank of their front for multi-objective optimization
+	SelectionRoulette
+)
+
+// weights returns the roulette selection weight of each genome of the ranked
+// population, decreasing with the rank of the genome or with the rank of its
+// front for multi-objective optimization
+func (o *optimizer) weights(genomes []Genome) []float64 {
+	weights := make([]float64, len(genomes))
+	if o.MultiObjective {
+		objectives := make([]Objectives, len(genomes))
+		for i := range genomes {
+			objectives[i] = genomes[i].Objectives()
+		}
+		for rank, front := range fronts(objectives) {
+			for _, i := range front {
+				weights[i] = 1 / float64(1+rank)
+			}
+		}
+		return weights
+	}
+	best := o.rank(&genomes[0])
+	for i := range genomes {
+		weights[i] = 1 / (1 + o.rank(&genomes[i]) - best)
+	}
+	return weights
+}
+
+// parent returns the index of a parent in the ranked population, drawn with
+// the weights for roulette selection
+func (o *optimizer) parent(genomes []Genome, weights []float64) int {
+	switch o.Selection {
+	case SelectionTournament:
+		best := o.rng.Intn(len(genomes))
+		for i := 1; i < o.TournamentSize; i++ {
+			if j := o.rng.Intn(len(genomes)); j < best {
+				best = j
+			}
+		}
+		return best
+	case SelectionRoulette:
+		total := 0.0
+		for _, weight := range weights {
+			total += weight
+		}
+		r := total * o.rng.Float64()
+		for i, weight := range weights {
+			if r < weight {
+				return i
+			}
+			r -= weight
+		}
+		return len(genomes) - 1
+	}
+	parents := o.Parents
+	if parents > len(genomes) {
+		parents = len(genomes)
+	}
+	return o.rng.Intn(parents)
+}
+
+// child returns a copy of the parent with the gates. Random gates are deleted
+// or inserted until the number of gates is within bounds.
+func (o *optimizer) child(parent *Genome, gates []Gate) Genome {
+	min, max := o.bounds()
+	cp := parent.Copy()
+	cp.Gates = make([]Gate, 0, len(gates))
+	for i := range gates {
+		cp.Gates = append(cp.Gates, gates[i].Copy())
+	}
+	for len(cp.Gates) > max {
+		i := o.rng.Intn(len(cp.Gates))
+		cp.Gates = append(cp.Gates[:i], cp.Gates[i+1:]...)
+	}
+	for len(cp.Gates) < min {
+		i := o.rng.Intn(len(cp.Gates) + 1)
+		cp.Gates = append(cp.Gates[:i], append([]Gate{o.gate()}, cp.Gates[i:]...)...)
+	}
+	return cp
+}
+
+// concat concatenates slices of gates
+func concat(parts ...[]Gate) []Gate {
+	gates := []Gate{}
+	for _, part := range parts {
+		gates = append(gates, part...)
+	}
+	return gates
+}
+
+// cut returns a cut point of each parent, the same cut point for fixed length
+// genomes
+func (o *optimizer) cut(a, b *Genome) (int, int) {
+	i := o.rng.Intn(len(a.Gates) + 1)
+	if o.MaxDepth <= 0 {
+		return i, i
+	}
+	return i, o.rng.Intn(len(b.Gates) + 1)
+}
+
+// moments returns the moment of each gate, where a gate is in the moment after
+// the last gate sharing a qubit with it
+func moments(gates []Gate, width int) []int {
+	layers, moments := make([]int, width), make([]int, len(gates))
+	for i := range gates {
+		operands := gates[i].Operands()
+		moment := 0
+		for _, qubit := range operands {
+			if layers[qubit] > moment {
+				moment = layers[qubit]
+			}
+		}
+		for _, qubit := range operands {
+			layers[qubit] = moment + 1
+		}
+		moments[i] = moment
+	}
+	return moments
+}
+
+// crossover creates two children from two parents
+func (o *optimizer) crossover(a, b *Genome) (Genome, Genome) {
+	switch o.Crossover {
+	case CrossoverOnePoint:
+		i, j := o.cut(a, b)
+		return o.child(a, concat(a.Gates[:i], b.Gates[j:])), o.child(b, concat(b.Gates[:j], a.Gates[i:]))
+	case CrossoverTwoPoint:
+		i1, j1 := o.cut(a, b)
+		i2, j2 := o.cut(a, b)
+		if i1 > i2 {
+			i1, i2 = i2, i1
+		}
+		if j1 > j2 {
+			j1, j2 = j2, j1
+		}
+		return o.child(a, concat(a.Gates[:i1], b.Gates[j1:j2], a.Gates[i2:])),
+			o.child(b, concat(b.Gates[:j1], a.Gates[i1:i2], b.Gates[j2:]))
+	case CrossoverUniform:
+		c1, c2 := a.Copy(), b.Copy()
+		for i := 0; i < len(c1.Gates) && i < len(c2.Gates); i++ {
+			if o.rng.Intn(2) == 0 {
+				c1.Gates[i], c2.Gates[i] = c2.Gates[i], c1.Gates[i]
+			}
+		}
+		return c1, c2
+	case CrossoverLayer:
+		ma, mb := moments(a.Gates, a.Width), moments(b.Gates, b.Width)
+		layers := 0
+		for _, moment := range ma {
+			if moment+1 > layers {
+				layers = moment + 1
+			}
+		}
+		cut := o.rng.Intn(layers + 1)
+		var g1, g2 []Gate
+		for i, moment := range ma {
+			if moment < cut {
+				g1 = append(g1, a.Gates[i])
+			} else {
+				g2 = append(g2, a.Gates[i])
+			}
+		}
+		var h1, h2 []Gate
+		for i, moment := range mb {
+			if moment < cut {
+				h1 = append(h1, b.Gates[i])
+			} else {
+				h2 = append(h2, b.Gates[i])
+			}
+		}
+		return o.child(a, concat(g1, h2)), o.child(b, concat(h1, g2))
+	}
+	c1, c2 := a.Copy(), b.Copy()
+	g1, g2 := o.rng.Intn(len(c1.Gates)), o.rng.Intn(len(c2.Gates))
+	c1.Gates[g1], c2.Gates[g2] = c2.Gates[g2], c1.Gates[g1]
+	return c1, c2
+}
@@ -5,6 +5,7 @@
 package heisenberg
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"math/cmplx"
@@ -29,6 +30,16 @@ func (a Dense64) String() string {
 	return output
 }
 
+// Dims returns the dimensions of the matrix
+func (a *Dense64) Dims() (r, c int) {
+	return a.R, a.C
+}
+
+// At returns the value at row i and column j
+func (a *Dense64) At(i, j int) complex128 {
+	return complex128(a.Matrix[i*a.C+j])
+}
+
 // MachineDense64 is a 64 bit dense matrix machine
 type MachineDense64 struct {
 	Dense64
@@ -73,6 +84,15 @@ func (a *MachineDense64) One() Qubit {
 	return qubit
 }
 
+// State returns the state vector of the machine
+func (a *MachineDense64) State() Vector128 {
+	state := make(Vector128, 0, len(a.Matrix))
+	for _, value := range a.Matrix {
+		state = append(state, complex128(value))
+	}
+	return state
+}
+
 // Tensor product is the tensor product
 func (a *Dense64) Tensor(b *Dense64) *Dense64 {
 	output := make([]complex64, 0, len(a.Matrix)*len(b.Matrix))
@@ -135,9 +155,9 @@ func (a *Dense64) Copy() *Dense64 {
 	return cp
 }
 
-// ControlledNot controlled not gate
-func (a *MachineDense64) ControlledNot(c []Qubit, t Qubit) *Dense64 {
-	n := a.Qubits
+// ControlledNotDense64 controlled not matrix for n qubits
+func ControlledNotDense64(n int, c []Qubit, t Qubit) *Dense64 {
+	identity := controlsTarget(c, t)
 	p := &Dense64{
 		R: 2,
 		C: 2,
@@ -157,7 +177,7 @@ func (a *MachineDense64) ControlledNot(c []Qubit, t Qubit) *Dense64 {
 		bits := int64(i)
 
 		// Apply X
-		apply := true
+		apply := !identity
 		for _, j := range c {
 			if (bits>>(Qubit(n-1)-j))&1 == 0 {
 				apply = false
@@ -185,11 +205,16 @@ func (a *MachineDense64) ControlledNot(c []Qubit, t Qubit) *Dense64 {
 		copy(g.Matrix[i*g.C:(i+1)*g.C], q.Matrix[int(ii)*g.C:int(ii+1)*g.C])
 	}
 
-	a.Dense64 = *g.Multiply(&a.Dense64)
-
 	return &g
 }
 
+// ControlledNot controlled not gate
+func (a *MachineDense64) ControlledNot(c []Qubit, t Qubit) Machine {
+	g := ControlledNotDense64(a.Qubits, c, t)
+	a.Dense64 = *g.Multiply(&a.Dense64)
+	return a
+}
+
 // Multiply multiplies the machine by a matrix
 func (a *MachineDense64) Multiply(b *Dense64, qubits ...Qubit) {
 	indexes := make(map[int]bool)
@@ -227,7 +252,7 @@ func IDense64() *Dense64 {
 }
 
 // I multiply by identity
-func (a *MachineDense64) I(qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) I(qubits ...Qubit) Machine {
 	a.Multiply(IDense64(), qubits...)
 	return a
 }
@@ -246,7 +271,7 @@ func HDense64() *Dense64 {
 }
 
 // H multiply by Hadamard gate
-func (a *MachineDense64) H(qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) H(qubits ...Qubit) Machine {
 	a.Multiply(HDense64(), qubits...)
 	return a
 }
@@ -264,7 +289,7 @@ func XDense64() *Dense64 {
 }
 
 // X multiply by Pauli X matrix
-func (a *MachineDense64) X(qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) X(qubits ...Qubit) Machine {
 	a.Multiply(XDense64(), qubits...)
 	return a
 }
@@ -282,7 +307,7 @@ func YDense64() *Dense64 {
 }
 
 // Y multiply by Pauli Y matrix
-func (a *MachineDense64) Y(qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) Y(qubits ...Qubit) Machine {
 	a.Multiply(YDense64(), qubits...)
 	return a
 }
@@ -300,7 +325,7 @@ func ZDense64() *Dense64 {
 }
 
 // Z multiply by Pauli Z matrix
-func (a *MachineDense64) Z(qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) Z(qubits ...Qubit) Machine {
 	a.Multiply(ZDense64(), qubits...)
 	return a
 }
@@ -318,7 +343,7 @@ func SDense64() *Dense64 {
 }
 
 // S multiply by phase matrix
-func (a *MachineDense64) S(qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) S(qubits ...Qubit) Machine {
 	a.Multiply(SDense64(), qubits...)
 	return a
 }
@@ -336,7 +361,7 @@ func TDense64() *Dense64 {
 }
 
 // T multiply by T matrix
-func (a *MachineDense64) T(qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) T(qubits ...Qubit) Machine {
 	a.Multiply(TDense64(), qubits...)
 	return a
 }
@@ -355,7 +380,7 @@ func UDense64(theta, phi, lambda float64) *Dense64 {
 }
 
 // U multiply by U matrix
-func (a *MachineDense64) U(theta, phi, lambda float64, qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) U(theta, phi, lambda float64, qubits ...Qubit) Machine {
 	a.Multiply(UDense64(theta, phi, lambda), qubits...)
 	return a
 }
@@ -373,7 +398,7 @@ func RXDense64(theta complex128) *Dense64 {
 }
 
 // RX rotate X gate
-func (a *MachineDense64) RX(theta float64, qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) RX(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RXDense64(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -391,7 +416,7 @@ func RYDense64(theta complex128) *Dense64 {
 }
 
 // RY rotate Y gate
-func (a *MachineDense64) RY(theta float64, qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) RY(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RYDense64(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -402,20 +427,20 @@ func RZDense64(theta complex128) *Dense64 {
 		R: 2,
 		C: 2,
 		Matrix: []complex64{
-			complex64(cmplx.Exp(-1 * complex128(theta))), 0,
-			0, complex64(cmplx.Exp(complex128(theta))),
+			complex64(cmplx.Exp(-1i * complex128(theta))), 0,
+			0, complex64(cmplx.Exp(1i * complex128(theta))),
 		},
 	}
 }
 
 // RZ rotate Z gate
-func (a *MachineDense64) RZ(theta float64, qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) RZ(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RZDense64(complex(theta/2, 0)), qubits...)
 	return a
 }
 
 // Swap swaps qubits`
-func (a *MachineDense64) Swap(qubits ...Qubit) *MachineDense64 {
+func (a *MachineDense64) Swap(qubits ...Qubit) Machine {
 	length := len(qubits)
 
 	for i := 0; i < length/2; i++ {
@@ -428,6 +453,265 @@ func (a *MachineDense64) Swap(qubits ...Qubit) *MachineDense64 {
 	return a
 }
 
+// PDense64 phase matrix
+func PDense64(lambda float64) *Dense64 {
+	return &Dense64{
+		R: 2,
+		C: 2,
+		Matrix: []complex64{
+			1, 0,
+			0, complex64(cmplx.Exp(complex(0, lambda))),
+		},
+	}
+}
+
+// SXDense64 square root of X matrix
+func SXDense64() *Dense64 {
+	return &Dense64{
+		R: 2,
+		C: 2,
+		Matrix: []complex64{
+			complex(.5, .5), complex(.5, -.5),
+			complex(.5, -.5), complex(.5, .5),
+		},
+	}
+}
+
+// SXdgDense64 inverse square root of X matrix
+func SXdgDense64() *Dense64 {
+	return &Dense64{
+		R: 2,
+		C: 2,
+		Matrix: []complex64{
+			complex(.5, -.5), complex(.5, .5),
+			complex(.5, .5), complex(.5, -.5),
+		},
+	}
+}
+
+// SdgDense64 inverse phase gate
+func SdgDense64() *Dense64 {
+	return &Dense64{
+		R: 2,
+		C: 2,
+		Matrix: []complex64{
+			1, 0,
+			0, -1i,
+		},
+	}
+}
+
+// TdgDense64 inverse T gate
+func TdgDense64() *Dense64 {
+	return &Dense64{
+		R: 2,
+		C: 2,
+		Matrix: []complex64{
+			1, 0,
+			0, complex64(cmplx.Exp(-1i * math.Pi / 4)),
+		},
+	}
+}
+
+// ControlledDense64 controlled gate matrix for n qubits
+func ControlledDense64(n int, gate Matrix, c []Qubit, t Qubit) *Dense64 {
+	identity := controlsTarget(c, t)
+	if rows, cols := gate.Dims(); rows != 2 || cols != 2 {
+		panic("invalid dimensions")
+	}
+	d := 1 << uint(n)
+	controls, target := 0, 1<<(Qubit(n-1)-t)
+	for _, j := range c {
+		controls |= 1 << (Qubit(n-1) - j)
+	}
+	g := Dense64{
+		R:      d,
+		C:      d,
+		Matrix: make([]complex64, d*d),
+	}
+	for i := 0; i < d; i++ {
+		if identity || i&controls != controls {
+			g.Matrix[i*d+i] = 1
+			continue
+		}
+		x := 0
+		if i&target != 0 {
+			x = 1
+		}
+		g.Matrix[i*d+(i&^target)] = complex64(gate.At(x, 0))
+		g.Matrix[i*d+(i|target)] = complex64(gate.At(x, 1))
+	}
+	return &g
+}
+
+// Controlled multiplies the target by a matrix when the controls are one
+func (a *MachineDense64) Controlled(gate Matrix, c []Qubit, t Qubit) Machine {
+	a.Dense64 = *ControlledDense64(a.Qubits, gate, c, t).Multiply(&a.Dense64)
+	return a
+}
+
+// CZ controlled Pauli Z gate
+func (a *MachineDense64) CZ(c []Qubit, t Qubit) Machine {
+	return a.Controlled(ZDense64(), c, t)
+}
+
+// CH controlled Hadamard gate
+func (a *MachineDense64) CH(c []Qubit, t Qubit) Machine {
+	return a.Controlled(HDense64(), c, t)
+}
+
+// CU controlled U gate
+func (a *MachineDense64) CU(theta, phi, lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(UDense64(theta, phi, lambda), c, t)
+}
+
+// CRX controlled rotate X gate
+func (a *MachineDense64) CRX(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RXDense64(complex(theta/2, 0)), c, t)
+}
+
+// CRY controlled rotate Y gate
+func (a *MachineDense64) CRY(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RYDense64(complex(theta/2, 0)), c, t)
+}
+
+// CRZ controlled rotate Z gate
+func (a *MachineDense64) CRZ(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RZDense64(complex(theta/2, 0)), c, t)
+}
+
+// CPhase controlled phase gate
+func (a *MachineDense64) CPhase(lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(PDense64(lambda), c, t)
+}
+
+// Toffoli controlled controlled not gate
+func (a *MachineDense64) Toffoli(c0, c1, t Qubit) Machine {
+	return a.ControlledNot([]Qubit{c0, c1}, t)
+}
+
+// Fredkin controlled swap gate
+func (a *MachineDense64) Fredkin(c, t0, t1 Qubit) Machine {
+	a.ControlledNot([]Qubit{t1}, t0)
+	a.ControlledNot([]Qubit{c, t0}, t1)
+	a.ControlledNot([]Qubit{t1}, t0)
+	return a
+}
+
+// UnitaryDense64 unitary matrix applied to qubits of an n qubit machine
+func UnitaryDense64(n int, u Matrix, qubits ...Qubit) *Dense64 {
+	d, s := 1<<uint(n), newSubspace(n, qubits)
+	m := 1 << uint(len(qubits))
+	g := Dense64{
+		R:      d,
+		C:      d,
+		Matrix: make([]complex64, d*d),
+	}
+	for i := 0; i < d; i++ {
+		x, base := s.index(i), i&^s.mask
+		for k := 0; k < m; k++ {
+			g.Matrix[i*d+(base|s.spread(k))] = complex64(u.At(x, k))
+		}
+	}
+	return &g
+}
+
+// ApplyUnitary multiplies the qubits by a unitary matrix, the first qubit is
+// the most significant bit of the matrix index
+func (a *MachineDense64) ApplyUnitary(u Matrix, qubits ...Qubit) error {
+	if err := validate(u, a.Qubits, qubits); err != nil {
+		return err
+	}
+	a.unitary(u, qubits...)
+	return nil
+}
+
+// SX multiply by square root of X matrix
+func (a *MachineDense64) SX(qubits ...Qubit) Machine {
+	a.Multiply(SXDense64(), qubits...)
+	return a
+}
+
+// SXdg multiply by inverse square root of X matrix
+func (a *MachineDense64) SXdg(qubits ...Qubit) Machine {
+	a.Multiply(SXdgDense64(), qubits...)
+	return a
+}
+
+// Sdg multiply by inverse phase matrix
+func (a *MachineDense64) Sdg(qubits ...Qubit) Machine {
+	a.Multiply(SdgDense64(), qubits...)
+	return a
+}
+
+// Tdg multiply by inverse T matrix
+func (a *MachineDense64) Tdg(qubits ...Qubit) Machine {
+	a.Multiply(TdgDense64(), qubits...)
+	return a
+}
+
+// P multiply by phase matrix with angle lambda
+func (a *MachineDense64) P(lambda float64, qubits ...Qubit) Machine {
+	a.Multiply(PDense64(lambda), qubits...)
+	return a
+}
+
+// U1 multiply by U1 matrix, an alias for P
+func (a *MachineDense64) U1(lambda float64, qubits ...Qubit) Machine {
+	return a.P(lambda, qubits...)
+}
+
+// U2 multiply by U2 matrix, an alias for U with theta pi/2
+func (a *MachineDense64) U2(phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(math.Pi/2, phi, lambda, qubits...)
+}
+
+// U3 multiply by U3 matrix, an alias for U
+func (a *MachineDense64) U3(theta, phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(theta, phi, lambda, qubits...)
+}
+
+// unitary multiplies the qubits by a matrix without validating it
+func (a *MachineDense64) unitary(u Matrix, qubits ...Qubit) {
+	a.Dense64 = *UnitaryDense64(a.Qubits, u, qubits...).Multiply(&a.Dense64)
+}
+
+// ISwap iSWAP gate
+func (a *MachineDense64) ISwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ISwapDense128(), q0, q1)
+	return a
+}
+
+// SqrtSwap square root of swap gate
+func (a *MachineDense64) SqrtSwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(SqrtSwapDense128(), q0, q1)
+	return a
+}
+
+// RXX XX rotation gate
+func (a *MachineDense64) RXX(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RXXDense128(theta), q0, q1)
+	return a
+}
+
+// RYY YY rotation gate
+func (a *MachineDense64) RYY(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RYYDense128(theta), q0, q1)
+	return a
+}
+
+// RZZ ZZ rotation gate
+func (a *MachineDense64) RZZ(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RZZDense128(theta), q0, q1)
+	return a
+}
+
+// ECR echoed cross resonance gate
+func (a *MachineDense64) ECR(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ECRDense128(), q0, q1)
+	return a
+}
+
 // Dense128 is an algebriac matrix
 type Dense128 struct {
 	R, C   int
@@ -445,6 +729,16 @@ func (a Dense128) String() string {
 	return output
 }
 
+// Dims returns the dimensions of the matrix
+func (a *Dense128) Dims() (r, c int) {
+	return a.R, a.C
+}
+
+// At returns the value at row i and column j
+func (a *Dense128) At(i, j int) complex128 {
+	return a.Matrix[i*a.C+j]
+}
+
 // MachineDense128 is a 128 bit dense matrix machine
 type MachineDense128 struct {
 	Dense128
@@ -489,6 +783,13 @@ func (a *MachineDense128) One() Qubit {
 	return qubit
 }
 
+// State returns the state vector of the machine
+func (a *MachineDense128) State() Vector128 {
+	state := make(Vector128, len(a.Matrix))
+	copy(state, a.Matrix)
+	return state
+}
+
 // Tensor product is the tensor product
 func (a *Dense128) Tensor(b *Dense128) *Dense128 {
 	output := make([]complex128, 0, len(a.Matrix)*len(b.Matrix))
@@ -579,9 +880,9 @@ func (a *Dense128) Copy() *Dense128 {
 	return cp
 }
 
-// ControlledNot controlled not gate
-func (a *MachineDense128) ControlledNot(c []Qubit, t Qubit) *Dense128 {
-	n := a.Qubits
+// ControlledNotDense128 controlled not matrix for n qubits
+func ControlledNotDense128(n int, c []Qubit, t Qubit) *Dense128 {
+	identity := controlsTarget(c, t)
 	p := &Dense128{
 		R: 2,
 		C: 2,
@@ -601,7 +902,7 @@ func (a *MachineDense128) ControlledNot(c []Qubit, t Qubit) *Dense128 {
 		bits := int64(i)
 
 		// Apply X
-		apply := true
+		apply := !identity
 		for _, j := range c {
 			if (bits>>(Qubit(n-1)-j))&1 == 0 {
 				apply = false
@@ -629,11 +930,16 @@ func (a *MachineDense128) ControlledNot(c []Qubit, t Qubit) *Dense128 {
 		copy(g.Matrix[i*g.C:(i+1)*g.C], q.Matrix[int(ii)*g.C:int(ii+1)*g.C])
 	}
 
-	a.Dense128 = *g.Multiply(&a.Dense128)
-
 	return &g
 }
 
+// ControlledNot controlled not gate
+func (a *MachineDense128) ControlledNot(c []Qubit, t Qubit) Machine {
+	g := ControlledNotDense128(a.Qubits, c, t)
+	a.Dense128 = *g.Multiply(&a.Dense128)
+	return a
+}
+
 // Multiply multiplies the machine by a matrix
 func (a *MachineDense128) Multiply(b *Dense128, c ...Qubit) {
 	indexes := make(map[int]bool)
@@ -671,7 +977,7 @@ func IDense128() *Dense128 {
 }
 
 // I multiply by identity
-func (a *MachineDense128) I(qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) I(qubits ...Qubit) Machine {
 	a.Multiply(IDense128(), qubits...)
 	return a
 }
@@ -690,7 +996,7 @@ func HDense128() *Dense128 {
 }
 
 // H multiply by Hadamard gate
-func (a *MachineDense128) H(qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) H(qubits ...Qubit) Machine {
 	a.Multiply(HDense128(), qubits...)
 	return a
 }
@@ -708,7 +1014,7 @@ func XDense128() *Dense128 {
 }
 
 // X multiply by Pauli X matrix
-func (a *MachineDense128) X(qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) X(qubits ...Qubit) Machine {
 	a.Multiply(XDense128(), qubits...)
 	return a
 }
@@ -726,7 +1032,7 @@ func YDense128() *Dense128 {
 }
 
 // Y multiply by Pauli Y matrix
-func (a *MachineDense128) Y(qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) Y(qubits ...Qubit) Machine {
 	a.Multiply(YDense128(), qubits...)
 	return a
 }
@@ -744,7 +1050,7 @@ func ZDense128() *Dense128 {
 }
 
 // Z multiply by Pauli Z matrix
-func (a *MachineDense128) Z(qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) Z(qubits ...Qubit) Machine {
 	a.Multiply(ZDense128(), qubits...)
 	return a
 }
@@ -762,7 +1068,7 @@ func SDense128() *Dense128 {
 }
 
 // S multiply by phase matrix
-func (a *MachineDense128) S(qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) S(qubits ...Qubit) Machine {
 	a.Multiply(SDense128(), qubits...)
 	return a
 }
@@ -780,7 +1086,7 @@ func TDense128() *Dense128 {
 }
 
 // T multiply by T matrix
-func (a *MachineDense128) T(qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) T(qubits ...Qubit) Machine {
 	a.Multiply(TDense128(), qubits...)
 	return a
 }
@@ -799,7 +1105,7 @@ func UDense128(theta, phi, lambda float64) *Dense128 {
 }
 
 // U multiply by U matrix
-func (a *MachineDense128) U(theta, phi, lambda float64, qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) U(theta, phi, lambda float64, qubits ...Qubit) Machine {
 	a.Multiply(UDense128(theta, phi, lambda), qubits...)
 	return a
 }
@@ -817,7 +1123,7 @@ func RXDense128(theta complex128) *Dense128 {
 }
 
 // RX rotate X gate
-func (a *MachineDense128) RX(theta float64, qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) RX(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RXDense128(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -835,7 +1141,7 @@ func RYDense128(theta complex128) *Dense128 {
 }
 
 // RY rotate Y gate
-func (a *MachineDense128) RY(theta float64, qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) RY(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RYDense128(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -846,20 +1152,20 @@ func RZDense128(theta complex128) *Dense128 {
 		R: 2,
 		C: 2,
 		Matrix: []complex128{
-			cmplx.Exp(-1 * theta), 0,
-			0, cmplx.Exp(theta),
+			cmplx.Exp(-1i * theta), 0,
+			0, cmplx.Exp(1i * theta),
 		},
 	}
 }
 
 // RZ rotate Z gate
-func (a *MachineDense128) RZ(theta float64, qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) RZ(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RZDense128(complex(theta/2, 0)), qubits...)
 	return a
 }
 
 // Swap swaps qubits`
-func (a *MachineDense128) Swap(qubits ...Qubit) *MachineDense128 {
+func (a *MachineDense128) Swap(qubits ...Qubit) Machine {
 	length := len(qubits)
 
 	for i := 0; i < length/2; i++ {
@@ -872,12 +1178,366 @@ func (a *MachineDense128) Swap(qubits ...Qubit) *MachineDense128 {
 	return a
 }
 
+// PDense128 phase matrix
+func PDense128(lambda float64) *Dense128 {
+	return &Dense128{
+		R: 2,
+		C: 2,
+		Matrix: []complex128{
+			1, 0,
+			0, cmplx.Exp(complex(0, lambda)),
+		},
+	}
+}
+
+// SXDense128 square root of X matrix
+func SXDense128() *Dense128 {
+	return &Dense128{
+		R: 2,
+		C: 2,
+		Matrix: []complex128{
+			complex(.5, .5), complex(.5, -.5),
+			complex(.5, -.5), complex(.5, .5),
+		},
+	}
+}
+
+// SXdgDense128 inverse square root of X matrix
+func SXdgDense128() *Dense128 {
+	return &Dense128{
+		R: 2,
+		C: 2,
+		Matrix: []complex128{
+			complex(.5, -.5), complex(.5, .5),
+			complex(.5, .5), complex(.5, -.5),
+		},
+	}
+}
+
+// SdgDense128 inverse phase gate
+func SdgDense128() *Dense128 {
+	return &Dense128{
+		R: 2,
+		C: 2,
+		Matrix: []complex128{
+			1, 0,
+			0, -1i,
+		},
+	}
+}
+
+// TdgDense128 inverse T gate
+func TdgDense128() *Dense128 {
+	return &Dense128{
+		R: 2,
+		C: 2,
+		Matrix: []complex128{
+			1, 0,
+			0, cmplx.Exp(-1i * math.Pi / 4),
+		},
+	}
+}
+
+// ISwapDense128 iSWAP matrix
+func ISwapDense128() *Dense128 {
+	return &Dense128{
+		R: 4,
+		C: 4,
+		Matrix: []complex128{
+			1, 0, 0, 0,
+			0, 0, 1i, 0,
+			0, 1i, 0, 0,
+			0, 0, 0, 1,
+		},
+	}
+}
+
+// SqrtSwapDense128 square root of swap matrix
+func SqrtSwapDense128() *Dense128 {
+	a, b := complex(.5, .5), complex(.5, -.5)
+	return &Dense128{
+		R: 4,
+		C: 4,
+		Matrix: []complex128{
+			1, 0, 0, 0,
+			0, a, b, 0,
+			0, b, a, 0,
+			0, 0, 0, 1,
+		},
+	}
+}
+
+// RXXDense128 xx rotation matrix
+func RXXDense128(theta float64) *Dense128 {
+	c, s := complex(math.Cos(theta/2), 0), complex(0, -math.Sin(theta/2))
+	return &Dense128{
+		R: 4,
+		C: 4,
+		Matrix: []complex128{
+			c, 0, 0, s,
+			0, c, s, 0,
+			0, s, c, 0,
+			s, 0, 0, c,
+		},
+	}
+}
+
+// RYYDense128 yy rotation matrix
+func RYYDense128(theta float64) *Dense128 {
+	c, s := complex(math.Cos(theta/2), 0), complex(0, math.Sin(theta/2))
+	return &Dense128{
+		R: 4,
+		C: 4,
+		Matrix: []complex128{
+			c, 0, 0, s,
+			0, c, -s, 0,
+			0, -s, c, 0,
+			s, 0, 0, c,
+		},
+	}
+}
+
+// RZZDense128 zz rotation matrix
+func RZZDense128(theta float64) *Dense128 {
+	a, b := cmplx.Exp(complex(0, -theta/2)), cmplx.Exp(complex(0, theta/2))
+	return &Dense128{
+		R: 4,
+		C: 4,
+		Matrix: []complex128{
+			a, 0, 0, 0,
+			0, b, 0, 0,
+			0, 0, b, 0,
+			0, 0, 0, a,
+		},
+	}
+}
+
+// ECRDense128 echoed cross resonance matrix, (XI - YX)/sqrt(2) with the
+// first qubit as the most significant bit
+func ECRDense128() *Dense128 {
+	v := complex(1/math.Sqrt2, 0)
+	return &Dense128{
+		R: 4,
+		C: 4,
+		Matrix: []complex128{
+			0, 0, v, 1i * v,
+			0, 0, 1i * v, v,
+			v, -1i * v, 0, 0,
+			-1i * v, v, 0, 0,
+		},
+	}
+}
+
+// ControlledDense128 controlled gate matrix for n qubits
+func ControlledDense128(n int, gate Matrix, c []Qubit, t Qubit) *Dense128 {
+	identity := controlsTarget(c, t)
+	if rows, cols := gate.Dims(); rows != 2 || cols != 2 {
+		panic("invalid dimensions")
+	}
+	d := 1 << uint(n)
+	controls, target := 0, 1<<(Qubit(n-1)-t)
+	for _, j := range c {
+		controls |= 1 << (Qubit(n-1) - j)
+	}
+	g := Dense128{
+		R:      d,
+		C:      d,
+		Matrix: make([]complex128, d*d),
+	}
+	for i := 0; i < d; i++ {
+		if identity || i&controls != controls {
+			g.Matrix[i*d+i] = 1
+			continue
+		}
+		x := 0
+		if i&target != 0 {
+			x = 1
+		}
+		g.Matrix[i*d+(i&^target)] = gate.At(x, 0)
+		g.Matrix[i*d+(i|target)] = gate.At(x, 1)
+	}
+	return &g
+}
+
+// Controlled multiplies the target by a matrix when the controls are one
+func (a *MachineDense128) Controlled(gate Matrix, c []Qubit, t Qubit) Machine {
+	a.Dense128 = *ControlledDense128(a.Qubits, gate, c, t).Multiply(&a.Dense128)
+	return a
+}
+
+// CZ controlled Pauli Z gate
+func (a *MachineDense128) CZ(c []Qubit, t Qubit) Machine {
+	return a.Controlled(ZDense128(), c, t)
+}
+
+// CH controlled Hadamard gate
+func (a *MachineDense128) CH(c []Qubit, t Qubit) Machine {
+	return a.Controlled(HDense128(), c, t)
+}
+
+// CU controlled U gate
+func (a *MachineDense128) CU(theta, phi, lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(UDense128(theta, phi, lambda), c, t)
+}
+
+// CRX controlled rotate X gate
+func (a *MachineDense128) CRX(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RXDense128(complex(theta/2, 0)), c, t)
+}
+
+// CRY controlled rotate Y gate
+func (a *MachineDense128) CRY(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RYDense128(complex(theta/2, 0)), c, t)
+}
+
+// CRZ controlled rotate Z gate
+func (a *MachineDense128) CRZ(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RZDense128(complex(theta/2, 0)), c, t)
+}
+
+// CPhase controlled phase gate
+func (a *MachineDense128) CPhase(lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(PDense128(lambda), c, t)
+}
+
+// Toffoli controlled controlled not gate
+func (a *MachineDense128) Toffoli(c0, c1, t Qubit) Machine {
+	return a.ControlledNot([]Qubit{c0, c1}, t)
+}
+
+// Fredkin controlled swap gate
+func (a *MachineDense128) Fredkin(c, t0, t1 Qubit) Machine {
+	a.ControlledNot([]Qubit{t1}, t0)
+	a.ControlledNot([]Qubit{c, t0}, t1)
+	a.ControlledNot([]Qubit{t1}, t0)
+	return a
+}
+
+// UnitaryDense128 unitary matrix applied to qubits of an n qubit machine
+func UnitaryDense128(n int, u Matrix, qubits ...Qubit) *Dense128 {
+	d, s := 1<<uint(n), newSubspace(n, qubits)
+	m := 1 << uint(len(qubits))
+	g := Dense128{
+		R:      d,
+		C:      d,
+		Matrix: make([]complex128, d*d),
+	}
+	for i := 0; i < d; i++ {
+		x, base := s.index(i), i&^s.mask
+		for k := 0; k < m; k++ {
+			g.Matrix[i*d+(base|s.spread(k))] = u.At(x, k)
+		}
+	}
+	return &g
+}
+
+// ApplyUnitary multiplies the qubits by a unitary matrix, the first qubit is
+// the most significant bit of the matrix index
+func (a *MachineDense128) ApplyUnitary(u Matrix, qubits ...Qubit) error {
+	if err := validate(u, a.Qubits, qubits); err != nil {
+		return err
+	}
+	a.unitary(u, qubits...)
+	return nil
+}
+
+// SX multiply by square root of X matrix
+func (a *MachineDense128) SX(qubits ...Qubit) Machine {
+	a.Multiply(SXDense128(), qubits...)
+	return a
+}
+
+// SXdg multiply by inverse square root of X matrix
+func (a *MachineDense128) SXdg(qubits ...Qubit) Machine {
+	a.Multiply(SXdgDense128(), qubits...)
+	return a
+}
+
+// Sdg multiply by inverse phase matrix
+func (a *MachineDense128) Sdg(qubits ...Qubit) Machine {
+	a.Multiply(SdgDense128(), qubits...)
+	return a
+}
+
+// Tdg multiply by inverse T matrix
+func (a *MachineDense128) Tdg(qubits ...Qubit) Machine {
+	a.Multiply(TdgDense128(), qubits...)
+	return a
+}
+
+// P multiply by phase matrix with angle lambda
+func (a *MachineDense128) P(lambda float64, qubits ...Qubit) Machine {
+	a.Multiply(PDense128(lambda), qubits...)
+	return a
+}
+
+// U1 multiply by U1 matrix, an alias for P
+func (a *MachineDense128) U1(lambda float64, qubits ...Qubit) Machine {
+	return a.P(lambda, qubits...)
+}
+
+// U2 multiply by U2 matrix, an alias for U with theta pi/2
+func (a *MachineDense128) U2(phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(math.Pi/2, phi, lambda, qubits...)
+}
+
+// U3 multiply by U3 matrix, an alias for U
+func (a *MachineDense128) U3(theta, phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(theta, phi, lambda, qubits...)
+}
+
+// unitary multiplies the qubits by a matrix without validating it
+func (a *MachineDense128) unitary(u Matrix, qubits ...Qubit) {
+	a.Dense128 = *UnitaryDense128(a.Qubits, u, qubits...).Multiply(&a.Dense128)
+}
+
+// ISwap iSWAP gate
+func (a *MachineDense128) ISwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ISwapDense128(), q0, q1)
+	return a
+}
+
+// SqrtSwap square root of swap gate
+func (a *MachineDense128) SqrtSwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(SqrtSwapDense128(), q0, q1)
+	return a
+}
+
+// RXX XX rotation gate
+func (a *MachineDense128) RXX(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RXXDense128(theta), q0, q1)
+	return a
+}
+
+// RYY YY rotation gate
+func (a *MachineDense128) RYY(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RYYDense128(theta), q0, q1)
+	return a
+}
+
+// RZZ ZZ rotation gate
+func (a *MachineDense128) RZZ(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RZZDense128(theta), q0, q1)
+	return a
+}
+
+// ECR echoed cross resonance gate
+func (a *MachineDense128) ECR(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ECRDense128(), q0, q1)
+	return a
+}
+
 type Point struct {
 	X, Y float64
 }
 
-// Points returns the point representation of the quantum algorithm.
-func (d *MachineDense128) Points() []Point {
+// PointsObserver observes the fittest points of each generation of Points
+type PointsObserver func(generation int, fitness float64, points []Point)
+
+// Points returns the point representation of the quantum algorithm. If the
+// context is done the fittest points so far are returned with the error of the
+// context. The observer is called after each generation if it is not nil.
+func (d *MachineDense128) Points(ctx context.Context, observer PointsObserver) ([]Point, error) {
 	rng := rand.New(rand.NewSource(1))
 	type Genome struct {
 		Points  []Point
@@ -928,10 +1588,15 @@ func (d *MachineDense128) Points() []Point {
 		sort.Slice(pop, func(i, j int) bool {
 			return pop[i].Fitness < pop[j].Fitness
 		})
+		if observer != nil {
+			observer(generation, pop[0].Fitness, pop[0].Points)
+		}
 		if pop[0].Fitness < 0.0001 || generation > 8*1024 {
-			return pop[0].Points
+			return pop[0].Points, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return pop[0].Points, err
 		}
-		fmt.Println(pop[0].Fitness)
 		pop = pop[:128]
 		length := len(pop)
 		for i := 0; i < length/2; i++ {
@@ -0,0 +1,402 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// symbolKind is a kind of symbol drawn for a gate on a qubit
+type symbolKind int
+
+const (
+	// symbolBox is a box with a label
+	symbolBox symbolKind = iota
+	// symbolControl is a control dot
+	symbolControl
+	// symbolTarget is the target of a controlled not
+	symbolTarget
+	// symbolSwap is a swap cross
+	symbolSwap
+	// symbolMeasure is a measurement into the labeled bit
+	symbolMeasure
+	// symbolBarrier is a barrier
+	symbolBarrier
+)
+
+// symbol is drawn for a gate on a qubit
+type symbol struct {
+	kind  symbolKind
+	label string
+}
+
+// element is a gate placed in a column of a diagram, spanning the qubits from
+// top to bottom
+type element struct {
+	gate        Gate
+	symbols     map[Qubit]symbol
+	top, bottom Qubit
+}
+
+// labels are the names drawn for the gate types
+var labels = map[GateType]string{
+	GateTypeI:        "I",
+	GateTypeH:        "H",
+	GateTypeX:        "X",
+	GateTypeY:        "Y",
+	GateTypeZ:        "Z",
+	GateTypeS:        "S",
+	GateTypeT:        "T",
+	GateTypeU:        "U",
+	GateTypeRX:       "RX",
+	GateTypeRY:       "RY",
+	GateTypeRZ:       "RZ",
+	GateTypeSX:       "√X",
+	GateTypeSXdg:     "√X†",
+	GateTypeSdg:      "S†",
+	GateTypeTdg:      "T†",
+	GateTypeP:        "P",
+	GateTypeU1:       "U1",
+	GateTypeU2:       "U2",
+	GateTypeU3:       "U3",
+	GateTypeISwap:    "iSWAP",
+	GateTypeSqrtSwap: "√SWAP",
+	GateTypeRXX:      "RXX",
+	GateTypeRYY:      "RYY",
+	GateTypeRZZ:      "RZZ",
+	GateTypeECR:      "ECR",
+	GateTypeCZ:       "Z",
+	GateTypeCH:       "H",
+	GateTypeCU:       "U",
+	GateTypeCRX:      "RX",
+	GateTypeCRY:      "RY",
+	GateTypeCRZ:      "RZ",
+	GateTypeCPhase:   "P",
+}
+
+// parameters returns the angles of a gate
+func (g *Gate) parameters() []float64 {
+	switch g.GateType {
+	case GateTypeU, GateTypeU3, GateTypeCU:
+		return []float64{g.Theta, g.Phi, g.Lambda}
+	case GateTypeU2:
+		return []float64{g.Phi, g.Lambda}
+	case GateTypeP, GateTypeU1, GateTypeCPhase:
+		return []float64{g.Lambda}
+	case GateTypeRX, GateTypeRY, GateTypeRZ, GateTypeRXX, GateTypeRYY, GateTypeRZZ,
+		GateTypeCRX, GateTypeCRY, GateTypeCRZ:
+		return []float64{g.Theta}
+	}
+	return nil
+}
+
+// prettyAngle formats an angle for drawing
+func prettyAngle(theta float64) string {
+	text := angle(theta, 4)
+	text = strings.Replace(text, "*pi", "π", 1)
+	return strings.Replace(text, "pi", "π", 1)
+}
+
+// label returns the name of a gate with its formatted angles
+func (g *Gate) label() string {
+	label := labels[g.GateType]
+	if parameters := g.parameters(); len(parameters) > 0 {
+		formatted := make([]string, len(parameters))
+		for i, parameter := range parameters {
+			formatted[i] = prettyAngle(parameter)
+		}
+		label += "(" + strings.Join(formatted, ",") + ")"
+	}
+	return label
+}
+
+// expand splits single qubit gates applied to several qubits into a gate per
+// qubit and swaps of several qubits into pairs
+func (g *Gate) expand() []Gate {
+	switch g.GateType {
+	case GateTypeI, GateTypeH, GateTypeX, GateTypeY, GateTypeZ, GateTypeS, GateTypeT,
+		GateTypeU, GateTypeRX, GateTypeRY, GateTypeRZ, GateTypeSX, GateTypeSXdg,
+		GateTypeSdg, GateTypeTdg, GateTypeP, GateTypeU1, GateTypeU2, GateTypeU3:
+		gates := make([]Gate, 0, len(g.Qubits))
+		for _, qubit := range g.Qubits {
+			gate := g.Copy()
+			gate.Qubits = []Qubit{qubit}
+			gates = append(gates, gate)
+		}
+		return gates
+	case GateTypeSwap:
+		gates := []Gate{}
+		for i, j := 0, len(g.Qubits)-1; i < j; i, j = i+1, j-1 {
+			gates = append(gates, Gate{GateType: GateTypeSwap, Qubits: []Qubit{g.Qubits[i], g.Qubits[j]}})
+		}
+		return gates
+	case GateTypeMeasure:
+		gates := make([]Gate, 0, len(g.Qubits))
+		for i, qubit := range g.Qubits {
+			gates = append(gates, Gate{GateType: GateTypeMeasure, Qubits: []Qubit{qubit}, Bits: []int{g.Bits[i]}})
+		}
+		return gates
+	}
+	return []Gate{g.Copy()}
+}
+
+// bit returns the name of a classical bit of the circuit
+func (c *Circuit) bit(bit int) string {
+	index := bit
+	for _, register := range c.Registers {
+		if index < register.Size {
+			return fmt.Sprintf("%s[%d]", register.Name, index)
+		}
+		index -= register.Size
+	}
+	return fmt.Sprintf("c[%d]", bit)
+}
+
+// symbols returns the symbols drawn for a gate on its qubits
+func (c *Circuit) symbols(g *Gate) map[Qubit]symbol {
+	symbols := make(map[Qubit]symbol)
+	switch g.GateType {
+	case GateTypeControlledNot:
+		symbols[g.Target] = symbol{kind: symbolTarget}
+	case GateTypeCZ:
+		symbols[g.Target] = symbol{kind: symbolControl}
+	case GateTypeSwap:
+		for _, qubit := range g.Qubits {
+			symbols[qubit] = symbol{kind: symbolSwap}
+		}
+		return symbols
+	case GateTypeCSwap:
+		symbols[g.Qubits[0]] = symbol{kind: symbolControl}
+		symbols[g.Qubits[1]] = symbol{kind: symbolSwap}
+		symbols[g.Qubits[2]] = symbol{kind: symbolSwap}
+		return symbols
+	case GateTypeECR:
+		symbols[g.Qubits[0]] = symbol{kind: symbolBox, label: "ECR₀"}
+		symbols[g.Qubits[1]] = symbol{kind: symbolBox, label: "ECR₁"}
+		return symbols
+	case GateTypeMeasure:
+		for i, qubit := range g.Qubits {
+			symbols[qubit] = symbol{kind: symbolMeasure, label: c.bit(g.Bits[i])}
+		}
+		return symbols
+	case GateTypeBarrier:
+		for _, qubit := range g.Qubits {
+			symbols[qubit] = symbol{kind: symbolBarrier}
+		}
+		return symbols
+	default:
+		if g.Controlled() {
+			symbols[g.Target] = symbol{kind: symbolBox, label: g.label()}
+		} else {
+			for _, qubit := range g.Qubits {
+				symbols[qubit] = symbol{kind: symbolBox, label: g.label()}
+			}
+			return symbols
+		}
+	}
+	for _, qubit := range g.Qubits {
+		symbols[qubit] = symbol{kind: symbolControl}
+	}
+	return symbols
+}
+
+// wires returns the number of wires to draw, the width of the circuit or
+// enough wires for the largest qubit the gates act on
+func (c *Circuit) wires() int {
+	wires := c.Width
+	for i := range c.Gates {
+		for _, qubit := range c.Gates[i].Operands() {
+			if int(qubit) >= wires {
+				wires = int(qubit) + 1
+			}
+		}
+	}
+	return wires
+}
+
+// layout places the gates of the circuit in columns, the gates of a column do
+// not share or cross qubits. Malformed gates are skipped.
+func (c *Circuit) layout() [][]element {
+	wires := c.wires()
+	columns, next := [][]element{}, make([]int, wires)
+	for i := range c.Gates {
+		if c.Gates[i].validate() != nil {
+			continue
+		}
+		for _, gate := range c.Gates[i].expand() {
+			if gate.GateType == GateTypeBarrier && len(gate.Qubits) == 0 {
+				for j := 0; j < wires; j++ {
+					gate.Qubits = append(gate.Qubits, Qubit(j))
+				}
+			}
+			e := element{
+				gate:    gate,
+				symbols: c.symbols(&gate),
+				top:     Qubit(wires),
+			}
+			for qubit := range e.symbols {
+				if qubit < e.top {
+					e.top = qubit
+				}
+				if qubit > e.bottom {
+					e.bottom = qubit
+				}
+			}
+			if len(e.symbols) == 0 {
+				continue
+			}
+			column := 0
+			for qubit := e.top; qubit <= e.bottom; qubit++ {
+				if next[qubit] > column {
+					column = next[qubit]
+				}
+			}
+			for qubit := e.top; qubit <= e.bottom; qubit++ {
+				next[qubit] = column + 1
+			}
+			for len(columns) <= column {
+				columns = append(columns, nil)
+			}
+			columns[column] = append(columns[column], e)
+		}
+	}
+	return columns
+}
+
+// text returns the text drawn for a symbol
+func (s symbol) text() string {
+	switch s.kind {
+	case symbolControl:
+		return "●"
+	case symbolTarget:
+		return "⊕"
+	case symbolSwap:
+		return "×"
+	case symbolMeasure:
+		return "┤M→" + s.label + "├"
+	case symbolBarrier:
+		return "░"
+	}
+	return "┤" + s.label + "├"
+}
+
+// center centers text in a field of width runes filled with fill
+func center(text string, width int, fill string) string {
+	n := utf8.RuneCountInString(text)
+	left := (width - n) / 2
+	right := width - n - left
+	return strings.Repeat(fill, left) + text + strings.Repeat(fill, right)
+}
+
+// Diagram draws the circuit as text with a wire per qubit, wrapping lines at
+// width characters. Lines are not wrapped if width is not positive. Malformed
+// gates are not drawn.
+func (c *Circuit) Diagram(width int) string {
+	wires := c.wires()
+	if wires == 0 {
+		return ""
+	}
+	rows := 2*wires - 1
+	prefixes := make([]string, rows)
+	names := make([]string, wires)
+	size := 0
+	for i := range names {
+		names[i] = fmt.Sprintf("q%d: ", i)
+		if n := len(names[i]); n > size {
+			size = n
+		}
+	}
+	for i := range prefixes {
+		if i%2 == 0 {
+			prefixes[i] = names[i/2] + strings.Repeat(" ", size-len(names[i/2]))
+		} else {
+			prefixes[i] = strings.Repeat(" ", size)
+		}
+	}
+
+	cells, widths := [][]string{}, []int{}
+	for _, column := range c.layout() {
+		w := 1
+		for _, e := range column {
+			for _, s := range e.symbols {
+				if n := utf8.RuneCountInString(s.text()); n > w {
+					w = n
+				}
+			}
+		}
+		if w%2 == 0 {
+			w++
+		}
+		cell := make([]string, rows)
+		for row := 0; row < rows; row++ {
+			qubit, wire := Qubit(row/2), row%2 == 0
+			text, fill := "", " "
+			if wire {
+				fill = "─"
+			}
+			for _, e := range column {
+				if wire {
+					if s, ok := e.symbols[qubit]; ok {
+						text = s.text()
+					} else if qubit > e.top && qubit < e.bottom {
+						text = "┼"
+					}
+				} else if qubit >= e.top && qubit < e.bottom {
+					text = "│"
+					if e.gate.GateType == GateTypeBarrier {
+						text = "░"
+					}
+				}
+			}
+			cell[row] = fill + center(text, w, fill) + fill
+		}
+		cells, widths = append(cells, cell), append(widths, w+2)
+	}
+
+	blocks := [][]int{}
+	start, length := 0, 0
+	for i := range cells {
+		if width > 0 && i > start && size+2+length+widths[i] > width {
+			blocks = append(blocks, []int{start, i})
+			start, length = i, 0
+		}
+		length += widths[i]
+	}
+	blocks = append(blocks, []int{start, len(cells)})
+
+	var builder strings.Builder
+	for b, block := range blocks {
+		if b > 0 {
+			builder.WriteString("\n")
+		}
+		for row := 0; row < rows; row++ {
+			line := prefixes[row]
+			wire := row%2 == 0
+			if b > 0 {
+				if wire {
+					line += "«"
+				} else {
+					line += " "
+				}
+			}
+			for _, cell := range cells[block[0]:block[1]] {
+				line += cell[row]
+			}
+			if b < len(blocks)-1 && wire {
+				line += "»"
+			}
+			builder.WriteString(strings.TrimRight(line, " "))
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
+
+// Diagram draws the gates of the genome as text
+func (g *Genome) Diagram(width int) string {
+	return g.Circuit().Diagram(width)
+}
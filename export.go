@@ -0,0 +1,299 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// svgMargin is the margin around an SVG diagram
+	svgMargin = 20
+	// svgRow is the distance between the wires of an SVG diagram
+	svgRow = 48
+	// svgName is the width of the qubit names of an SVG diagram
+	svgName = 40
+	// svgGap is the space between the columns of an SVG diagram
+	svgGap = 12
+)
+
+// svgWidth returns the width of a symbol in an SVG diagram
+func (s symbol) svgWidth() int {
+	switch s.kind {
+	case symbolBox:
+		if w := 8*utf8.RuneCountInString(s.label) + 16; w > 32 {
+			return w
+		}
+		return 32
+	case symbolMeasure:
+		if w := 6*utf8.RuneCountInString(s.label) + 8; w > 36 {
+			return w
+		}
+		return 36
+	}
+	return 24
+}
+
+// gates checks that the gates of the circuit are well formed
+func (c *Circuit) gates() error {
+	for i := range c.Gates {
+		if err := c.Gates[i].validate(); err != nil {
+			return fmt.Errorf("gate %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// WriteSVG writes a standalone SVG drawing of the circuit
+func (c *Circuit) WriteSVG(w io.Writer) error {
+	if err := c.gates(); err != nil {
+		return err
+	}
+	columns := c.layout()
+	widths, total := make([]int, len(columns)), svgMargin+svgName
+	for i, column := range columns {
+		widths[i] = 24
+		for _, e := range column {
+			for _, s := range e.symbols {
+				if width := s.svgWidth(); width > widths[i] {
+					widths[i] = width
+				}
+			}
+		}
+		total += widths[i] + svgGap
+	}
+	total += svgMargin
+	wires := c.wires()
+	height := 2*svgMargin + wires*svgRow
+	y := func(qubit Qubit) int {
+		return svgMargin + int(qubit)*svgRow + svgRow/2
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		total, height, total, height)
+	fmt.Fprintf(out, "<rect width=\"%d\" height=\"%d\" fill=\"white\"/>\n", total, height)
+	out.WriteString("<g font-family=\"monospace\" font-size=\"13\" text-anchor=\"middle\" dominant-baseline=\"central\">\n")
+	for i := 0; i < wires; i++ {
+		fmt.Fprintf(out, "<text x=\"%d\" y=\"%d\">q%d</text>\n", svgMargin+svgName/2, y(Qubit(i)), i)
+		fmt.Fprintf(out, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\"/>\n",
+			svgMargin+svgName, y(Qubit(i)), total-svgMargin, y(Qubit(i)))
+	}
+	x := svgMargin + svgName + svgGap/2
+	for i, column := range columns {
+		cx := x + widths[i]/2
+		for _, e := range column {
+			if e.gate.GateType == GateTypeBarrier {
+				fmt.Fprintf(out, "<rect x=\"%d\" y=\"%d\" width=\"12\" height=\"%d\" fill=\"lightgray\" opacity=\"0.5\"/>\n",
+					cx-6, y(e.top)-svgRow/2+4, int(e.bottom-e.top+1)*svgRow-8)
+				fmt.Fprintf(out, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\" stroke-dasharray=\"4,3\"/>\n",
+					cx, y(e.top)-svgRow/2+4, cx, y(e.bottom)+svgRow/2-4)
+				continue
+			}
+			if e.top < e.bottom {
+				fmt.Fprintf(out, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"black\"/>\n",
+					cx, y(e.top), cx, y(e.bottom))
+			}
+			for qubit, s := range e.symbols {
+				cy := y(qubit)
+				switch s.kind {
+				case symbolControl:
+					fmt.Fprintf(out, "<circle cx=\"%d\" cy=\"%d\" r=\"5\" fill=\"black\"/>\n", cx, cy)
+				case symbolTarget:
+					fmt.Fprintf(out, "<circle cx=\"%d\" cy=\"%d\" r=\"10\" fill=\"white\" stroke=\"black\"/>\n", cx, cy)
+					fmt.Fprintf(out, "<path d=\"M%d %dh20M%d %dv20\" stroke=\"black\"/>\n", cx-10, cy, cx, cy-10)
+				case symbolSwap:
+					fmt.Fprintf(out, "<path d=\"M%d %dl12 12M%d %dl-12 12\" stroke=\"black\" stroke-width=\"2\"/>\n",
+						cx-6, cy-6, cx+6, cy-6)
+				case symbolMeasure:
+					width := s.svgWidth()
+					fmt.Fprintf(out, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"30\" fill=\"white\" stroke=\"black\"/>\n",
+						cx-width/2, cy-15, width)
+					fmt.Fprintf(out, "<path d=\"M%d %da10 10 0 0 1 20 0M%d %dl7 -12\" fill=\"none\" stroke=\"black\"/>\n",
+						cx-10, cy+2, cx, cy+2)
+					fmt.Fprintf(out, "<text x=\"%d\" y=\"%d\" font-size=\"9\">%s</text>\n",
+						cx, cy+9, html.EscapeString(s.label))
+				default:
+					width := s.svgWidth()
+					fmt.Fprintf(out, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"30\" fill=\"white\" stroke=\"black\"/>\n",
+						cx-width/2, cy-15, width)
+					fmt.Fprintf(out, "<text x=\"%d\" y=\"%d\">%s</text>\n", cx, cy, html.EscapeString(s.label))
+				}
+			}
+		}
+		x += widths[i] + svgGap
+	}
+	out.WriteString("</g>\n</svg>\n")
+	return out.Flush()
+}
+
+// WriteSVG writes a standalone SVG drawing of the gates of the genome
+func (g *Genome) WriteSVG(w io.Writer) error {
+	return g.Circuit().WriteSVG(w)
+}
+
+// latexLabels are the LaTeX names of the gate types
+var latexLabels = map[GateType]string{
+	GateTypeI:        "I",
+	GateTypeH:        "H",
+	GateTypeX:        "X",
+	GateTypeY:        "Y",
+	GateTypeZ:        "Z",
+	GateTypeS:        "S",
+	GateTypeT:        "T",
+	GateTypeU:        "U",
+	GateTypeRX:       "R_X",
+	GateTypeRY:       "R_Y",
+	GateTypeRZ:       "R_Z",
+	GateTypeSX:       `\sqrt{X}`,
+	GateTypeSXdg:     `\sqrt{X}^\dagger`,
+	GateTypeSdg:      `S^\dagger`,
+	GateTypeTdg:      `T^\dagger`,
+	GateTypeP:        "P",
+	GateTypeU1:       "U_1",
+	GateTypeU2:       "U_2",
+	GateTypeU3:       "U_3",
+	GateTypeISwap:    `i\mathrm{SWAP}`,
+	GateTypeSqrtSwap: `\sqrt{\mathrm{SWAP}}`,
+	GateTypeRXX:      "R_{XX}",
+	GateTypeRYY:      "R_{YY}",
+	GateTypeRZZ:      "R_{ZZ}",
+	GateTypeCH:       "H",
+	GateTypeCU:       "U",
+	GateTypeCRX:      "R_X",
+	GateTypeCRY:      "R_Y",
+	GateTypeCRZ:      "R_Z",
+	GateTypeCPhase:   "P",
+}
+
+// latexAngle formats an angle in LaTeX, multiples of pi as fractions
+func latexAngle(theta float64) string {
+	text := angle(theta, 4)
+	i := strings.Index(text, "pi")
+	if i < 0 {
+		return text
+	}
+	sign, numerator, denominator := "", text[:i], ""
+	if strings.HasPrefix(numerator, "-") {
+		sign, numerator = "-", numerator[1:]
+	}
+	numerator = strings.TrimSuffix(numerator, "*") + `\pi`
+	if j := strings.Index(text, "/"); j >= 0 {
+		denominator = text[j+1:]
+	}
+	if denominator == "" {
+		return sign + numerator
+	}
+	return fmt.Sprintf(`%s\frac{%s}{%s}`, sign, numerator, denominator)
+}
+
+// latexLabel returns the LaTeX name of a gate with its formatted angles
+func (g *Gate) latexLabel() string {
+	label := latexLabels[g.GateType]
+	if parameters := g.parameters(); len(parameters) > 0 {
+		formatted := make([]string, len(parameters))
+		for i, parameter := range parameters {
+			formatted[i] = latexAngle(parameter)
+		}
+		label += `\left(` + strings.Join(formatted, ", ") + `\right)`
+	}
+	return label
+}
+
+// latexBit formats the name of a classical bit in LaTeX
+func latexBit(name string) string {
+	i := strings.Index(name, "[")
+	if i < 0 {
+		return name
+	}
+	return fmt.Sprintf(`\mathrm{%s}_{%s}`, name[:i], strings.TrimSuffix(name[i+1:], "]"))
+}
+
+// WriteQuantikz writes a LaTeX quantikz drawing of the circuit
+func (c *Circuit) WriteQuantikz(w io.Writer) error {
+	if err := c.gates(); err != nil {
+		return err
+	}
+	columns := c.layout()
+	grid := make([][]string, c.wires())
+	for i := range grid {
+		grid[i] = make([]string, len(columns))
+		for j := range grid[i] {
+			grid[i][j] = `\qw`
+		}
+	}
+	for j, column := range columns {
+		for _, e := range column {
+			g := &e.gate
+			switch g.GateType {
+			case GateTypeBarrier:
+				grid[e.top][j] = `\qw\slice{}`
+				continue
+			case GateTypeSwap:
+				grid[g.Qubits[0]][j] = fmt.Sprintf(`\swap{%d}`, int(g.Qubits[1])-int(g.Qubits[0]))
+				grid[g.Qubits[1]][j] = `\targX{}`
+				continue
+			case GateTypeCSwap:
+				grid[g.Qubits[0]][j] = fmt.Sprintf(`\ctrl{%d}`, int(g.Qubits[1])-int(g.Qubits[0]))
+				grid[g.Qubits[1]][j] = fmt.Sprintf(`\swap{%d}`, int(g.Qubits[2])-int(g.Qubits[1]))
+				grid[g.Qubits[2]][j] = `\targX{}`
+				continue
+			case GateTypeISwap, GateTypeSqrtSwap, GateTypeRXX, GateTypeRYY, GateTypeRZZ, GateTypeECR:
+				labels := []string{g.latexLabel(), g.latexLabel()}
+				if g.GateType == GateTypeECR {
+					labels = []string{`\mathrm{ECR}_0`, `\mathrm{ECR}_1`}
+				}
+				grid[g.Qubits[0]][j] = fmt.Sprintf(`\gate{%s}\vqw{%d}`, labels[0], int(g.Qubits[1])-int(g.Qubits[0]))
+				grid[g.Qubits[1]][j] = fmt.Sprintf(`\gate{%s}`, labels[1])
+				continue
+			case GateTypeMeasure:
+				grid[g.Qubits[0]][j] = fmt.Sprintf(`\meter{%s}`, latexBit(c.bit(g.Bits[0])))
+				continue
+			}
+			if !g.Controlled() {
+				grid[g.Qubits[0]][j] = fmt.Sprintf(`\gate{%s}`, g.latexLabel())
+				continue
+			}
+			for _, control := range g.Qubits {
+				grid[control][j] = fmt.Sprintf(`\ctrl{%d}`, int(g.Target)-int(control))
+			}
+			switch g.GateType {
+			case GateTypeControlledNot:
+				grid[g.Target][j] = `\targ{}`
+			case GateTypeCZ:
+				grid[g.Target][j] = `\control{}`
+			default:
+				grid[g.Target][j] = fmt.Sprintf(`\gate{%s}`, g.latexLabel())
+			}
+		}
+	}
+
+	out := bufio.NewWriter(w)
+	out.WriteString("\\begin{quantikz}\n")
+	for i, row := range grid {
+		fmt.Fprintf(out, `\lstick{$q_{%d}$} & `, i)
+		for _, cell := range row {
+			out.WriteString(cell)
+			out.WriteString(" & ")
+		}
+		out.WriteString(`\qw`)
+		if i < len(grid)-1 {
+			out.WriteString(` \\`)
+		}
+		out.WriteString("\n")
+	}
+	out.WriteString("\\end{quantikz}\n")
+	return out.Flush()
+}
+
+// WriteQuantikz writes a LaTeX quantikz drawing of the gates of the genome
+func (g *Genome) WriteQuantikz(w io.Writer) error {
+	return g.Circuit().WriteQuantikz(w)
+}
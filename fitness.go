@@ -0,0 +1,133 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// FitnessFunction scores the final states of a genome, one state for each of
+// the training pairs of the genome. Lower is better.
+type FitnessFunction func(g *Genome, states []Vector128) float64
+
+var (
+	_ FitnessFunction = BitError
+	_ FitnessFunction = ExpectedBitError
+	_ FitnessFunction = CrossEntropy
+	_ FitnessFunction = StateFidelity(nil)
+)
+
+// pairs checks that the inputs and target outputs of the training pairs fit in
+// width qubits
+func pairs(probabilities [][2][]float64, width int) error {
+	for i, probability := range probabilities {
+		if len(probability[0]) > width || len(probability[1]) > width {
+			return fmt.Errorf("training pair %d has %d inputs and %d outputs, more than %d qubits",
+				i, len(probability[0]), len(probability[1]), width)
+		}
+	}
+	return nil
+}
+
+// marginals returns the probability of each of the first width qubits being
+// one
+func marginals(state Vector128, width int) []float64 {
+	marginals := make([]float64, width)
+	for s, amplitude := range state {
+		p := real(amplitude)*real(amplitude) + imag(amplitude)*imag(amplitude)
+		if p == 0 {
+			continue
+		}
+		for i := range marginals {
+			if (s>>(width-1-i))&1 == 1 {
+				marginals[i] += p
+			}
+		}
+	}
+	return marginals
+}
+
+// BitError is the squared error between the target bits and the bits of the
+// most probable basis state
+func BitError(g *Genome, states []Vector128) float64 {
+	fitness := 0.0
+	for j, probability := range g.Probabilities {
+		max, state, vector := 0.0, 0, states[j]
+		for i := 0; i < len(vector); i++ {
+			abs := cmplx.Abs(vector[i])
+			if abs > max {
+				max, state = abs, i
+			}
+		}
+		for i := 0; i < len(probability[1]); i++ {
+			x := probability[1][i] - float64((state>>(g.Width-1-i))&1)
+			fitness += x * x
+		}
+	}
+	return fitness
+}
+
+// ExpectedBitError is the expected squared error between the target bits and
+// the measured bits
+func ExpectedBitError(g *Genome, states []Vector128) float64 {
+	fitness := 0.0
+	for j, probability := range g.Probabilities {
+		for i, p := range marginals(states[j], g.Width)[:len(probability[1])] {
+			t := probability[1][i]
+			fitness += t*t - 2*t*p + p
+		}
+	}
+	return fitness
+}
+
+// CrossEntropy is the binary cross entropy between the target bit
+// probabilities and the probabilities of measuring ones
+func CrossEntropy(g *Genome, states []Vector128) float64 {
+	const epsilon = 1e-12
+	fitness := 0.0
+	for j, probability := range g.Probabilities {
+		for i, p := range marginals(states[j], g.Width)[:len(probability[1])] {
+			p = math.Min(math.Max(p, epsilon), 1-epsilon)
+			t := probability[1][i]
+			fitness -= t*math.Log(p) + (1-t)*math.Log(1-p)
+		}
+	}
+	return fitness
+}
+
+// StateFidelity is one minus the fidelity between the final states and the
+// target states, one target state for each training pair. A final state
+// without a target state has a fidelity of zero.
+func StateFidelity(targets []Vector128) FitnessFunction {
+	return func(g *Genome, states []Vector128) float64 {
+		fitness := 0.0
+		for j, state := range states {
+			if j >= len(targets) {
+				fitness++
+				continue
+			}
+			overlap := complex128(0)
+			for i, amplitude := range targets[j] {
+				if i < len(state) {
+					overlap += cmplx.Conj(amplitude) * state[i]
+				}
+			}
+			abs := cmplx.Abs(overlap)
+			fitness += 1 - abs*abs
+		}
+		return fitness
+	}
+}
+
+// Penalty adds a penalty for each gate and for each layer of the circuit of
+// the genome to a fitness function
+func Penalty(fitness FitnessFunction, gate, depth float64) FitnessFunction {
+	return func(g *Genome, states []Vector128) float64 {
+		circuit := g.Circuit()
+		return fitness(g, states) + gate*float64(circuit.Size()) + depth*float64(circuit.Depth())
+	}
+}
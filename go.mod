@@ -2,4 +2,7 @@ module github.com/pointlander/heisenberg
 
 go 1.16
 
-require github.com/itsubaki/q v0.0.0-20210320125312-2b2a3b6fd5b1 // indirect
+require (
+	github.com/itsubaki/q v0.0.0-20210320125312-2b2a3b6fd5b1 // indirect
+	gopkg.in/yaml.v2 v2.4.0
+)
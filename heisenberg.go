@@ -2,14 +2,19 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// Package heisenberg is a quantum computer simulator.
+//
+// Qubits are numbered in the order they are added to a machine. Qubit 0 is
+// the most significant bit of a basis state index, so for three qubits the
+// index 4 = 0b100 is the state |100> where qubit 0 is one and qubits 1 and 2
+// are zero. Bitstrings, such as the keys returned by Sample and the kets of
+// StateString, list qubit 0 first.
 package heisenberg
 
 import (
+	"errors"
 	"fmt"
 	"math"
-	"math/cmplx"
-	"math/rand"
-	"sort"
 )
 
 // Qubit is a qubit
@@ -43,14 +48,242 @@ const (
 	GateTypeRY
 	// GateTypeRZ rotate Z gate
 	GateTypeRZ
+	// GateTypeSX multiply by square root of X matrix
+	GateTypeSX
+	// GateTypeSXdg multiply by inverse square root of X matrix
+	GateTypeSXdg
+	// GateTypeSdg multiply by inverse phase matrix
+	GateTypeSdg
+	// GateTypeTdg multiply by inverse T matrix
+	GateTypeTdg
+	// GateTypeP multiply by phase matrix with angle Lambda
+	GateTypeP
+	// GateTypeU1 multiply by U1 matrix with angle Lambda
+	GateTypeU1
+	// GateTypeU2 multiply by U2 matrix with angles Phi and Lambda
+	GateTypeU2
+	// GateTypeU3 multiply by U3 matrix
+	GateTypeU3
+	// GateTypeSwap swaps the first and last qubits, working inwards
+	GateTypeSwap
+	// GateTypeISwap iSWAP gate on the two qubits
+	GateTypeISwap
+	// GateTypeSqrtSwap square root of swap gate on the two qubits
+	GateTypeSqrtSwap
+	// GateTypeRXX XX rotation gate on the two qubits
+	GateTypeRXX
+	// GateTypeRYY YY rotation gate on the two qubits
+	GateTypeRYY
+	// GateTypeRZZ ZZ rotation gate on the two qubits
+	GateTypeRZZ
+	// GateTypeECR echoed cross resonance gate on the two qubits
+	GateTypeECR
+	// GateTypeCSwap controlled swap gate with the qubits control, target and target
+	GateTypeCSwap
+	// GateTypeCZ controlled Pauli Z gate
+	GateTypeCZ
+	// GateTypeCH controlled Hadamard gate
+	GateTypeCH
+	// GateTypeCU controlled U gate
+	GateTypeCU
+	// GateTypeCRX controlled rotate X gate
+	GateTypeCRX
+	// GateTypeCRY controlled rotate Y gate
+	GateTypeCRY
+	// GateTypeCRZ controlled rotate Z gate
+	GateTypeCRZ
+	// GateTypeCPhase controlled phase gate with angle Lambda
+	GateTypeCPhase
+	// GateTypeMeasure measures the qubits into the classical bits
+	GateTypeMeasure
+	// GateTypeBarrier is a barrier across the qubits
+	GateTypeBarrier
 )
 
-// Gate is a gate
+// Gate is a gate. Controlled gates use Qubits as the controls and Target as
+// the target, gates on a fixed number of qubits take them from Qubits in
+// order, and single qubit gates are applied to each of the Qubits. A
+// measurement stores the result for each of the Qubits in the classical bit
+// at the same position of Bits.
 type Gate struct {
 	GateType
 	Qubits             []Qubit
 	Target             Qubit
 	Theta, Phi, Lambda float64
+	Bits               []int
+}
+
+// Copy copies a gate
+func (g *Gate) Copy() Gate {
+	cp := *g
+	if g.Qubits != nil {
+		cp.Qubits = make([]Qubit, len(g.Qubits))
+		copy(cp.Qubits, g.Qubits)
+	}
+	if g.Bits != nil {
+		cp.Bits = make([]int, len(g.Bits))
+		copy(cp.Bits, g.Bits)
+	}
+	return cp
+}
+
+// Controlled returns true if the gate has controls and a target
+func (g *Gate) Controlled() bool {
+	switch g.GateType {
+	case GateTypeControlledNot, GateTypeCZ, GateTypeCH, GateTypeCU,
+		GateTypeCRX, GateTypeCRY, GateTypeCRZ, GateTypeCPhase:
+		return true
+	}
+	return false
+}
+
+// Operands returns the qubits the gate acts on
+func (g *Gate) Operands() []Qubit {
+	operands := make([]Qubit, 0, len(g.Qubits)+1)
+	operands = append(operands, g.Qubits...)
+	if g.Controlled() {
+		operands = append(operands, g.Target)
+	}
+	return operands
+}
+
+// validate checks that the gate has the qubits and bits its type requires
+func (g *Gate) validate() error {
+	switch g.GateType {
+	case GateTypeISwap, GateTypeSqrtSwap, GateTypeRXX, GateTypeRYY, GateTypeRZZ, GateTypeECR:
+		if len(g.Qubits) != 2 {
+			return fmt.Errorf("%s requires 2 qubits not %d", g.GateType, len(g.Qubits))
+		}
+	case GateTypeCSwap:
+		if len(g.Qubits) != 3 {
+			return fmt.Errorf("%s requires 3 qubits not %d", g.GateType, len(g.Qubits))
+		}
+	case GateTypeMeasure:
+		if len(g.Bits) != len(g.Qubits) {
+			return fmt.Errorf("%d qubits are measured into %d bits", len(g.Qubits), len(g.Bits))
+		}
+	}
+	if g.Controlled() {
+		for _, control := range g.Qubits {
+			if control == g.Target {
+				return fmt.Errorf("%s target %d is also a control", g.GateType, g.Target)
+			}
+		}
+	}
+	return nil
+}
+
+// Inverse returns the gates that undo the gate
+func (g *Gate) Inverse() ([]Gate, error) {
+	inverse := g.Copy()
+	switch g.GateType {
+	case GateTypeMeasure:
+		return nil, errors.New("a measurement can not be inverted")
+	case GateTypeS:
+		inverse.GateType = GateTypeSdg
+	case GateTypeSdg:
+		inverse.GateType = GateTypeS
+	case GateTypeT:
+		inverse.GateType = GateTypeTdg
+	case GateTypeTdg:
+		inverse.GateType = GateTypeT
+	case GateTypeSX:
+		inverse.GateType = GateTypeSXdg
+	case GateTypeSXdg:
+		inverse.GateType = GateTypeSX
+	case GateTypeU, GateTypeU3, GateTypeCU:
+		inverse.Theta, inverse.Phi, inverse.Lambda = -g.Theta, -g.Lambda, -g.Phi
+	case GateTypeU2:
+		inverse.GateType = GateTypeU
+		inverse.Theta, inverse.Phi, inverse.Lambda = -math.Pi/2, -g.Lambda, -g.Phi
+	case GateTypeRX, GateTypeRY, GateTypeRZ, GateTypeRXX, GateTypeRYY, GateTypeRZZ,
+		GateTypeCRX, GateTypeCRY, GateTypeCRZ:
+		inverse.Theta = -g.Theta
+	case GateTypeP, GateTypeU1, GateTypeCPhase:
+		inverse.Lambda = -g.Lambda
+	case GateTypeISwap:
+		return []Gate{inverse, g.Copy(), g.Copy()}, nil
+	case GateTypeSqrtSwap:
+		return []Gate{inverse, {GateType: GateTypeSwap, Qubits: []Qubit{g.Qubits[0], g.Qubits[1]}}}, nil
+	}
+	return []Gate{inverse}, nil
+}
+
+// Apply applies the gate to a machine, measurements and barriers are left to
+// Circuit.Run
+func (g *Gate) Apply(machine Machine) {
+	switch g.GateType {
+	case GateTypeControlledNot:
+		machine.ControlledNot(g.Qubits, g.Target)
+	case GateTypeI:
+		machine.I(g.Qubits...)
+	case GateTypeH:
+		machine.H(g.Qubits...)
+	case GateTypeX:
+		machine.X(g.Qubits...)
+	case GateTypeY:
+		machine.Y(g.Qubits...)
+	case GateTypeZ:
+		machine.Z(g.Qubits...)
+	case GateTypeS:
+		machine.S(g.Qubits...)
+	case GateTypeT:
+		machine.T(g.Qubits...)
+	case GateTypeU:
+		machine.U(g.Theta, g.Phi, g.Lambda, g.Qubits...)
+	case GateTypeRX:
+		machine.RX(g.Theta, g.Qubits...)
+	case GateTypeRY:
+		machine.RY(g.Theta, g.Qubits...)
+	case GateTypeRZ:
+		machine.RZ(g.Theta, g.Qubits...)
+	case GateTypeSX:
+		machine.SX(g.Qubits...)
+	case GateTypeSXdg:
+		machine.SXdg(g.Qubits...)
+	case GateTypeSdg:
+		machine.Sdg(g.Qubits...)
+	case GateTypeTdg:
+		machine.Tdg(g.Qubits...)
+	case GateTypeP:
+		machine.P(g.Lambda, g.Qubits...)
+	case GateTypeU1:
+		machine.U1(g.Lambda, g.Qubits...)
+	case GateTypeU2:
+		machine.U2(g.Phi, g.Lambda, g.Qubits...)
+	case GateTypeU3:
+		machine.U3(g.Theta, g.Phi, g.Lambda, g.Qubits...)
+	case GateTypeSwap:
+		machine.Swap(g.Qubits...)
+	case GateTypeISwap:
+		machine.ISwap(g.Qubits[0], g.Qubits[1])
+	case GateTypeSqrtSwap:
+		machine.SqrtSwap(g.Qubits[0], g.Qubits[1])
+	case GateTypeRXX:
+		machine.RXX(g.Theta, g.Qubits[0], g.Qubits[1])
+	case GateTypeRYY:
+		machine.RYY(g.Theta, g.Qubits[0], g.Qubits[1])
+	case GateTypeRZZ:
+		machine.RZZ(g.Theta, g.Qubits[0], g.Qubits[1])
+	case GateTypeECR:
+		machine.ECR(g.Qubits[0], g.Qubits[1])
+	case GateTypeCSwap:
+		machine.Fredkin(g.Qubits[0], g.Qubits[1], g.Qubits[2])
+	case GateTypeCZ:
+		machine.CZ(g.Qubits, g.Target)
+	case GateTypeCH:
+		machine.CH(g.Qubits, g.Target)
+	case GateTypeCU:
+		machine.CU(g.Theta, g.Phi, g.Lambda, g.Qubits, g.Target)
+	case GateTypeCRX:
+		machine.CRX(g.Theta, g.Qubits, g.Target)
+	case GateTypeCRY:
+		machine.CRY(g.Theta, g.Qubits, g.Target)
+	case GateTypeCRZ:
+		machine.CRZ(g.Theta, g.Qubits, g.Target)
+	case GateTypeCPhase:
+		machine.CPhase(g.Lambda, g.Qubits, g.Target)
+	}
 }
 
 // Genome is a quantum circuit
@@ -59,6 +292,13 @@ type Genome struct {
 	Fitness       float64
 	Width         int
 	Probabilities [][2][]float64
+	Backend       string
+	// FitnessFunction scores the genome, BitError if nil
+	FitnessFunction FitnessFunction
+
+	// refined is true if the optimizer has refined the angles of the genome,
+	// copies are not refined
+	refined bool
 }
 
 // Copy copies a genome
@@ -66,195 +306,47 @@ func (g *Genome) Copy() Genome {
 	cp := Genome{}
 	cp.Gates = make([]Gate, len(g.Gates))
 	for i := range g.Gates {
-		cp.Gates[i].GateType = g.Gates[i].GateType
-		cp.Gates[i].Qubits = make([]Qubit, len(g.Gates[i].Qubits))
-		copy(cp.Gates[i].Qubits, g.Gates[i].Qubits)
-		cp.Gates[i].Target = g.Gates[i].Target
-		cp.Gates[i].Theta = g.Gates[i].Theta
-		cp.Gates[i].Phi = g.Gates[i].Phi
-		cp.Gates[i].Lambda = g.Gates[i].Lambda
+		cp.Gates[i] = g.Gates[i].Copy()
 	}
 	cp.Width = g.Width
 	cp.Probabilities = g.Probabilities
+	cp.Backend = g.Backend
+	cp.FitnessFunction = g.FitnessFunction
 	return cp
 }
 
-// Execute the gates
-func (g *Genome) Execute() {
-	fitness := 0.0
-	for _, probability := range g.Probabilities {
-		machine, qubits := MachineSparse64{}, []Qubit{}
-		i := 0
-		for i < len(probability[0]) {
-			if probability[0][i] == 0 {
-				qubits = append(qubits, machine.Zero())
-			} else {
-				qubits = append(qubits, machine.One())
-			}
-			i++
-		}
-		for i < g.Width {
-			qubits = append(qubits, machine.Zero())
-			i++
-		}
-		for _, gate := range g.Gates {
-			switch gate.GateType {
-			case GateTypeControlledNot:
-				machine.ControlledNot(gate.Qubits, gate.Target)
-			case GateTypeI:
-				machine.I(gate.Qubits...)
-			case GateTypeH:
-				machine.H(gate.Qubits...)
-			case GateTypeX:
-				machine.X(gate.Qubits...)
-			case GateTypeY:
-				machine.Y(gate.Qubits...)
-			case GateTypeZ:
-				machine.Z(gate.Qubits...)
-			case GateTypeS:
-				machine.S(gate.Qubits...)
-			case GateTypeT:
-				machine.T(gate.Qubits...)
-			case GateTypeU:
-				machine.U(gate.Theta, gate.Phi, gate.Lambda, gate.Qubits...)
-			case GateTypeRX:
-				machine.RX(gate.Theta, gate.Qubits...)
-			case GateTypeRY:
-				machine.RY(gate.Theta, gate.Qubits...)
-			case GateTypeRZ:
-				machine.RZ(gate.Theta, gate.Qubits...)
-			}
-		}
-		max, state := 0.0, 0
-		for i := 0; i < len(machine.Vector64); i++ {
-			abs := cmplx.Abs(complex128(machine.Vector64[i]))
-			if abs > max {
-				max, state = abs, i
-			}
-		}
-		for i := 0; i < len(probability[1]); i++ {
-			x := probability[1][i] - float64((state>>(g.Width-1-i))&1)
-			fitness += x * x
-		}
+// Circuit returns the gates of the genome as a circuit
+func (g *Genome) Circuit() *Circuit {
+	return &Circuit{
+		Width: g.Width,
+		Gates: g.Gates,
 	}
-	g.Fitness = fitness
 }
 
-// Optimize is an implementation of genetic optimize
-func Optimize(width, depth int, probabilities [][2][]float64) {
-	rand.Seed(1)
-
-	qubit := func(qubits []Qubit) Qubit {
-		qubit := Qubit(0)
-		for {
-			qubit = Qubit(rand.Intn(width))
-			contains := false
-			for _, value := range qubits {
-				if value == qubit {
-					contains = true
-				}
-			}
-			if !contains {
-				break
-			}
-		}
-		return qubit
-	}
-
-	qubits := func() []Qubit {
-		qubits := make([]Qubit, 0, 8)
-		q := rand.Intn(3)
-		for k := 0; k < q; k++ {
-			qubits = append(qubits, qubit(qubits))
+// Execute the gates and score the final states with the fitness function
+func (g *Genome) Execute() error {
+	states := make([]Vector128, 0, len(g.Probabilities))
+	for _, probability := range g.Probabilities {
+		machine, err := NewMachine(g.Backend)
+		if err != nil {
+			return err
 		}
-		return qubits
-	}
-
-	gate := func() Gate {
-		gate := Gate{}
-		n := rand.Intn(17)
-		if n < 5 {
-			gate.GateType = GateTypeControlledNot
-			gate.Qubits = qubits()
-			gate.Target = qubit([]Qubit{})
-		} else if n < 7 {
-			gate.GateType = GateTypeI
-			gate.Qubits = qubits()
-		} else if n < 8 {
-			gate.GateType = GateTypeH
-			gate.Qubits = qubits()
-		} else if n < 9 {
-			gate.GateType = GateTypeX
-			gate.Qubits = qubits()
-		} else if n < 10 {
-			gate.GateType = GateTypeY
-			gate.Qubits = qubits()
-		} else if n < 11 {
-			gate.GateType = GateTypeZ
-			gate.Qubits = qubits()
-		} else if n < 12 {
-			gate.GateType = GateTypeS
-			gate.Qubits = qubits()
-		} else if n < 13 {
-			gate.GateType = GateTypeT
-			gate.Qubits = qubits()
-		} else if n < 14 {
-			gate.GateType = GateTypeU
-			gate.Qubits = qubits()
-			gate.Theta = 4 * math.Pi * rand.Float64()
-			gate.Lambda = rand.Float64()
-			gate.Phi = rand.Float64()
-		} else if n < 15 {
-			gate.GateType = GateTypeRX
-			gate.Qubits = qubits()
-			gate.Theta = 4 * math.Pi * rand.Float64()
-		} else if n < 16 {
-			gate.GateType = GateTypeRY
-			gate.Qubits = qubits()
-			gate.Theta = 4 * math.Pi * rand.Float64()
-		} else if n < 17 {
-			gate.GateType = GateTypeRZ
-			gate.Qubits = qubits()
-			gate.Theta = 4 * math.Pi * rand.Float64()
+		for _, value := range probability[0] {
+			if value == 0 {
+				machine.Zero()
+			} else {
+				machine.One()
+			}
 		}
-		return gate
-	}
-
-	genomes := make([]Genome, 100)
-	for i := 0; i < 100; i++ {
-		gates := make([]Gate, 0, depth)
-		for j := 0; j < depth; j++ {
-			gates = append(gates, gate())
+		if _, err := g.Circuit().Run(machine, nil); err != nil {
+			return err
 		}
-		genomes[i].Gates = gates
-		genomes[i].Width = width
-		genomes[i].Probabilities = probabilities
+		states = append(states, machine.State())
 	}
-
-	for g := 0; g < 100; g++ {
-		for i := range genomes {
-			genomes[i].Execute()
-		}
-		sort.Slice(genomes, func(i, j int) bool {
-			return genomes[i].Fitness < genomes[j].Fitness
-		})
-		genomes = genomes[:100]
-		fmt.Println(genomes[0].Fitness)
-		if genomes[0].Fitness == 0 {
-			break
-		}
-		for i := 0; i < 10; i++ {
-			m1, m2 := rand.Intn(10), rand.Intn(10)
-			c1, c2 := genomes[m1].Copy(), genomes[m2].Copy()
-			g1, g2 := rand.Intn(depth), rand.Intn(depth)
-			c1.Gates[g1], c2.Gates[g2] = c2.Gates[g2], c1.Gates[g1]
-			genomes = append(genomes, c1, c2)
-		}
-		for i := range genomes {
-			cp := genomes[i].Copy()
-			g := rand.Intn(depth)
-			cp.Gates[g] = gate()
-			genomes = append(genomes, cp)
-		}
+	fitness := g.FitnessFunction
+	if fitness == nil {
+		fitness = BitError
 	}
+	g.Fitness = fitness(g, states)
+	return nil
 }
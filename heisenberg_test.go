@@ -5,8 +5,20 @@
 package heisenberg
 
 import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
 	"math"
+	"math/cmplx"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"gopkg.in/yaml.v2"
 )
 
 func round64(a complex64) complex64 {
@@ -223,8 +235,10 @@ func TestControlledNotSparse64(t *testing.T) {
 	machine.One()
 	machine.Zero()
 
-	a := machine.ControlledNot([]Qubit{0}, 2)
-	b := machine.ControlledNot([]Qubit{0, 1}, 2)
+	a := ControlledNotSparse64(machine.Qubits, []Qubit{0}, 2)
+	machine.ControlledNot([]Qubit{0}, 2)
+	b := ControlledNotSparse64(machine.Qubits, []Qubit{0, 1}, 2)
+	machine.ControlledNot([]Qubit{0, 1}, 2)
 	c := b.Multiply(a)
 	d := c.Copy()
 	d.Transpose()
@@ -256,8 +270,10 @@ func TestControlledNotSparse128(t *testing.T) {
 	machine.One()
 	machine.Zero()
 
-	a := machine.ControlledNot([]Qubit{0}, 2)
-	b := machine.ControlledNot([]Qubit{0, 1}, 2)
+	a := ControlledNotSparse128(machine.Qubits, []Qubit{0}, 2)
+	machine.ControlledNot([]Qubit{0}, 2)
+	b := ControlledNotSparse128(machine.Qubits, []Qubit{0, 1}, 2)
+	machine.ControlledNot([]Qubit{0, 1}, 2)
 	c := b.Multiply(a)
 	d := c.Copy()
 	d.Transpose()
@@ -289,8 +305,10 @@ func TestControlledNotDense64(t *testing.T) {
 	machine.One()
 	machine.Zero()
 
-	a := machine.ControlledNot([]Qubit{0}, 2)
-	b := machine.ControlledNot([]Qubit{0, 1}, 2)
+	a := ControlledNotDense64(machine.Qubits, []Qubit{0}, 2)
+	machine.ControlledNot([]Qubit{0}, 2)
+	b := ControlledNotDense64(machine.Qubits, []Qubit{0, 1}, 2)
+	machine.ControlledNot([]Qubit{0, 1}, 2)
 	c := b.Multiply(a)
 	d := c.Copy()
 	d.Transpose()
@@ -320,8 +338,10 @@ func TestControlledNotDense128(t *testing.T) {
 	machine.One()
 	machine.Zero()
 
-	a := machine.ControlledNot([]Qubit{0}, 2)
-	b := machine.ControlledNot([]Qubit{0, 1}, 2)
+	a := ControlledNotDense128(machine.Qubits, []Qubit{0}, 2)
+	machine.ControlledNot([]Qubit{0}, 2)
+	b := ControlledNotDense128(machine.Qubits, []Qubit{0, 1}, 2)
+	machine.ControlledNot([]Qubit{0, 1}, 2)
 	c := b.Multiply(a)
 	d := c.Copy()
 	d.Transpose()
@@ -504,3 +524,1766 @@ func TestSwapSparse128(t *testing.T) {
 		}
 	}
 }
+
+func TestBackends(t *testing.T) {
+	reference, err := NewMachine("sparse128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	circuit := func(machine Machine) Vector128 {
+		q0, q1, q2 := machine.Zero(), machine.One(), machine.Zero()
+		machine.H(q0).RY(math.Pi/3, q1).ControlledNot([]Qubit{q0}, q2)
+		machine.Swap(q1, q2)
+		return machine.State()
+	}
+	expect := circuit(reference)
+	for _, backend := range Backends() {
+		machine, err := NewMachine(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := circuit(machine)
+		if len(state) != len(expect) {
+			t.Fatalf("%s: state has length %d", backend, len(state))
+		}
+		for i := range expect {
+			if cmplx.Abs(state[i]-expect[i]) > 1e-6 {
+				t.Fatalf("%s: %d %f != %f", backend, i, state[i], expect[i])
+			}
+		}
+	}
+	if _, err := NewMachine("abacus"); err == nil {
+		t.Fatal("unknown backend should be an error")
+	}
+
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			Register("vector128", func() Machine {
+				return &MachineVector128{}
+			})
+		}
+		done <- true
+	}()
+	for i := 0; i < 100; i++ {
+		if _, err := NewMachine("vector128"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
+
+func TestGenomeBackends(t *testing.T) {
+	genome := Genome{
+		Gates: []Gate{
+			{GateType: GateTypeX, Qubits: []Qubit{0, 1}},
+			{GateType: GateTypeControlledNot, Qubits: []Qubit{1}, Target: 2},
+		},
+		Width: 3,
+		Probabilities: [][2][]float64{
+			{{0, 1}, {1, 0, 0}},
+			{{1, 0}, {0, 1, 1}},
+		},
+	}
+	for _, backend := range Backends() {
+		cp := genome.Copy()
+		cp.Backend = backend
+		if err := cp.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if cp.Fitness != 0 {
+			t.Fatalf("%s: fitness %f should be zero", backend, cp.Fitness)
+		}
+	}
+}
+
+func BenchmarkVector64(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		machine := MachineVector64{}
+		for i := 0; i < 4; i++ {
+			machine.One()
+			machine.Zero()
+		}
+		machine.ControlledNot([]Qubit{0}, 1)
+		machine.ControlledNot([]Qubit{0, 1}, 2)
+	}
+}
+
+func BenchmarkVector128(b *testing.B) {
+	for n := 0; n < b.N; n++ {
+		machine := MachineVector128{}
+		for i := 0; i < 4; i++ {
+			machine.One()
+			machine.Zero()
+		}
+		machine.ControlledNot([]Qubit{0}, 1)
+		machine.ControlledNot([]Qubit{0, 1}, 2)
+	}
+}
+
+func TestVector64(t *testing.T) {
+	machine := MachineVector64{}
+	qubits := make([]Qubit, 0, 20)
+	for i := 0; i < 20; i++ {
+		qubits = append(qubits, machine.Zero())
+	}
+	machine.H(qubits[0])
+	for _, qubit := range qubits[1:] {
+		machine.ControlledNot([]Qubit{qubits[0]}, qubit)
+	}
+	last := len(machine.Vector64) - 1
+	for i, value := range machine.Vector64 {
+		if i == 0 || i == last {
+			if math.Abs(float64(real(value))-1/math.Sqrt2) > 1e-6 {
+				t.Fatalf("%d %f should be %f", i, value, 1/math.Sqrt2)
+			}
+		} else if value != 0 {
+			t.Fatalf("%d %f should be zero", i, value)
+		}
+	}
+}
+
+func TestVector128(t *testing.T) {
+	machine := MachineVector128{}
+	qubits := make([]Qubit, 0, 20)
+	for i := 0; i < 20; i++ {
+		qubits = append(qubits, machine.Zero())
+	}
+	machine.H(qubits[0])
+	for _, qubit := range qubits[1:] {
+		machine.ControlledNot([]Qubit{qubits[0]}, qubit)
+	}
+	last := len(machine.Vector128) - 1
+	for i, value := range machine.Vector128 {
+		if i == 0 || i == last {
+			if math.Abs(real(value)-1/math.Sqrt2) > 1e-12 {
+				t.Fatalf("%d %f should be %f", i, value, 1/math.Sqrt2)
+			}
+		} else if value != 0 {
+			t.Fatalf("%d %f should be zero", i, value)
+		}
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, backend := range Backends() {
+		ones := 0
+		for i := 0; i < 256; i++ {
+			machine, err := NewMachine(backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q0, q1 := machine.Zero(), machine.Zero()
+			machine.One()
+			machine.H(q0).ControlledNot([]Qubit{q0}, q1)
+			results := machine.Measure(rng, q0)
+			state := machine.State()
+			if results[0] {
+				ones++
+				if cmplx.Abs(state[7]-1) > 1e-6 {
+					t.Fatalf("%s: state %v should collapse to |111>", backend, state)
+				}
+			} else if cmplx.Abs(state[1]-1) > 1e-6 {
+				t.Fatalf("%s: state %v should collapse to |001>", backend, state)
+			}
+			all := machine.MeasureAll(rng)
+			if len(all) != 3 || all[0] != results[0] || all[1] != results[0] || !all[2] {
+				t.Fatalf("%s: measurement %v is inconsistent with %v", backend, all, results)
+			}
+		}
+		if ones < 96 || ones > 160 {
+			t.Fatalf("%s: %d ones out of 256 is not uniform", backend, ones)
+		}
+	}
+
+	zero64, zero128 := make(Vector64, 4), make(Vector128, 4)
+	if results := zero64.Measure(rng, 0, 1); results[0] || results[1] || zero64[0] != 0 {
+		t.Fatalf("a zero state should measure as zero %v %v", results, zero64)
+	}
+	if results := zero128.Measure(rng, 0, 1); results[0] || results[1] || zero128[0] != 0 {
+		t.Fatalf("a zero state should measure as zero %v %v", results, zero128)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("measuring a qubit not in the state should panic")
+		}
+	}()
+	zero128.Measure(rng, 2)
+}
+
+func TestSample(t *testing.T) {
+	for _, backend := range Backends() {
+		rng := rand.New(rand.NewSource(1))
+		machine, err := NewMachine(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q0, q1, q2 := machine.Zero(), machine.Zero(), machine.Zero()
+		machine.H(q0).ControlledNot([]Qubit{q0}, q1).X(q2)
+		counts := machine.Sample(1024, rng)
+		if len(counts) != 2 || counts["001"]+counts["111"] != 1024 {
+			t.Fatalf("%s: bad counts %v", backend, counts)
+		}
+		if counts["001"] < 448 || counts["001"] > 576 {
+			t.Fatalf("%s: %d |001> out of 1024 is not uniform", backend, counts["001"])
+		}
+		marginal := Marginal(counts, q2, q0)
+		if len(marginal) != 2 || marginal["10"] != counts["001"] || marginal["11"] != counts["111"] {
+			t.Fatalf("%s: bad marginal counts %v", backend, marginal)
+		}
+		if state := machine.State(); cmplx.Abs(state[1]-1/math.Sqrt2) > 1e-6 {
+			t.Fatalf("%s: sampling should not collapse the state %v", backend, state)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	for _, backend := range Backends() {
+		machine, err := NewMachine(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q0, q1, q2 := machine.Zero(), machine.Zero(), machine.Zero()
+		machine.X(q0)
+		if p := machine.Probabilities(); p[4] != 1 {
+			t.Fatalf("%s: qubit 0 should be the most significant bit %v", backend, p)
+		}
+		if a := machine.Amplitude("100"); a != 1 {
+			t.Fatalf("%s: amplitude of |100> is %f", backend, a)
+		}
+		if s := machine.StateString(); s != "1.000|100>" {
+			t.Fatalf("%s: bad state string %s", backend, s)
+		}
+		machine.X(q0).H(q1).ControlledNot([]Qubit{q1}, q2).Z(q2)
+		if s := machine.StateString(); s != "0.707|000> - 0.707|011>" {
+			t.Fatalf("%s: bad state string %s", backend, s)
+		}
+		if n := machine.Norm(); math.Abs(n-1) > 1e-6 {
+			t.Fatalf("%s: norm %f should be one", backend, n)
+		}
+		machine.S(q1)
+		if s := machine.StateString(); s != "0.707|000> - 0.707i|011>" {
+			t.Fatalf("%s: bad state string %s", backend, s)
+		}
+	}
+}
+
+func TestControlled(t *testing.T) {
+	for _, backend := range Backends() {
+		machine, err := NewMachine(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q0, q1, q2 := machine.One(), machine.One(), machine.Zero()
+		machine.Controlled(XSparse128(), []Qubit{q0, q1}, q2)
+		if a := machine.Amplitude("111"); cmplx.Abs(a-1) > 1e-6 {
+			t.Fatalf("%s: controlled X should flip the target %s", backend, machine.StateString())
+		}
+		machine.CZ([]Qubit{q0, q1}, q2)
+		if a := machine.Amplitude("111"); cmplx.Abs(a+1) > 1e-6 {
+			t.Fatalf("%s: controlled Z should flip the phase %s", backend, machine.StateString())
+		}
+		machine.CPhase(math.Pi/2, []Qubit{q0}, q1)
+		if a := machine.Amplitude("111"); cmplx.Abs(a+1i) > 1e-6 {
+			t.Fatalf("%s: controlled phase should rotate the phase %s", backend, machine.StateString())
+		}
+		machine.Toffoli(q0, q1, q2)
+		machine.Fredkin(q0, q1, q2)
+		if a := machine.Amplitude("101"); cmplx.Abs(a+1i) > 1e-6 {
+			t.Fatalf("%s: Fredkin should swap the targets %s", backend, machine.StateString())
+		}
+		machine.X(q0).CH([]Qubit{q0}, q1).CRX(math.Pi, []Qubit{q0}, q1)
+		if a := machine.Amplitude("001"); cmplx.Abs(a+1i) > 1e-6 {
+			t.Fatalf("%s: controlled gates should not apply %s", backend, machine.StateString())
+		}
+		machine.X(q0).CRY(math.Pi, []Qubit{q0}, q1).CRZ(math.Pi, []Qubit{q0}, q2)
+		if a := machine.Amplitude("111"); cmplx.Abs(a-1) > 1e-6 {
+			t.Fatalf("%s: controlled rotations should apply %s", backend, machine.StateString())
+		}
+		machine.CU(math.Pi, 0, math.Pi, []Qubit{q0}, q1)
+		if a := machine.Amplitude("101"); cmplx.Abs(a-1) > 1e-6 {
+			t.Fatalf("%s: controlled U should apply %s", backend, machine.StateString())
+		}
+		if n := machine.Norm(); math.Abs(n-1) > 1e-6 {
+			t.Fatalf("%s: norm %f should be one", backend, n)
+		}
+	}
+}
+
+func TestApplyUnitary(t *testing.T) {
+	iswap := &Dense128{
+		R: 4,
+		C: 4,
+		Matrix: []complex128{
+			1, 0, 0, 0,
+			0, 0, 1i, 0,
+			0, 1i, 0, 0,
+			0, 0, 0, 1,
+		},
+	}
+	cnot := &Sparse64{
+		R: 4,
+		C: 4,
+		Matrix: []map[int]complex64{
+			{0: 1},
+			{1: 1},
+			{3: 1},
+			{2: 1},
+		},
+	}
+	for _, backend := range Backends() {
+		machine, err := NewMachine(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q0, q1, q2 := machine.One(), machine.Zero(), machine.Zero()
+		if err := machine.ApplyUnitary(iswap, q2, q0); err != nil {
+			t.Fatal(err)
+		}
+		if a := machine.Amplitude("001"); cmplx.Abs(a-1i) > 1e-6 {
+			t.Fatalf("%s: iSWAP should swap non adjacent qubits %s", backend, machine.StateString())
+		}
+		if err := machine.ApplyUnitary(cnot, q2, q1); err != nil {
+			t.Fatal(err)
+		}
+		if a := machine.Amplitude("011"); cmplx.Abs(a-1i) > 1e-6 {
+			t.Fatalf("%s: the first qubit should be the control %s", backend, machine.StateString())
+		}
+		if err := machine.ApplyUnitary(&Dense128{R: 2, C: 2, Matrix: []complex128{1, 1, 0, 1}}, q0); err != ErrNotUnitary {
+			t.Fatalf("%s: expected ErrNotUnitary got %v", backend, err)
+		}
+		if err := machine.ApplyUnitary(iswap, q0); err == nil {
+			t.Fatalf("%s: dimensions should not match", backend)
+		}
+		if err := machine.ApplyUnitary(iswap, q0, q0); err == nil {
+			t.Fatalf("%s: qubits should be distinct", backend)
+		}
+		if err := machine.ApplyUnitary(iswap, q0, 3); err == nil {
+			t.Fatalf("%s: qubit should not exist", backend)
+		}
+		state := machine.H(q0).RY(.3, q1).State()
+		machine.ISwap(q0, q0).SqrtSwap(q1, q1).RXX(.5, q0, 3).RYY(.5, 3, q1).RZZ(.5, q2, q2).ECR(q0, 4)
+		for i, a := range machine.State() {
+			if cmplx.Abs(a-state[i]) > 1e-6 {
+				t.Fatalf("%s: invalid two qubit gates should not change the state", backend)
+			}
+		}
+	}
+}
+
+func TestControlledTarget(t *testing.T) {
+	gates := map[string]func(machine Machine, c []Qubit, t Qubit){
+		"cnot": func(machine Machine, c []Qubit, t Qubit) {
+			machine.ControlledNot(c, t)
+		},
+		"cz": func(machine Machine, c []Qubit, t Qubit) {
+			machine.CZ(c, t)
+		},
+		"crx": func(machine Machine, c []Qubit, t Qubit) {
+			machine.CRX(.5, c, t)
+		},
+	}
+	for _, backend := range Backends() {
+		for name, gate := range gates {
+			machine, err := NewMachine(backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q0, q1 := machine.One(), machine.Zero()
+			machine.H(q1).RY(.3, q0)
+			state := machine.State()
+			gate(machine, []Qubit{q0, q1}, q1)
+			for i, a := range machine.State() {
+				if cmplx.Abs(a-state[i]) > 1e-6 {
+					t.Fatalf("%s %s: a target that is a control should not change the state %v %v",
+						backend, name, state, machine.State())
+				}
+			}
+		}
+	}
+}
+
+func TestGates(t *testing.T) {
+	prepare := func(machine Machine) (Qubit, Qubit, Qubit) {
+		q0, q1, q2 := machine.Zero(), machine.One(), machine.Zero()
+		machine.H(q0).RY(.3, q1).RX(1.1, q2)
+		return q0, q1, q2
+	}
+	equivalent := []struct {
+		name string
+		a, b []Gate
+	}{
+		{"SX SX = X",
+			[]Gate{{GateType: GateTypeSX, Qubits: []Qubit{1}}, {GateType: GateTypeSX, Qubits: []Qubit{1}}},
+			[]Gate{{GateType: GateTypeX, Qubits: []Qubit{1}}}},
+		{"SXdg SX = I",
+			[]Gate{{GateType: GateTypeSX, Qubits: []Qubit{2}}, {GateType: GateTypeSXdg, Qubits: []Qubit{2}}},
+			[]Gate{}},
+		{"Sdg S = I",
+			[]Gate{{GateType: GateTypeS, Qubits: []Qubit{0}}, {GateType: GateTypeSdg, Qubits: []Qubit{0}}},
+			[]Gate{}},
+		{"Tdg T = I",
+			[]Gate{{GateType: GateTypeT, Qubits: []Qubit{0}}, {GateType: GateTypeTdg, Qubits: []Qubit{0}}},
+			[]Gate{}},
+		{"P(pi/4) = T",
+			[]Gate{{GateType: GateTypeP, Qubits: []Qubit{0, 2}, Lambda: math.Pi / 4}},
+			[]Gate{{GateType: GateTypeT, Qubits: []Qubit{0, 2}}}},
+		{"U1 = P",
+			[]Gate{{GateType: GateTypeU1, Qubits: []Qubit{1}, Lambda: .7}},
+			[]Gate{{GateType: GateTypeP, Qubits: []Qubit{1}, Lambda: .7}}},
+		{"U2 = U(pi/2)",
+			[]Gate{{GateType: GateTypeU2, Qubits: []Qubit{2}, Phi: .2, Lambda: .9}},
+			[]Gate{{GateType: GateTypeU, Qubits: []Qubit{2}, Theta: math.Pi / 2, Phi: .2, Lambda: .9}}},
+		{"U3 = U",
+			[]Gate{{GateType: GateTypeU3, Qubits: []Qubit{0}, Theta: .4, Phi: .2, Lambda: .9}},
+			[]Gate{{GateType: GateTypeU, Qubits: []Qubit{0}, Theta: .4, Phi: .2, Lambda: .9}}},
+		{"SqrtSwap SqrtSwap = Swap",
+			[]Gate{{GateType: GateTypeSqrtSwap, Qubits: []Qubit{0, 2}}, {GateType: GateTypeSqrtSwap, Qubits: []Qubit{0, 2}}},
+			[]Gate{{GateType: GateTypeSwap, Qubits: []Qubit{0, 2}}}},
+		{"RZZ = CNOT RZ CNOT",
+			[]Gate{{GateType: GateTypeRZZ, Qubits: []Qubit{2, 1}, Theta: .8}},
+			[]Gate{{GateType: GateTypeControlledNot, Qubits: []Qubit{2}, Target: 1},
+				{GateType: GateTypeRZ, Qubits: []Qubit{1}, Theta: .8},
+				{GateType: GateTypeControlledNot, Qubits: []Qubit{2}, Target: 1}}},
+		{"RXX = H H RZZ H H",
+			[]Gate{{GateType: GateTypeRXX, Qubits: []Qubit{0, 1}, Theta: .8}},
+			[]Gate{{GateType: GateTypeH, Qubits: []Qubit{0, 1}},
+				{GateType: GateTypeRZZ, Qubits: []Qubit{0, 1}, Theta: .8},
+				{GateType: GateTypeH, Qubits: []Qubit{0, 1}}}},
+		{"RYY = RX RZZ RX",
+			[]Gate{{GateType: GateTypeRYY, Qubits: []Qubit{0, 1}, Theta: .8}},
+			[]Gate{{GateType: GateTypeRX, Qubits: []Qubit{0, 1}, Theta: math.Pi / 2},
+				{GateType: GateTypeRZZ, Qubits: []Qubit{0, 1}, Theta: .8},
+				{GateType: GateTypeRX, Qubits: []Qubit{0, 1}, Theta: -math.Pi / 2}}},
+		{"ECR ECR = I",
+			[]Gate{{GateType: GateTypeECR, Qubits: []Qubit{1, 0}}, {GateType: GateTypeECR, Qubits: []Qubit{1, 0}}},
+			[]Gate{}},
+		{"ISwap = Swap S S CZ",
+			[]Gate{{GateType: GateTypeISwap, Qubits: []Qubit{0, 1}}},
+			[]Gate{{GateType: GateTypeSwap, Qubits: []Qubit{0, 1}},
+				{GateType: GateTypeS, Qubits: []Qubit{0, 1}},
+				{GateType: GateTypeH, Qubits: []Qubit{1}},
+				{GateType: GateTypeControlledNot, Qubits: []Qubit{0}, Target: 1},
+				{GateType: GateTypeH, Qubits: []Qubit{1}}}},
+		{"CSwap = Fredkin",
+			[]Gate{{GateType: GateTypeCSwap, Qubits: []Qubit{1, 0, 2}}},
+			[]Gate{{GateType: GateTypeControlledNot, Qubits: []Qubit{2}, Target: 0},
+				{GateType: GateTypeControlledNot, Qubits: []Qubit{1, 0}, Target: 2},
+				{GateType: GateTypeControlledNot, Qubits: []Qubit{2}, Target: 0}}},
+		{"CPhase(pi) = CZ",
+			[]Gate{{GateType: GateTypeCPhase, Qubits: []Qubit{0}, Target: 1, Lambda: math.Pi}},
+			[]Gate{{GateType: GateTypeCZ, Qubits: []Qubit{0}, Target: 1}}},
+		{"CRZ CRZ = CRZ",
+			[]Gate{{GateType: GateTypeCRZ, Qubits: []Qubit{0}, Target: 2, Theta: .3},
+				{GateType: GateTypeCRZ, Qubits: []Qubit{0}, Target: 2, Theta: .4}},
+			[]Gate{{GateType: GateTypeCRZ, Qubits: []Qubit{0}, Target: 2, Theta: .7}}},
+		{"CU = CRY",
+			[]Gate{{GateType: GateTypeCU, Qubits: []Qubit{0}, Target: 2, Theta: .3}},
+			[]Gate{{GateType: GateTypeCRY, Qubits: []Qubit{0}, Target: 2, Theta: .3}}},
+		{"CRX = CH CRZ CH",
+			[]Gate{{GateType: GateTypeCRX, Qubits: []Qubit{0}, Target: 2, Theta: .3}},
+			[]Gate{{GateType: GateTypeCH, Qubits: []Qubit{0}, Target: 2},
+				{GateType: GateTypeCRZ, Qubits: []Qubit{0}, Target: 2, Theta: .3},
+				{GateType: GateTypeCH, Qubits: []Qubit{0}, Target: 2}}},
+	}
+	for _, backend := range Backends() {
+		for _, test := range equivalent {
+			a, err := NewMachine(backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := NewMachine(backend)
+			prepare(a)
+			prepare(b)
+			for i := range test.a {
+				test.a[i].Apply(a)
+			}
+			for i := range test.b {
+				test.b[i].Apply(b)
+			}
+			x, y := a.State(), b.State()
+			for i := range x {
+				if cmplx.Abs(x[i]-y[i]) > 1e-5 {
+					t.Fatalf("%s: %s %s != %s", backend, test.name, a.StateString(), b.StateString())
+				}
+			}
+		}
+	}
+}
+
+func TestCircuit(t *testing.T) {
+	bell := NewCircuit(2).Register("c", 2).H(0).ControlledNot([]Qubit{0}, 1).Measure(0, 0).Measure(1, 1)
+	if depth := bell.Depth(); depth != 3 {
+		t.Fatalf("depth should be 3 not %d", depth)
+	}
+	circuit := NewCircuit(3).
+		H(0, 1).RX(.3, 2).U(.1, .2, .3, 0).U2(.4, .5, 1).SX(2).S(0).T(1).P(.7, 2).
+		ISwap(0, 2).SqrtSwap(1, 2).RXX(.2, 0, 1).ECR(1, 0).Fredkin(2, 0, 1).
+		CU(.3, .2, .1, []Qubit{0}, 2).CRY(.4, []Qubit{1}, 0).CPhase(.5, []Qubit{0, 2}, 1).Toffoli(0, 1, 2)
+	inverse, err := circuit.Inverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bell.Inverse(); err == nil {
+		t.Fatal("measurements should not be invertible")
+	}
+	for _, backend := range Backends() {
+		machine, err := NewMachine(backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rng := rand.New(rand.NewSource(1))
+		bits, err := bell.Run(machine, rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bits) != 2 || bits[0] != bits[1] {
+			t.Fatalf("%s: bell state measurements should agree %v", backend, bits)
+		}
+
+		machine, _ = NewMachine(backend)
+		if _, err := circuit.Run(machine, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := inverse.Run(machine, nil); err != nil {
+			t.Fatal(err)
+		}
+		if a := machine.Amplitude("000"); cmplx.Abs(a-1) > 1e-5 {
+			t.Fatalf("%s: inverse should undo the circuit %s", backend, machine.StateString())
+		}
+
+		machine, _ = NewMachine(backend)
+		machine.One()
+		composed, err := NewCircuit(3).Compose(NewCircuit(2).ControlledNot([]Qubit{0}, 1), 0, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := composed.Run(machine, nil); err != nil {
+			t.Fatal(err)
+		}
+		if a := machine.Amplitude("101"); cmplx.Abs(a-1) > 1e-5 {
+			t.Fatalf("%s: composed circuit should map qubit 1 to 2 %s", backend, machine.StateString())
+		}
+	}
+	if _, err := NewCircuit(1).Compose(bell); err == nil {
+		t.Fatal("wider circuit should not compose")
+	}
+	if _, err := NewCircuit(1).X(1).Run(&MachineVector128{}, nil); err == nil {
+		t.Fatal("qubit should not exist")
+	}
+	if depth := NewCircuit(3).H(0).X(0).Barrier().H(1).ControlledNot([]Qubit{1}, 2).Depth(); depth != 4 {
+		t.Fatalf("depth should be 4 not %d", depth)
+	}
+}
+
+func TestQASMRoundTrip(t *testing.T) {
+	circuit := NewCircuit(6).Register("a", 2).Register("b", 1).
+		I(0).H(1).X(2).Y(3).Z(4).S(5).T(0).Sdg(1).Tdg(2).SX(3).SXdg(4).
+		U(.1, .2, .3, 0).U3(math.Pi/2, -math.Pi/4, 3*math.Pi/4, 1).U2(.4, 1e-7, 2).U1(.6, 3).P(-.7, 4).
+		RX(1.25, 5).RY(-2.5, 0).RZ(math.Pi, 1).
+		Swap(0, 5).ISwap(1, 2).SqrtSwap(3, 4).RXX(.2, 0, 1).RYY(.3, 2, 3).RZZ(.4, 4, 5).ECR(5, 0).Fredkin(1, 2, 3).
+		ControlledNot([]Qubit{0}, 1).Toffoli(0, 1, 2).ControlledNot([]Qubit{0, 1, 2, 3, 4}, 5).
+		CZ([]Qubit{1}, 2).CZ([]Qubit{1, 3}, 2).CH([]Qubit{0}, 3).CU(.1, .2, .3, []Qubit{4}, 5).
+		CRX(.5, []Qubit{0, 1}, 2).CRY(.6, []Qubit{3}, 4).CRZ(.7, []Qubit{5}, 0).CPhase(.8, []Qubit{2, 4}, 1).
+		Barrier(0, 1, 2).Measure(0, 0).Measure(3, 1).Measure(5, 2)
+	var buffer strings.Builder
+	if err := circuit.WriteQASM(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	source := buffer.String()
+	parsed, err := ReadQASM(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("%v\n%s", err, source)
+	}
+	if parsed.Width != circuit.Width || !reflect.DeepEqual(parsed.Registers, circuit.Registers) {
+		t.Fatalf("registers should round trip\n%s", source)
+	}
+	if len(parsed.Gates) != len(circuit.Gates) {
+		t.Fatalf("expected %d gates got %d\n%s", len(circuit.Gates), len(parsed.Gates), source)
+	}
+	for i := range circuit.Gates {
+		if !reflect.DeepEqual(parsed.Gates[i], circuit.Gates[i]) {
+			t.Fatalf("gate %d should round trip %v %v\n%s", i, circuit.Gates[i], parsed.Gates[i], source)
+		}
+	}
+	buffer.Reset()
+	if err := parsed.WriteQASM(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != source {
+		t.Fatalf("output should be stable\n%s\n%s", source, buffer.String())
+	}
+}
+
+func TestQASM(t *testing.T) {
+	source := `OPENQASM 2.0;
+include "qelib1.inc";
+// a parameterized custom gate
+gate bell(theta) a, b {
+	h a;
+	cx a, b;
+	rz(theta/2) b;
+}
+qreg a[2];
+qreg b[2];
+creg ca[2];
+creg cb[2];
+bell(-pi) a[0], b[0];
+x a[1];
+cx a[1], b[1];
+barrier a, b;
+measure a -> ca;
+measure b -> cb;
+`
+	circuit, err := ReadQASM(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if circuit.Width != 4 || circuit.Bits() != 4 {
+		t.Fatalf("expected 4 qubits and bits got %d and %d", circuit.Width, circuit.Bits())
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 8; i++ {
+		bits, err := circuit.Run(&MachineVector128{}, rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bits[0] != bits[2] || !bits[1] || !bits[3] {
+			t.Fatalf("unexpected measurements %v", bits)
+		}
+	}
+
+	for _, definition := range qasmDefinitions {
+		name, parameters := definition.name, ""
+		if name == "ryy" {
+			parameters = "(0.4)"
+		}
+		prepare := "qreg q[3];\nu(.3,.2,.1) q[0];\nu(1,2,3) q[1];\nu(.5,.6,.7) q[2];\n"
+		native, err := ReadQASM(strings.NewReader(prepare + name + parameters + " q[2],q[0];"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defined := strings.Replace(definition.definition, "gate "+name, "gate my"+name, 1)
+		decomposed, err := ReadQASM(strings.NewReader("include \"qelib1.inc\";\n" + defined + "\n" +
+			prepare + "my" + name + parameters + " q[2],q[0];"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, b := &MachineVector128{}, &MachineVector128{}
+		native.Run(a, nil)
+		decomposed.Run(b, nil)
+		for i := range a.Vector128 {
+			if cmplx.Abs(a.Vector128[i]-b.Vector128[i]) > 1e-9 {
+				t.Fatalf("definition of %s does not match %s %s", name, a.StateString(), b.StateString())
+			}
+		}
+	}
+
+	for _, source := range []string{
+		"qreg q[1]; foo q[0];",
+		"qreg q[2]; cx q[0];",
+		"qreg q[2]; cx q[0], q[0];",
+		"qreg q[1]; x q[1];",
+		"qreg q[1]; rx q[0];",
+		"include \"other.inc\";",
+		"OPENQASM 3.0;",
+		"qreg q[1]; creg c[1]; if(c==1) x q[0];",
+		"opaque foo a; qreg q[1]; foo q[0];",
+		"qreg q[2]; qreg r[3]; cx q, r;",
+		"qreg q[0];",
+		"creg c[0];",
+	} {
+		if _, err := ReadQASM(strings.NewReader(source)); err == nil {
+			t.Fatalf("expected an error for %s", source)
+		}
+	}
+
+	for expression, expected := range map[string]float64{
+		"-2**2":   -4,
+		"-2^2":    -4,
+		"2^-1":    .5,
+		"2**3**2": 512,
+		"-pi/2":   -math.Pi / 2,
+		"3*-2^2":  -12,
+	} {
+		circuit, err := ReadQASM(strings.NewReader("qreg q[1]; rx(" + expression + ") q[0];"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if theta := circuit.Gates[0].Theta; math.Abs(theta-expected) > 1e-12 {
+			t.Fatalf("%s should be %g not %g", expression, expected, theta)
+		}
+	}
+}
+
+func TestQASM3(t *testing.T) {
+	teleport, err := ReadQASM3(strings.NewReader(`OPENQASM 3.0;
+include "stdgates.inc";
+input angle[32] theta;
+qubit[3] q;
+bit[2] c;
+bit r;
+ry(theta) q[0];
+h q[1];
+cx q[1], q[2];
+cx q[0], q[1];
+h q[0];
+c[0] = measure q[0];
+c[1] = measure q[1];
+if (c[1] == 1) x q[2];
+if (c[0]) {
+	z q[2];
+} else {
+	id q[2];
+}
+ry(-theta) q[2];
+r = measure q[2];
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(teleport.Inputs) != 1 || teleport.Inputs[0] != "theta" {
+		t.Fatalf("unexpected inputs %v", teleport.Inputs)
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 16; i++ {
+		bits, err := teleport.Run(&MachineVector64{}, rng, map[string]float64{"theta": 1.1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bits["r"][0] {
+			t.Fatalf("the state should be teleported %v", bits)
+		}
+	}
+	if _, err := teleport.Run(&MachineVector64{}, rng, nil); err == nil {
+		t.Fatal("missing input should fail")
+	}
+
+	loops, err := ReadQASM3(strings.NewReader(`OPENQASM 3;
+qubit[4] q;
+bit[4] b;
+int n = 0;
+for int i in [0:3] {
+	x q[i];
+}
+for i in {1, 2} {
+	pow(2) @ x q[i];
+}
+ctrl(3) @ x q[0], q[1], q[2], q[3];
+negctrl @ x q[3], q[0];
+while (n < 3) {
+	x q[2];
+	n += 1;
+}
+b = measure q;
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits, err := loops.Run(&MachineSparse64{}, rng, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bits["b"], []bool{false, true, false, false}) {
+		t.Fatalf("unexpected measurements %v", bits["b"])
+	}
+
+	equivalent := [][2]string{
+		{"inv @ u3(.1, .2, .3) q[0];", "u3(-.1, -.3, -.2) q[0];"},
+		{"pow(2) @ sx q[1];", "x q[1];"},
+		{"pow(-1) @ t q[2];", "tdg q[2];"},
+		{"ctrl @ gphase(pi/2) q[0];", "s q[0];"},
+		{"ctrl @ ctrl @ h q[0], q[1], q[2];", "ctrl(2) @ h q[0], q[1], q[2];"},
+		{"inv @ ctrl @ rx(.4) q[2], q[0];", "crx(-.4) q[2], q[0];"},
+		{"ctrl @ swap q[0], q[1], q[2];", "cswap q[0], q[1], q[2];"},
+		{"gate g(a) x, y { h x; ctrl @ rz(a) x, y; gphase(a); } ctrl @ g(.3) q[2], q[0], q[1];",
+			"ch q[2], q[0]; ctrl(2) @ rz(.3) q[2], q[0], q[1]; p(.3) q[2];"},
+	}
+	for _, test := range equivalent {
+		var states [2]Vector128
+		for i, source := range test {
+			program, err := ReadQASM3(strings.NewReader("qubit[3] q; u3(.3,.2,.1) q[0]; u3(1,2,3) q[1]; u3(.5,.6,.7) q[2];\n" + source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			machine := &MachineVector128{}
+			if _, err := program.Run(machine, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			states[i] = machine.Vector128
+		}
+		for i := range states[0] {
+			if cmplx.Abs(states[0][i]-states[1][i]) > 1e-9 {
+				t.Fatalf("%s should equal %s", test[0], test[1])
+			}
+		}
+	}
+
+	for _, source := range []string{
+		"qubit q; pow(.5) @ x q;",
+		"qubit q; foo q;",
+		"qubit q; ctrl @ x q;",
+		"qubit[2] q; x q[2];",
+		"qubit q; if (true) { qubit r; }",
+		"OPENQASM 2.0;",
+		"qubit q; bit c; c = measure q;",
+		"qubit q; for int i in [0:1e9] { x q; }",
+		"qubit q; for int i in [0:1e-300:1] { x q; }",
+	} {
+		program, err := ReadQASM3(strings.NewReader(source))
+		if err == nil {
+			_, err = program.Run(&MachineVector128{}, nil, nil)
+		}
+		if err == nil {
+			t.Fatalf("expected an error for %s", source)
+		}
+	}
+}
+
+func TestQASM3Sizes(t *testing.T) {
+	for _, source := range []string{
+		"OPENQASM 3; qubit[-1] q; bit[-2] c;",
+		"qubit[1e30] q;",
+		"qubit[1.5] q;",
+		"bit[0] c;",
+		"qreg q[-1];",
+		"creg c[1e30];",
+		"int[-8] i = 1;",
+		"qubit[2147483647] q;",
+		"bit[2147483647] c;",
+		"qubit[20] a; qubit[20] b;",
+		"int[65] i = 1;",
+	} {
+		if _, err := ReadQASM3(strings.NewReader(source)); err == nil {
+			t.Fatalf("expected an error for %s", source)
+		}
+	}
+	if _, err := ReadQASM3(strings.NewReader("qubit[30] q; bit[64] c; int[64] i = 1;")); err != nil {
+		t.Fatal(err)
+	}
+
+	program, err := ReadQASM3(strings.NewReader("qubit[2] q; qubit r; bit[2] c; bit f; x q[1]; c = measure q; if (c == 2) x r; f = measure r;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits, err := program.Run(&MachineVector128{}, rand.New(rand.NewSource(1)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bits["f"][0] {
+		t.Fatal("the register should have the value of its bits")
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	circuit := NewCircuit(3).Register("c", 2).H(0).RX(.25, 1).U(.1, .2, .3, 2).CRZ(.5, []Qubit{0}, 2).
+		ControlledNot([]Qubit{0, 1}, 2).Barrier().Measure(1, 0).Measure(2, 1)
+	genome := Genome{
+		Gates:         circuit.Gates[:5],
+		Fitness:       .5,
+		Width:         3,
+		Probabilities: [][2][]float64{{{0, 1}, {1, 0}}},
+		Backend:       "vector64",
+	}
+	data, err := json.Marshal(circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `{"gate":"crz","qubits":[0],"target":2,"theta":0.5}`) {
+		t.Fatalf("gates should be encoded by name %s", data)
+	}
+	var decoded Circuit
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, circuit) {
+		t.Fatalf("circuit should round trip %s", data)
+	}
+	data, err = yaml.Marshal(circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = Circuit{}
+	if err := yaml.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, circuit) {
+		t.Fatalf("circuit should round trip %s", data)
+	}
+
+	for _, format := range []struct {
+		marshal   func(interface{}) ([]byte, error)
+		unmarshal func([]byte, interface{}) error
+	}{
+		{json.Marshal, json.Unmarshal},
+		{yaml.Marshal, yaml.Unmarshal},
+	} {
+		data, err := format.marshal(genome)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var g Genome
+		if err := format.unmarshal(data, &g); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(g, genome) {
+			t.Fatalf("genome should round trip %s", data)
+		}
+		expected := genome.Copy()
+		if err := expected.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if g.Fitness != expected.Fitness {
+			t.Fatalf("decoded genome should execute the same %s", data)
+		}
+	}
+
+	for _, data := range []string{
+		`{"version":2,"width":1,"gates":[]}`,
+		`{"width":1,"gates":[]}`,
+		`{"version":1,"width":1,"gates":[{"gate":"foo"}]}`,
+		`{"version":1,"width":2,"gates":[{"gate":"cnot","qubits":[0]}]}`,
+		`{"version":1,"width":2,"gates":[{"gate":"iswap","qubits":[0]}]}`,
+		`{"version":1,"width":3,"gates":[{"gate":"cswap","qubits":[0,1]}]}`,
+		`{"version":1,"width":2,"gates":[{"gate":"cnot","qubits":[0,1],"target":1}]}`,
+		`{"version":1,"width":2,"gates":[{"gate":"measure","qubits":[0,1],"bits":[0]}]}`,
+		`{"version":1,"width":2,"gates":[{"gate":"h","qubits":[2]}]}`,
+		`{"version":1,"width":2,"gates":[{"gate":"cnot","qubits":[0],"target":2}]}`,
+		`{"version":1,"width":2,"gates":[{"gate":"measure","qubits":[0],"bits":[0]}]}`,
+		`{"version":1,"width":2,"registers":[{"name":"c","size":1}],"gates":[{"gate":"measure","qubits":[0],"bits":[1]}]}`,
+		`{"version":1,"width":2,"registers":[{"name":"c","size":-1}],"gates":[]}`,
+		`{"version":1,"width":-1,"gates":[]}`,
+	} {
+		if err := json.Unmarshal([]byte(data), &Circuit{}); err == nil {
+			t.Fatalf("expected an error for %s", data)
+		}
+		if err := yaml.Unmarshal([]byte(data), &Circuit{}); err == nil {
+			t.Fatalf("expected an error for %s", data)
+		}
+	}
+	measured := Circuit{}
+	data = []byte(`{"version":1,"width":2,"registers":[{"name":"c","size":2}],"gates":[{"gate":"measure","qubits":[1],"bits":[1]}]}`)
+	if err := json.Unmarshal(data, &measured); err != nil {
+		t.Fatal(err)
+	}
+	if measured.Bits() != 2 || len(measured.Gates) != 1 {
+		t.Fatalf("circuit should decode %v", measured)
+	}
+	if err := json.Unmarshal([]byte(`{"version":1,"width":1,"gates":[{"gate":"x","qubits":[1]}]}`), &Genome{}); err == nil {
+		t.Fatal("expected an error for a genome gate outside of its width")
+	}
+	for _, gate := range []Gate{
+		{GateType: GateTypeISwap, Qubits: []Qubit{0}},
+		{GateType: GateTypeRZZ, Qubits: []Qubit{0, 1, 2}},
+		{GateType: GateTypeCSwap, Qubits: []Qubit{0, 1}},
+		{GateType: GateTypeCZ, Qubits: []Qubit{1}, Target: 1},
+	} {
+		circuit := &Circuit{Width: 3, Gates: []Gate{gate}}
+		if _, err := circuit.Run(&MachineVector128{}, nil); err == nil {
+			t.Fatalf("expected an error for %v", gate)
+		}
+	}
+}
+
+func TestDiagram(t *testing.T) {
+	bell := NewCircuit(3).Register("c", 2).H(0).ControlledNot([]Qubit{0}, 2).RX(math.Pi/2, 1).Swap(1, 2).Measure(0, 0)
+	expected := "q0: ─┤H├──●──┤M→c[0]├─────\n" +
+		"          │\n" +
+		"q1: ──────┼──┤RX(π/2)├──×─\n" +
+		"          │             │\n" +
+		"q2: ──────⊕─────────────×─\n"
+	if diagram := bell.Diagram(0); diagram != expected {
+		t.Fatalf("unexpected diagram\n%s\n%s", diagram, expected)
+	}
+	circuit := NewCircuit(4)
+	for i := 0; i < 16; i++ {
+		circuit.CRZ(float64(i), []Qubit{Qubit(i % 4)}, Qubit((i+1)%4))
+	}
+	diagram := circuit.Diagram(40)
+	blocks := strings.Split(diagram, "\n\n")
+	if len(blocks) < 2 {
+		t.Fatalf("diagram should wrap\n%s", diagram)
+	}
+	for _, line := range strings.Split(diagram, "\n") {
+		if n := len([]rune(line)); n > 40 {
+			t.Fatalf("line is %d characters\n%s", n, diagram)
+		}
+	}
+	if !strings.Contains(blocks[1], "q3: «") {
+		t.Fatalf("wrapped lines should be marked\n%s", diagram)
+	}
+
+	genome := Genome{Width: 1, Gates: []Gate{
+		{GateType: GateTypeH, Qubits: []Qubit{3}},
+		{GateType: GateTypeControlledNot, Qubits: []Qubit{0}, Target: 2},
+	}}
+	if diagram := genome.Diagram(0); !strings.Contains(diagram, "q3: ─┤H├─") {
+		t.Fatalf("diagram should draw every qubit of the gates\n%s", diagram)
+	}
+	if err := genome.WriteSVG(&strings.Builder{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := genome.WriteQuantikz(&strings.Builder{}); err != nil {
+		t.Fatal(err)
+	}
+
+	malformed := &Circuit{Width: 3, Gates: []Gate{
+		{GateType: GateTypeCSwap, Qubits: []Qubit{0, 1}},
+		{GateType: GateTypeECR, Qubits: []Qubit{0}},
+		{GateType: GateTypeMeasure, Qubits: []Qubit{0, 1}, Bits: []int{0}},
+		{GateType: GateTypeH, Qubits: []Qubit{2}},
+	}}
+	if diagram := malformed.Diagram(0); !strings.Contains(diagram, "┤H├") || strings.Contains(diagram, "ECR") {
+		t.Fatalf("diagram should skip malformed gates\n%s", diagram)
+	}
+	if err := malformed.WriteSVG(&strings.Builder{}); err == nil {
+		t.Fatal("malformed gates should not be drawn as SVG")
+	}
+	if err := malformed.WriteQuantikz(&strings.Builder{}); err == nil {
+		t.Fatal("malformed gates should not be drawn with quantikz")
+	}
+}
+
+func TestExport(t *testing.T) {
+	circuit := NewCircuit(3).Register("c", 1).H(0).ControlledNot([]Qubit{0, 1}, 2).
+		RX(3*math.Pi/4, 1).CRZ(-math.Pi/2, []Qubit{2}, 0).Swap(0, 2).Barrier().Measure(2, 0)
+	var builder strings.Builder
+	if err := circuit.WriteQuantikz(&builder); err != nil {
+		t.Fatal(err)
+	}
+	expected := "\\begin{quantikz}\n" +
+		`\lstick{$q_{0}$} & \gate{H} & \ctrl{2} & \qw & \gate{R_Z\left(-\frac{\pi}{2}\right)} & \swap{2} & \qw\slice{} & \qw & \qw \\` + "\n" +
+		`\lstick{$q_{1}$} & \qw & \ctrl{1} & \gate{R_X\left(\frac{3\pi}{4}\right)} & \qw & \qw & \qw & \qw & \qw \\` + "\n" +
+		`\lstick{$q_{2}$} & \qw & \targ{} & \qw & \ctrl{-2} & \targX{} & \qw & \meter{\mathrm{c}_{0}} & \qw` + "\n" +
+		"\\end{quantikz}\n"
+	if builder.String() != expected {
+		t.Fatalf("unexpected quantikz\n%s\n%s", builder.String(), expected)
+	}
+
+	builder.Reset()
+	if err := circuit.WriteSVG(&builder); err != nil {
+		t.Fatal(err)
+	}
+	decoder, elements := xml.NewDecoder(strings.NewReader(builder.String())), map[string]int{}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid svg: %v\n%s", err, builder.String())
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			elements[start.Name.Local]++
+		}
+	}
+	if elements["svg"] != 1 || elements["circle"] != 4 {
+		t.Fatalf("unexpected svg elements %v\n%s", elements, builder.String())
+	}
+	for _, text := range []string{">H<", ">RX(3π/4)<", ">RZ(-π/2)<", ">c[0]<"} {
+		if !strings.Contains(builder.String(), text) {
+			t.Fatalf("svg is missing %s\n%s", text, builder.String())
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	observed := 0
+	result, err := Optimize(context.Background(), "sparse64", 2, 4, [][2][]float64{
+		{{0, 1}, {1, 1}},
+		{{1, 0}, {0, 0}},
+	}, func(generation int, fitness float64, best *Genome) {
+		if generation != observed || fitness != best.Fitness {
+			t.Fatalf("unexpected observation of generation %d", generation)
+		}
+		observed++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Generations == 0 || result.Generations != len(result.Statistics) {
+		t.Fatalf("%d generations with %d statistics", result.Generations, len(result.Statistics))
+	}
+	for i, statistics := range result.Statistics {
+		if statistics.Best > statistics.Mean || statistics.Mean > statistics.Worst {
+			t.Fatalf("generation %d has unordered statistics %v", i, statistics)
+		}
+		if i > 0 && statistics.Best > result.Statistics[i-1].Best {
+			t.Fatalf("best fitness got worse in generation %d", i)
+		}
+	}
+	best := result.Best.Copy()
+	if err := best.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if best.Fitness != result.Best.Fitness || best.Fitness != result.Statistics[len(result.Statistics)-1].Best {
+		t.Fatalf("best fitness %f should be %f", result.Best.Fitness, best.Fitness)
+	}
+	if result.Duration <= 0 {
+		t.Fatal("duration should be measured")
+	}
+	if observed != result.Generations {
+		t.Fatalf("%d of %d generations observed", observed, result.Generations)
+	}
+}
+
+func TestOptimizerOptions(t *testing.T) {
+	probabilities := [][2][]float64{
+		{{0, 1}, {1, 1}},
+		{{1, 0}, {0, 0}},
+	}
+	options := NewOptimizerOptions()
+	options.Population, options.Generations, options.Elitism = 20, 5, 5
+	options.Gates = []GateWeight{{GateTypeCZ, 1}, {GateTypeRY, 2}, {GateTypeSwap, 1}}
+	options.MaxControls, options.MutationRate, options.Seed = 1, .5, 7
+	a, err := OptimizeWithOptions(context.Background(), 2, 4, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := OptimizeWithOptions(context.Background(), 2, 4, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a.Statistics, b.Statistics) || !reflect.DeepEqual(a.Best.Gates, b.Best.Gates) {
+		t.Fatal("optimization with the same seed should be deterministic")
+	}
+	options.Workers = 1
+	b, err = OptimizeWithOptions(context.Background(), 2, 4, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(a.Statistics, b.Statistics) || !reflect.DeepEqual(a.Best.Gates, b.Best.Gates) {
+		t.Fatal("optimization should not depend on the number of workers")
+	}
+	options.Workers = 4
+	for _, gate := range a.Best.Gates {
+		switch gate.GateType {
+		case GateTypeCZ:
+			if len(gate.Qubits) > 1 {
+				t.Fatalf("%v has too many controls", gate)
+			}
+		case GateTypeRY:
+			if gate.Theta < 0 || gate.Theta > 4*math.Pi {
+				t.Fatalf("%v has an angle out of range", gate)
+			}
+		case GateTypeSwap:
+		default:
+			t.Fatalf("%v is not allowed", gate)
+		}
+	}
+
+	options.Target = math.Inf(1)
+	result, err := OptimizeWithOptions(context.Background(), 2, 4, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Generations != 1 {
+		t.Fatalf("optimization should stop at the target after %d generations", result.Generations)
+	}
+
+	invalid := []func(o *OptimizerOptions){
+		func(o *OptimizerOptions) { o.Backend = "unknown" },
+		func(o *OptimizerOptions) { o.Population = 0 },
+		func(o *OptimizerOptions) { o.MutationRate = 2 },
+		func(o *OptimizerOptions) { o.Workers = 0 },
+		func(o *OptimizerOptions) { o.Gates = nil },
+		func(o *OptimizerOptions) { o.Gates = []GateWeight{{GateTypeMeasure, 1}} },
+		func(o *OptimizerOptions) { o.Gates = []GateWeight{{GateTypeCSwap, 1}} },
+	}
+	for i, modify := range invalid {
+		options := NewOptimizerOptions()
+		modify(options)
+		if _, err := OptimizeWithOptions(context.Background(), 2, 4, probabilities, options); err == nil {
+			t.Fatalf("invalid options %d should fail", i)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	options := NewOptimizerOptions()
+	options.Observer = func(generation int, fitness float64, best *Genome) {
+		if generation == 2 {
+			cancel()
+		}
+	}
+	options.Target = -1
+	result, err := OptimizeWithOptions(ctx, 2, 4, [][2][]float64{{{0, 1}, {1, 1}}}, options)
+	if err != context.Canceled {
+		t.Fatalf("optimization should be canceled: %v", err)
+	}
+	if result.Generations != 3 || len(result.Best.Gates) != 4 {
+		t.Fatalf("canceled optimization should return the best genome after %d generations", result.Generations)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	machine, generations := MachineDense128{}, 0
+	points, err := machine.Points(ctx, func(generation int, fitness float64, points []Point) {
+		generations++
+		if generation == 2 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("points should be canceled: %v", err)
+	}
+	if generations != 3 || len(points) != 2 {
+		t.Fatalf("%d points after %d generations", len(points), generations)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "checkpoint.json")
+	probabilities := [][2][]float64{{{0, 1}, {1, 1}}, {{1, 0}, {0, 1}}}
+	options := NewOptimizerOptions()
+	options.Population, options.Generations, options.Target = 20, 8, -1
+	options.MutationRate, options.Elitism, options.Backend = .5, 10, "vector128"
+	options.CheckpointInterval = 3
+	unchecked, err := OptimizeWithOptions(context.Background(), 3, 5, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.Checkpoint = name
+	expected, err := OptimizeWithOptions(context.Background(), 3, 5, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unchecked.Statistics, expected.Statistics) ||
+		!reflect.DeepEqual(unchecked.Best.Gates, expected.Best.Gates) {
+		t.Fatal("checkpoints should not change the optimization")
+	}
+
+	options.Checkpoint = ""
+	result, err := Resume(context.Background(), name, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Statistics, expected.Statistics) ||
+		!reflect.DeepEqual(result.Best.Gates, expected.Best.Gates) ||
+		result.Generations != expected.Generations {
+		t.Fatal("resumed optimization should continue identically")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	options.Checkpoint, options.Observer = name, func(generation int, fitness float64, best *Genome) {
+		if generation == 4 {
+			cancel()
+		}
+	}
+	if _, err := OptimizeWithOptions(ctx, 3, 5, probabilities, options); err != context.Canceled {
+		t.Fatalf("optimization should be canceled: %v", err)
+	}
+	options.Observer = nil
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"probabilities"`); n != 1 {
+		t.Fatalf("probabilities should be stored once not %d times", n)
+	}
+	result, err = Resume(context.Background(), name, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Statistics, expected.Statistics) {
+		t.Fatal("optimization resumed after cancellation should continue identically")
+	}
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	options.Checkpoint = ""
+	result, err = Resume(context.Background(), name, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Statistics, expected.Statistics) {
+		t.Fatal("optimization resumed without checkpoints should continue identically")
+	}
+
+	options.Islands = 2
+	if _, err := Resume(context.Background(), name, options); err == nil {
+		t.Fatal("resuming with islands should fail")
+	}
+	options.Islands = 1
+	invalid := strings.Replace(string(data), `"qubits":[`, `"qubits":[7,`, 1)
+	if err := ioutil.WriteFile(name, []byte(invalid), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resume(context.Background(), name, options); err == nil {
+		t.Fatal("resuming with a genome wider than the optimization should fail")
+	}
+
+	options.Checkpoint, options.MultiObjective = name, true
+	expected, err = OptimizeWithOptions(context.Background(), 3, 5, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.Generations = 6
+	result, err = Resume(context.Background(), name, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Front) == 0 || !reflect.DeepEqual(result.Statistics, expected.Statistics[:6]) {
+		t.Fatal("multi-objective optimization should resume with its front")
+	}
+	options.Generations = 8
+	options.MultiObjective = false
+	if _, err := Resume(context.Background(), name, options); err == nil {
+		t.Fatal("resuming a multi-objective checkpoint should fail")
+	}
+
+	options.Checkpoint, options.Generations = name, 5
+	options.FitnessFunction = func(g *Genome, states []Vector128) float64 {
+		if g.Gates[0].GateType == GateTypeControlledNot {
+			return math.NaN()
+		}
+		return math.Inf(1)
+	}
+	if _, err := OptimizeWithOptions(context.Background(), 3, 5, probabilities, options); err != nil {
+		t.Fatalf("fitness that is not finite should be checkpointed: %v", err)
+	}
+	result, err = Resume(context.Background(), name, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statistics := result.Statistics[0]; !math.IsNaN(statistics.Best) || !math.IsInf(statistics.Worst, 1) {
+		t.Fatalf("fitness that is not finite should be restored %v", statistics)
+	}
+	options.FitnessFunction = nil
+
+	options.Rand = rand.New(rand.NewSource(1))
+	if _, err := Resume(context.Background(), name, options); err == nil {
+		t.Fatal("resuming with a random number generator should fail")
+	}
+}
+
+func TestFitnessFunctions(t *testing.T) {
+	genome := Genome{
+		Gates:         NewCircuit(1).H(0).Gates,
+		Width:         1,
+		Probabilities: [][2][]float64{{{0}, {1}}},
+		Backend:       "vector128",
+	}
+	plus := Vector128{complex(1/math.Sqrt2, 0), complex(1/math.Sqrt2, 0)}
+	tests := []struct {
+		name     string
+		fitness  FitnessFunction
+		expected float64
+	}{
+		{"nil", nil, 1},
+		{"bit error", BitError, 1},
+		{"expected bit error", ExpectedBitError, .5},
+		{"cross entropy", CrossEntropy, math.Ln2},
+		{"fidelity", StateFidelity([]Vector128{plus}), 0},
+		{"fidelity zero", StateFidelity([]Vector128{{1, 0}}), .5},
+		{"penalty", Penalty(ExpectedBitError, .1, .01), .61},
+	}
+	for _, test := range tests {
+		genome.FitnessFunction = test.fitness
+		if err := genome.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(genome.Fitness-test.expected) > 1e-9 {
+			t.Fatalf("%s: fitness %f should be %f", test.name, genome.Fitness, test.expected)
+		}
+	}
+
+	options := NewOptimizerOptions()
+	options.Population, options.Generations, options.Target = 20, 5, -1
+	options.FitnessFunction = CrossEntropy
+	result, err := OptimizeWithOptions(context.Background(), 2, 3, [][2][]float64{{{0, 1}, {1, 0}}}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := result.Best.Copy()
+	best.FitnessFunction = CrossEntropy
+	if err := best.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if best.Fitness != result.Best.Fitness {
+		t.Fatalf("best fitness %f should be the cross entropy %f", result.Best.Fitness, best.Fitness)
+	}
+
+	if _, err := OptimizeWithOptions(context.Background(), 2, 3, [][2][]float64{{{0, 1}, {1, 0, 1}}}, options); err == nil {
+		t.Fatal("outputs wider than the genome should fail")
+	}
+	if fitness := StateFidelity(nil)(&genome, []Vector128{plus, plus}); fitness != 2 {
+		t.Fatalf("states without targets should have zero fidelity %f", fitness)
+	}
+}
+
+func TestVariableLength(t *testing.T) {
+	probabilities := [][2][]float64{{{0, 0}, {1, 1}}, {{1, 1}, {0, 0}}}
+	options := NewOptimizerOptions()
+	options.Population, options.Generations = 30, 30
+	options.MinDepth, options.MaxDepth = 1, 12
+	options.Insertion, options.Deletion, options.Duplication = .3, .3, .2
+	options.Parsimony, options.Target = .01, -1
+	lengths := map[int]bool{}
+	options.Observer = func(generation int, fitness float64, best *Genome) {
+		if n := len(best.Gates); n < 1 || n > 12 {
+			t.Fatalf("genome of %d gates is out of bounds", n)
+		}
+		lengths[len(best.Gates)] = true
+	}
+	result, err := OptimizeWithOptions(context.Background(), 2, 6, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Best.Fitness != 0 {
+		t.Fatalf("fitness %f should be zero", result.Best.Fitness)
+	}
+	if len(result.Best.Gates) > 2 {
+		t.Fatalf("parsimony should find a small circuit\n%s", result.Best.Diagram(0))
+	}
+	if len(lengths) < 2 {
+		t.Fatal("genomes should change length")
+	}
+
+	options.MinDepth = 7
+	if _, err := OptimizeWithOptions(context.Background(), 2, 6, probabilities, options); err == nil {
+		t.Fatal("depth outside of the bounds should fail")
+	}
+}
+
+func TestCrossover(t *testing.T) {
+	if m := moments(NewCircuit(3).H(0).ControlledNot([]Qubit{0}, 1).X(2).Z(1).Gates, 3); !reflect.DeepEqual(m, []int{0, 1, 0, 2}) {
+		t.Fatalf("unexpected moments %v", m)
+	}
+	probabilities := [][2][]float64{{{0, 1}, {1, 0}}}
+	for _, crossover := range []Crossover{CrossoverSwap, CrossoverOnePoint, CrossoverTwoPoint, CrossoverUniform, CrossoverLayer} {
+		for _, variable := range []bool{false, true} {
+			options := NewOptimizerOptions()
+			options.Crossover = crossover
+			if variable {
+				options.MinDepth, options.MaxDepth = 2, 10
+			}
+			o, err := newOptimizer(2, 6, probabilities, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, b := o.genome(), o.genome()
+			for i := range a.Gates {
+				a.Gates[i] = Gate{GateType: GateTypeX, Qubits: []Qubit{Qubit(i % 2)}}
+				b.Gates[i] = Gate{GateType: GateTypeZ, Qubits: []Qubit{Qubit(i % 2)}}
+			}
+			for n := 0; n < 32; n++ {
+				c1, c2 := o.crossover(&a, &b)
+				counts := map[GateType]int{}
+				for _, child := range []Genome{c1, c2} {
+					if l := len(child.Gates); (!variable && l != 6) || l < 2 || l > 10 {
+						t.Fatalf("crossover %d: child of %d gates", crossover, l)
+					}
+					for _, gate := range child.Gates {
+						counts[gate.GateType]++
+					}
+				}
+				if !variable && crossover != CrossoverLayer && (counts[GateTypeX] != 6 || counts[GateTypeZ] != 6) {
+					t.Fatalf("crossover %d should exchange gates %v", crossover, counts)
+				}
+			}
+		}
+	}
+
+	options := NewOptimizerOptions()
+	options.Crossover, options.Gates = CrossoverLayer, []GateWeight{{GateTypeH, 1}}
+	o, err := newOptimizer(2, 6, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := o.genome(), o.genome()
+	for i := range a.Gates {
+		a.Gates[i] = Gate{GateType: GateTypeX, Qubits: []Qubit{Qubit(i % 2)}}
+		b.Gates[i] = Gate{GateType: GateTypeZ, Qubits: []Qubit{0}}
+	}
+	for n := 0; n < 32; n++ {
+		c1, c2 := o.crossover(&a, &b)
+		for _, child := range []Genome{c1, c2} {
+			counts := map[GateType]int{}
+			for _, gate := range child.Gates {
+				counts[gate.GateType]++
+			}
+			if len(child.Gates) != 6 || counts[GateTypeI] != 0 || counts[GateTypeX]+counts[GateTypeZ] > 6 {
+				t.Fatalf("layer crossover should keep the length with random gates %v", counts)
+			}
+		}
+	}
+
+	options = NewOptimizerOptions()
+	options.Selection, options.MultiObjective = SelectionRoulette, true
+	o, err = newOptimizer(2, 2, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	genomes := []Genome{
+		{Gates: NewCircuit(2).H(0).ControlledNot([]Qubit{0}, 1).Gates, Fitness: 0, Width: 2},
+		{Gates: NewCircuit(2).H(0).Gates, Fitness: .5, Width: 2},
+		{Gates: NewCircuit(2).H(0).X(1).Gates, Fitness: .75, Width: 2},
+	}
+	if weights := o.weights(genomes); !reflect.DeepEqual(weights, []float64{1, 1, .5}) {
+		t.Fatalf("roulette weights should follow the fronts %v", weights)
+	}
+
+	for _, selection := range []Selection{SelectionTruncation, SelectionTournament, SelectionRoulette} {
+		options := NewOptimizerOptions()
+		options.Population, options.Generations = 20, 10
+		options.Selection, options.Crossover = selection, CrossoverTwoPoint
+		options.Crossovers = 20
+		result, err := OptimizeWithOptions(context.Background(), 2, 4, probabilities, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Best.Fitness != 0 {
+			t.Fatalf("selection %d: fitness %f", selection, result.Best.Fitness)
+		}
+	}
+	options = NewOptimizerOptions()
+	options.Selection = 7
+	if _, err := OptimizeWithOptions(context.Background(), 2, 4, probabilities, options); err == nil {
+		t.Fatal("unknown selection should fail")
+	}
+}
+
+func TestIslands(t *testing.T) {
+	probabilities := [][2][]float64{{{0, 1, 0}, {1, 0, 1}}, {{1, 1, 0}, {0, 1, 1}}}
+	for _, topology := range []Topology{TopologyRing, TopologyComplete, TopologyRandom} {
+		options := NewOptimizerOptions()
+		options.Population, options.Generations, options.Target = 10, 6, -1
+		options.Islands, options.MigrationInterval, options.Topology = 3, 2, topology
+		options.Backend = "vector128"
+		a, err := OptimizeWithOptions(context.Background(), 3, 5, probabilities, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := OptimizeWithOptions(context.Background(), 3, 5, probabilities, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Generations != 6 || !reflect.DeepEqual(a.Statistics, b.Statistics) || !reflect.DeepEqual(a.Best.Gates, b.Best.Gates) {
+			t.Fatalf("topology %d: island optimization should be deterministic", topology)
+		}
+	}
+
+	options := NewOptimizerOptions()
+	options.Population, options.Islands, options.Migrants = 10, 3, 1
+	o, err := newOptimizer(3, 5, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.initialize()
+	o.parallel((*optimizer).survive)
+	best := make([][]Gate, len(o.islands))
+	for i, island := range o.islands {
+		best[i] = island.genomes[0].Copy().Gates
+	}
+	o.migrate()
+	for i := range o.islands {
+		found, next := false, o.islands[(i+1)%len(o.islands)]
+		for _, genome := range next.genomes {
+			if reflect.DeepEqual(genome.Gates, best[i]) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("the best genome of island %d should migrate to the next island", i)
+		}
+	}
+
+	options.MultiObjective = true
+	if o, err = newOptimizer(3, 5, probabilities, options); err != nil {
+		t.Fatal(err)
+	}
+	o.initialize()
+	o.parallel((*optimizer).survive)
+	o.migrate()
+	for i, island := range o.islands {
+		ranked := make([]Genome, len(island.genomes))
+		copy(ranked, island.genomes)
+		nsga(ranked)
+		if !reflect.DeepEqual(ranked, island.genomes) {
+			t.Fatalf("island %d should be ranked by non-domination after migration", i)
+		}
+	}
+	options.MultiObjective = false
+
+	options.Checkpoint = "checkpoint.json"
+	if _, err := OptimizeWithOptions(context.Background(), 3, 5, probabilities, options); err == nil {
+		t.Fatal("checkpoints with islands should fail")
+	}
+}
+
+func TestPareto(t *testing.T) {
+	if n := NewCircuit(4).H(0, 1).ControlledNot([]Qubit{0}, 1).Swap(0, 1, 2, 3).Barrier().Measure(0, 0).MultiQubit(); n != 3 {
+		t.Fatalf("%d multi qubit gates should be 3", n)
+	}
+	objectives := []Objectives{
+		{Fitness: 1, Gates: 2, MultiQubit: 1, Depth: 2},
+		{Fitness: 0, Gates: 4, MultiQubit: 2, Depth: 3},
+		{Fitness: 1, Gates: 3, MultiQubit: 1, Depth: 2},
+		{Fitness: 2, Gates: 4, MultiQubit: 2, Depth: 3},
+	}
+	if f := fronts(objectives); !reflect.DeepEqual(f, [][]int{{0, 1}, {2}, {3}}) {
+		t.Fatalf("unexpected fronts %v", f)
+	}
+	if objectives[0].Dominates(objectives[0]) || !objectives[0].Dominates(objectives[2]) {
+		t.Fatal("objectives should dominate strictly")
+	}
+
+	options := NewOptimizerOptions()
+	options.Population, options.Generations, options.Target = 30, 10, -1
+	options.MultiObjective = true
+	result, err := OptimizeWithOptions(context.Background(), 3, 6, [][2][]float64{{{0, 1, 0}, {1, 0, 1}}}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Front) == 0 {
+		t.Fatal("the pareto front should not be empty")
+	}
+	for i := range result.Front {
+		a := result.Front[i].Objectives()
+		if i > 0 && result.Front[i].Fitness < result.Front[i-1].Fitness {
+			t.Fatal("the pareto front should be ordered by fitness")
+		}
+		for j := range result.Front {
+			if b := result.Front[j].Objectives(); b.Dominates(a) || (i != j && a == b) {
+				t.Fatalf("%v and %v should not be on the same front", a, b)
+			}
+		}
+	}
+	if result.Front[0].Fitness != result.Best.Fitness {
+		t.Fatalf("the front should contain the best fitness %f", result.Best.Fitness)
+	}
+
+	o, err := newOptimizer(2, 3, [][2][]float64{{{0, 0}, {0, 0}}}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.result = &Result{}
+	o.record([]Genome{
+		{Gates: NewCircuit(2).H(0).X(1).Z(0).Gates, Width: 2},
+		{Gates: NewCircuit(2).H(0).Gates, Width: 2},
+	})
+	if len(o.result.Best.Gates) != 1 {
+		t.Fatalf("the best genome should be taken from the first front %v", o.result.Best.Gates)
+	}
+}
+
+func TestRefine(t *testing.T) {
+	genome := Genome{
+		Gates:           NewCircuit(2).RY(.3, 0).H(1).CRZ(2, []Qubit{0}, 1).RY(.2, 1).Gates,
+		Width:           2,
+		Probabilities:   [][2][]float64{{{0, 0}, {1, 1}}},
+		Backend:         "vector128",
+		FitnessFunction: ExpectedBitError,
+	}
+	if err := genome.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	before := genome.Fitness
+	if err := genome.Refine(400); err != nil {
+		t.Fatal(err)
+	}
+	if genome.Fitness >= before || genome.Fitness > 1e-6 {
+		t.Fatalf("refined fitness %g should improve on %g", genome.Fitness, before)
+	}
+	fitness := genome.Fitness
+	if err := genome.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(genome.Fitness-fitness) > 1e-12 {
+		t.Fatalf("refined angles should have fitness %g not %g", fitness, genome.Fitness)
+	}
+	if genome.Gates[1].GateType != GateTypeH || len(genome.Gates) != 4 {
+		t.Fatal("refinement should not change the gates")
+	}
+
+	options := NewOptimizerOptions()
+	options.Population, options.Generations, options.Target = 20, 5, 1e-6
+	target := Vector128{complex(math.Cos(.4), 0), 0, complex(math.Sin(.4), 0), 0}
+	options.FitnessFunction, options.Workers = StateFidelity([]Vector128{target}), 2
+	options.Backend = "vector128"
+	options.Gates = []GateWeight{{GateTypeRX, 1}, {GateTypeRY, 1}, {GateTypeControlledNot, 1}}
+	probabilities := [][2][]float64{{{0, 0}, {0, 0}}}
+	result, err := OptimizeWithOptions(context.Background(), 2, 3, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Best.Fitness <= 1e-6 {
+		t.Fatalf("fitness %g should not reach the target without refinement", result.Best.Fitness)
+	}
+	options.Refinements = 3
+	result, err = OptimizeWithOptions(context.Background(), 2, 3, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	best := result.Best.Copy()
+	if err := best.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if best.Fitness != result.Best.Fitness || best.Fitness > 1e-6 {
+		t.Fatalf("refined optimization should reach the target %g %g", best.Fitness, result.Best.Fitness)
+	}
+
+	evaluations := 0
+	options.Workers, options.FitnessFunction = 1, func(g *Genome, states []Vector128) float64 {
+		evaluations++
+		return StateFidelity([]Vector128{target})(g, states)
+	}
+	o, err := newOptimizer(2, 3, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.initialize()
+	if err := o.survive(); err != nil {
+		t.Fatal(err)
+	}
+	evaluations = 0
+	if err := o.survive(); err != nil {
+		t.Fatal(err)
+	}
+	if evaluations != 0 {
+		t.Fatalf("unchanged refined genomes should not be refined again, %d evaluations", evaluations)
+	}
+
+	name := filepath.Join(t.TempDir(), "checkpoint.json")
+	options.FitnessFunction, options.Target = StateFidelity([]Vector128{target}), -1
+	options.Generations, options.Checkpoint, options.CheckpointInterval = 6, name, 4
+	expected, err := OptimizeWithOptions(context.Background(), 2, 3, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = Resume(context.Background(), name, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Statistics, expected.Statistics) {
+		t.Fatal("refined optimization should resume identically")
+	}
+	options.Checkpoint = ""
+
+	measured := genome.Copy()
+	measured.Gates = append(measured.Gates, Gate{GateType: GateTypeMeasure, Qubits: []Qubit{0}, Bits: []int{0}})
+	if err := measured.Execute(); err == nil {
+		t.Fatal("executing a measurement without a rng should fail")
+	}
+	if err := measured.Refine(400); err == nil {
+		t.Fatal("refining a genome that fails to execute should fail")
+	}
+	unknown := genome.Copy()
+	unknown.Backend = "abacus"
+	if err := unknown.Execute(); err == nil {
+		t.Fatal("executing on an unknown backend should fail")
+	}
+	o, err = newOptimizer(2, 3, probabilities, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.initialize()
+	o.genomes[len(o.genomes)-1] = measured
+	if err := o.survive(); err == nil {
+		t.Fatal("a genome that fails to execute should stop the optimization")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// Topology determines the destination islands of migrations
+type Topology int
+
+const (
+	// TopologyRing migrates from each island to the next island
+	TopologyRing Topology = iota
+	// TopologyComplete migrates from each island to every other island
+	TopologyComplete
+	// TopologyRandom migrates from each island to a random other island
+	TopologyRandom
+)
+
+// populate creates the islands, each with its own random number generator
+// seeded from the random number generator of the optimizer
+func (o *optimizer) populate() {
+	o.islands = make([]*optimizer, o.Islands)
+	for i := range o.islands {
+		options := *o.OptimizerOptions
+		options.Islands, options.Observer, options.Checkpoint = 1, nil, ""
+		options.Rand = nil
+		island := &optimizer{
+			OptimizerOptions: &options,
+			rng:              rand.New(rand.NewSource(o.rng.Int63())),
+			width:            o.width,
+			depth:            o.depth,
+			probabilities:    o.probabilities,
+			total:            o.total,
+		}
+		island.initialize()
+		o.islands[i] = island
+	}
+}
+
+// parallel calls f for each island in its own goroutine and returns the
+// error of the first island that fails
+func (o *optimizer) parallel(f func(island *optimizer) error) error {
+	var wait sync.WaitGroup
+	errs := make([]error, len(o.islands))
+	wait.Add(len(o.islands))
+	for i, island := range o.islands {
+		go func(i int, island *optimizer) {
+			defer wait.Done()
+			errs[i] = f(island)
+		}(i, island)
+	}
+	wait.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate copies the fittest genomes of each island over the least fit
+// genomes of the destination islands
+func (o *optimizer) migrate() {
+	n := len(o.islands)
+	emigrants := make([][]Genome, n)
+	for i, island := range o.islands {
+		migrants := o.Migrants
+		if migrants > len(island.genomes) {
+			migrants = len(island.genomes)
+		}
+		for j := range island.genomes[:migrants] {
+			cp := island.genomes[j].Copy()
+			cp.Fitness, cp.refined = island.genomes[j].Fitness, island.genomes[j].refined
+			emigrants[i] = append(emigrants[i], cp)
+		}
+	}
+	immigrants := make([][]Genome, n)
+	for i := range o.islands {
+		switch o.Topology {
+		case TopologyRing:
+			j := (i + 1) % n
+			immigrants[j] = append(immigrants[j], emigrants[i]...)
+		case TopologyComplete:
+			for j := range o.islands {
+				if j != i {
+					immigrants[j] = append(immigrants[j], emigrants[i]...)
+				}
+			}
+		case TopologyRandom:
+			j := o.rng.Intn(n - 1)
+			if j >= i {
+				j++
+			}
+			immigrants[j] = append(immigrants[j], emigrants[i]...)
+		}
+	}
+	for i, island := range o.islands {
+		genomes, arrivals := island.genomes, immigrants[i]
+		if len(arrivals) > len(genomes) {
+			arrivals = arrivals[:len(genomes)]
+		}
+		copy(genomes[len(genomes)-len(arrivals):], arrivals)
+		island.order(genomes)
+	}
+}
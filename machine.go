@@ -0,0 +1,225 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// DefaultBackend is the backend used when none is specified
+const DefaultBackend = "sparse64"
+
+// Matrix is a gate matrix of any precision or storage
+type Matrix interface {
+	// Dims returns the dimensions of the matrix
+	Dims() (r, c int)
+	// At returns the value at row i and column j
+	At(i, j int) complex128
+}
+
+var (
+	_ Matrix = (*Dense64)(nil)
+	_ Matrix = (*Dense128)(nil)
+	_ Matrix = (*Sparse64)(nil)
+	_ Matrix = (*Sparse128)(nil)
+	_ Matrix = (*Matrix128)(nil)
+)
+
+// Machine is a quantum computer simulator. The two qubit gates, such as ISwap
+// and RXX, leave the state unchanged if their qubits are not distinct qubits
+// of the machine, as ApplyUnitary does.
+type Machine interface {
+	// Zero adds a zero qubit to the machine
+	Zero() Qubit
+	// One adds a one qubit to the machine
+	One() Qubit
+	// Width is the number of qubits in the machine
+	Width() int
+	// State returns the state vector of the machine
+	State() Vector128
+	// Probabilities returns the probability of each basis state
+	Probabilities() []float64
+	// Amplitude returns the amplitude of the basis state given as a bitstring
+	// with qubit 0 first
+	Amplitude(bitstring string) complex128
+	// Norm returns the euclidean norm of the state of the machine
+	Norm() float64
+	// StateString formats the state of the machine in Dirac notation
+	StateString() string
+	// I multiply by identity
+	I(qubits ...Qubit) Machine
+	// H multiply by Hadamard gate
+	H(qubits ...Qubit) Machine
+	// X multiply by Pauli X matrix
+	X(qubits ...Qubit) Machine
+	// Y multiply by Pauli Y matrix
+	Y(qubits ...Qubit) Machine
+	// Z multiply by Pauli Z matrix
+	Z(qubits ...Qubit) Machine
+	// S multiply by phase matrix
+	S(qubits ...Qubit) Machine
+	// T multiply by T matrix
+	T(qubits ...Qubit) Machine
+	// U multiply by U matrix
+	U(theta, phi, lambda float64, qubits ...Qubit) Machine
+	// RX rotate X gate
+	RX(theta float64, qubits ...Qubit) Machine
+	// RY rotate Y gate
+	RY(theta float64, qubits ...Qubit) Machine
+	// RZ rotate Z gate
+	RZ(theta float64, qubits ...Qubit) Machine
+	// SX multiply by square root of X matrix
+	SX(qubits ...Qubit) Machine
+	// SXdg multiply by inverse square root of X matrix
+	SXdg(qubits ...Qubit) Machine
+	// Sdg multiply by inverse phase matrix
+	Sdg(qubits ...Qubit) Machine
+	// Tdg multiply by inverse T matrix
+	Tdg(qubits ...Qubit) Machine
+	// P multiply by phase matrix with angle lambda
+	P(lambda float64, qubits ...Qubit) Machine
+	// U1 multiply by U1 matrix, an alias for P
+	U1(lambda float64, qubits ...Qubit) Machine
+	// U2 multiply by U2 matrix, an alias for U with theta pi/2
+	U2(phi, lambda float64, qubits ...Qubit) Machine
+	// U3 multiply by U3 matrix, an alias for U
+	U3(theta, phi, lambda float64, qubits ...Qubit) Machine
+	// Swap swaps qubits
+	Swap(qubits ...Qubit) Machine
+	// ISwap iSWAP gate
+	ISwap(q0, q1 Qubit) Machine
+	// SqrtSwap square root of swap gate
+	SqrtSwap(q0, q1 Qubit) Machine
+	// RXX XX rotation gate
+	RXX(theta float64, q0, q1 Qubit) Machine
+	// RYY YY rotation gate
+	RYY(theta float64, q0, q1 Qubit) Machine
+	// RZZ ZZ rotation gate
+	RZZ(theta float64, q0, q1 Qubit) Machine
+	// ECR echoed cross resonance gate
+	ECR(q0, q1 Qubit) Machine
+	// ControlledNot controlled not gate, the state is unchanged if the target
+	// is one of the controls
+	ControlledNot(c []Qubit, t Qubit) Machine
+	// Controlled multiplies the target by a matrix when the controls are one,
+	// the state is unchanged if the target is one of the controls
+	Controlled(gate Matrix, c []Qubit, t Qubit) Machine
+	// CZ controlled Pauli Z gate
+	CZ(c []Qubit, t Qubit) Machine
+	// CH controlled Hadamard gate
+	CH(c []Qubit, t Qubit) Machine
+	// CU controlled U gate
+	CU(theta, phi, lambda float64, c []Qubit, t Qubit) Machine
+	// CRX controlled rotate X gate
+	CRX(theta float64, c []Qubit, t Qubit) Machine
+	// CRY controlled rotate Y gate
+	CRY(theta float64, c []Qubit, t Qubit) Machine
+	// CRZ controlled rotate Z gate
+	CRZ(theta float64, c []Qubit, t Qubit) Machine
+	// CPhase controlled phase gate
+	CPhase(lambda float64, c []Qubit, t Qubit) Machine
+	// Toffoli controlled controlled not gate
+	Toffoli(c0, c1, t Qubit) Machine
+	// Fredkin controlled swap gate
+	Fredkin(c, t0, t1 Qubit) Machine
+	// ApplyUnitary multiplies the qubits by a unitary matrix, the first qubit
+	// is the most significant bit of the matrix index
+	ApplyUnitary(u Matrix, qubits ...Qubit) error
+	// Measure measures the qubits, collapsing the state of the machine
+	Measure(rng *rand.Rand, qubits ...Qubit) []bool
+	// MeasureAll measures all of the qubits, collapsing the state of the machine
+	MeasureAll(rng *rand.Rand) []bool
+	// Sample draws shots measurements of all of the qubits without collapsing
+	// the state of the machine
+	Sample(shots int, rng *rand.Rand) map[string]int
+}
+
+var (
+	_ Machine = (*MachineDense64)(nil)
+	_ Machine = (*MachineDense128)(nil)
+	_ Machine = (*MachineSparse64)(nil)
+	_ Machine = (*MachineSparse128)(nil)
+	_ Machine = (*MachineMatrix128)(nil)
+	_ Machine = (*MachineVector64)(nil)
+	_ Machine = (*MachineVector128)(nil)
+)
+
+// backendsMutex guards backends, which are read concurrently by optimizers
+var backendsMutex sync.RWMutex
+
+// backends are the machine constructors keyed by backend name
+var backends = map[string]func() Machine{
+	"dense64": func() Machine {
+		return &MachineDense64{}
+	},
+	"dense128": func() Machine {
+		return &MachineDense128{}
+	},
+	"sparse64": func() Machine {
+		return &MachineSparse64{}
+	},
+	"sparse128": func() Machine {
+		return &MachineSparse128{}
+	},
+	"matrix128": func() Machine {
+		return &MachineMatrix128{}
+	},
+	"vector64": func() Machine {
+		return &MachineVector64{}
+	},
+	"vector128": func() Machine {
+		return &MachineVector128{}
+	},
+}
+
+// Register registers a machine constructor under a backend name
+func Register(backend string, constructor func() Machine) {
+	if constructor == nil {
+		panic("nil machine constructor")
+	}
+	backendsMutex.Lock()
+	defer backendsMutex.Unlock()
+	backends[backend] = constructor
+}
+
+// Backends returns the names of the registered backends
+func Backends() []string {
+	backendsMutex.RLock()
+	defer backendsMutex.RUnlock()
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewMachine creates an empty machine for the named backend
+func NewMachine(backend string) (Machine, error) {
+	if backend == "" {
+		backend = DefaultBackend
+	}
+	backendsMutex.RLock()
+	constructor, ok := backends[backend]
+	backendsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %s", backend)
+	}
+	return constructor(), nil
+}
+
+// controlsTarget returns true if the target of a controlled gate is one of its
+// controls
+func controlsTarget(c []Qubit, t Qubit) bool {
+	for _, qubit := range c {
+		if qubit == t {
+			return true
+		}
+	}
+	return false
+}
@@ -41,6 +41,16 @@ func (a Matrix128) String() string {
 	return output
 }
 
+// Dims returns the dimensions of the matrix
+func (a *Matrix128) Dims() (r, c int) {
+	return a.R, a.C
+}
+
+// At returns the value at row i and column j
+func (a *Matrix128) At(i, j int) complex128 {
+	return a.Get(i, j)
+}
+
 // Vector128 is a 128 bit vector
 type Vector128 []complex128
 
@@ -121,6 +131,13 @@ func (a *MachineMatrix128) One() Qubit {
 	return qubit
 }
 
+// State returns the state vector of the machine
+func (a *MachineMatrix128) State() Vector128 {
+	state := make(Vector128, len(a.Vector128))
+	copy(state, a.Vector128)
+	return state
+}
+
 // Tensor product is the tensor product
 func (a *Matrix128) Tensor(b *Matrix128) *Matrix128 {
 	output := make([]interface{}, a.R*b.R)
@@ -265,53 +282,53 @@ func (a *Matrix128) Tensor(b *Matrix128) *Matrix128 {
 				case []complex128:
 					switch rowB := yy.(type) {
 					case []complex128:
+						row := make(map[int]complex128)
 						for i, ii := range rowA {
 							for j, jj := range rowB {
-								row := make(map[int]complex128)
 								value := ii * jj
 								if value != 0 {
 									row[i*b.C+j] = value
 								}
-								output[x*b.R+y] = row
 							}
 						}
+						output[x*b.R+y] = row
 					case map[int]complex128:
+						row := make(map[int]complex128)
 						for i, ii := range rowA {
 							for j, jj := range rowB {
-								row := make(map[int]complex128)
 								value := ii * jj
 								if value != 0 {
 									row[i*b.C+j] = value
 								}
-								output[x*b.R+y] = row
 							}
 						}
+						output[x*b.R+y] = row
 					default:
 					}
 				case map[int]complex128:
 					switch rowB := yy.(type) {
 					case []complex128:
+						row := make(map[int]complex128)
 						for i, ii := range rowA {
 							for j, jj := range rowB {
-								row := make(map[int]complex128)
 								value := ii * jj
 								if value != 0 {
 									row[i*b.C+j] = value
 								}
-								output[x*b.R+y] = row
 							}
 						}
+						output[x*b.R+y] = row
 					case map[int]complex128:
+						row := make(map[int]complex128)
 						for i, ii := range rowA {
 							for j, jj := range rowB {
-								row := make(map[int]complex128)
 								value := ii * jj
 								if value != 0 {
 									row[i*b.C+j] = value
 								}
-								output[x*b.R+y] = row
 							}
 						}
+						output[x*b.R+y] = row
 					default:
 					}
 				default:
@@ -440,9 +457,9 @@ func (a *Matrix128) MultiplyVector(b Vector128) Vector128 {
 	return output
 }
 
-// ControlledNot controlled not gate
-func (a *MachineMatrix128) ControlledNot(c []Qubit, t Qubit) *Matrix128 {
-	n := a.Qubits
+// ControlledNotMatrix128 controlled not matrix for n qubits
+func ControlledNotMatrix128(n int, c []Qubit, t Qubit) *Matrix128 {
+	identity := controlsTarget(c, t)
 	p := &Matrix128{
 		R: 2,
 		C: 2,
@@ -466,7 +483,7 @@ func (a *MachineMatrix128) ControlledNot(c []Qubit, t Qubit) *Matrix128 {
 		bits := int64(i)
 
 		// Apply X
-		apply := true
+		apply := !identity
 		for _, j := range c {
 			if (bits>>(Qubit(n-1)-j))&1 == 0 {
 				apply = false
@@ -494,11 +511,16 @@ func (a *MachineMatrix128) ControlledNot(c []Qubit, t Qubit) *Matrix128 {
 		g.Matrix[i] = q.Matrix[int(ii)]
 	}
 
-	a.Vector128 = g.MultiplyVector(a.Vector128)
-
 	return &g
 }
 
+// ControlledNot controlled not gate
+func (a *MachineMatrix128) ControlledNot(c []Qubit, t Qubit) Machine {
+	g := ControlledNotMatrix128(a.Qubits, c, t)
+	a.Vector128 = g.MultiplyVector(a.Vector128)
+	return a
+}
+
 // Multiply multiplies the machine by a matrix
 func (a *MachineMatrix128) Multiply(b *Matrix128, qubits ...Qubit) {
 	indexes := make(map[int]bool)
@@ -540,7 +562,7 @@ func IMatrix128() *Matrix128 {
 }
 
 // I multiply by identity
-func (a *MachineMatrix128) I(qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) I(qubits ...Qubit) Machine {
 	a.Multiply(IMatrix128(), qubits...)
 	return a
 }
@@ -565,7 +587,7 @@ func HMatrix128() *Matrix128 {
 }
 
 // H multiply by Hadamard gate
-func (a *MachineMatrix128) H(qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) H(qubits ...Qubit) Machine {
 	a.Multiply(HMatrix128(), qubits...)
 	return a
 }
@@ -587,7 +609,7 @@ func XMatrix128() *Matrix128 {
 }
 
 // X multiply by Pauli X matrix
-func (a *MachineMatrix128) X(qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) X(qubits ...Qubit) Machine {
 	a.Multiply(XMatrix128(), qubits...)
 	return a
 }
@@ -609,7 +631,7 @@ func YMatrix128() *Matrix128 {
 }
 
 // Y multiply by Pauli Y matrix
-func (a *MachineMatrix128) Y(qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) Y(qubits ...Qubit) Machine {
 	a.Multiply(YMatrix128(), qubits...)
 	return a
 }
@@ -631,7 +653,7 @@ func ZMatrix128() *Matrix128 {
 }
 
 // Z multiply by Pauli Z matrix
-func (a *MachineMatrix128) Z(qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) Z(qubits ...Qubit) Machine {
 	a.Multiply(ZMatrix128(), qubits...)
 	return a
 }
@@ -653,7 +675,7 @@ func SMatrix128() *Matrix128 {
 }
 
 // S multiply by phase matrix
-func (a *MachineMatrix128) S(qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) S(qubits ...Qubit) Machine {
 	a.Multiply(SMatrix128(), qubits...)
 	return a
 }
@@ -675,7 +697,7 @@ func TMatrix128() *Matrix128 {
 }
 
 // T multiply by T matrix
-func (a *MachineMatrix128) T(qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) T(qubits ...Qubit) Machine {
 	a.Multiply(TMatrix128(), qubits...)
 	return a
 }
@@ -700,7 +722,7 @@ func UMatrix128(theta, phi, lambda float64) *Matrix128 {
 }
 
 // U multiply by U matrix
-func (a *MachineMatrix128) U(theta, phi, lambda float64, qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) U(theta, phi, lambda float64, qubits ...Qubit) Machine {
 	a.Multiply(UMatrix128(theta, phi, lambda), qubits...)
 	return a
 }
@@ -724,7 +746,7 @@ func RXMatrix128(theta complex128) *Matrix128 {
 }
 
 // RX rotate X gate
-func (a *MachineMatrix128) RX(theta float64, qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) RX(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RXMatrix128(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -748,7 +770,7 @@ func RYMatrix128(theta complex128) *Matrix128 {
 }
 
 // RY rotate Y gate
-func (a *MachineMatrix128) RY(theta float64, qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) RY(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RYMatrix128(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -760,23 +782,23 @@ func RZMatrix128(theta complex128) *Matrix128 {
 		C: 2,
 		Matrix: []interface{}{
 			map[int]complex128{
-				0: cmplx.Exp(-1 * theta),
+				0: cmplx.Exp(-1i * theta),
 			},
 			map[int]complex128{
-				1: cmplx.Exp(theta),
+				1: cmplx.Exp(1i * theta),
 			},
 		},
 	}
 }
 
 // RZ rotate Z gate
-func (a *MachineMatrix128) RZ(theta float64, qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) RZ(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RZMatrix128(complex(theta/2, 0)), qubits...)
 	return a
 }
 
 // Swap swaps qubits`
-func (a *MachineMatrix128) Swap(qubits ...Qubit) *MachineMatrix128 {
+func (a *MachineMatrix128) Swap(qubits ...Qubit) Machine {
 	length := len(qubits)
 
 	for i := 0; i < length/2; i++ {
@@ -788,3 +810,286 @@ func (a *MachineMatrix128) Swap(qubits ...Qubit) *MachineMatrix128 {
 
 	return a
 }
+
+// PMatrix128 phase matrix
+func PMatrix128(lambda float64) *Matrix128 {
+	return &Matrix128{
+		R: 2,
+		C: 2,
+		Matrix: []interface{}{
+			map[int]complex128{
+				0: 1,
+			},
+			map[int]complex128{
+				1: cmplx.Exp(complex(0, lambda)),
+			},
+		},
+	}
+}
+
+// SXMatrix128 square root of X matrix
+func SXMatrix128() *Matrix128 {
+	return &Matrix128{
+		R: 2,
+		C: 2,
+		Matrix: []interface{}{
+			map[int]complex128{
+				0: complex(.5, .5),
+				1: complex(.5, -.5),
+			},
+			map[int]complex128{
+				0: complex(.5, -.5),
+				1: complex(.5, .5),
+			},
+		},
+	}
+}
+
+// SXdgMatrix128 inverse square root of X matrix
+func SXdgMatrix128() *Matrix128 {
+	return &Matrix128{
+		R: 2,
+		C: 2,
+		Matrix: []interface{}{
+			map[int]complex128{
+				0: complex(.5, -.5),
+				1: complex(.5, .5),
+			},
+			map[int]complex128{
+				0: complex(.5, .5),
+				1: complex(.5, -.5),
+			},
+		},
+	}
+}
+
+// SdgMatrix128 inverse phase gate
+func SdgMatrix128() *Matrix128 {
+	return &Matrix128{
+		R: 2,
+		C: 2,
+		Matrix: []interface{}{
+			map[int]complex128{
+				0: 1,
+			},
+			map[int]complex128{
+				1: -1i,
+			},
+		},
+	}
+}
+
+// TdgMatrix128 inverse T gate
+func TdgMatrix128() *Matrix128 {
+	return &Matrix128{
+		R: 2,
+		C: 2,
+		Matrix: []interface{}{
+			map[int]complex128{
+				0: 1,
+			},
+			map[int]complex128{
+				1: cmplx.Exp(-1i * math.Pi / 4),
+			},
+		},
+	}
+}
+
+// ControlledMatrix128 controlled gate matrix for n qubits
+func ControlledMatrix128(n int, gate Matrix, c []Qubit, t Qubit) *Matrix128 {
+	identity := controlsTarget(c, t)
+	if rows, cols := gate.Dims(); rows != 2 || cols != 2 {
+		panic("invalid dimensions")
+	}
+	d := 1 << uint(n)
+	controls, target := 0, 1<<(Qubit(n-1)-t)
+	for _, j := range c {
+		controls |= 1 << (Qubit(n-1) - j)
+	}
+	g := Matrix128{
+		R:      d,
+		C:      d,
+		Matrix: make([]interface{}, d),
+	}
+	for i := 0; i < d; i++ {
+		if identity || i&controls != controls {
+			g.Set(i, i, 1)
+			continue
+		}
+		x := 0
+		if i&target != 0 {
+			x = 1
+		}
+		g.Set(i, i&^target, gate.At(x, 0))
+		g.Set(i, i|target, gate.At(x, 1))
+	}
+	return &g
+}
+
+// Controlled multiplies the target by a matrix when the controls are one
+func (a *MachineMatrix128) Controlled(gate Matrix, c []Qubit, t Qubit) Machine {
+	a.Vector128 = ControlledMatrix128(a.Qubits, gate, c, t).MultiplyVector(a.Vector128)
+	return a
+}
+
+// CZ controlled Pauli Z gate
+func (a *MachineMatrix128) CZ(c []Qubit, t Qubit) Machine {
+	return a.Controlled(ZMatrix128(), c, t)
+}
+
+// CH controlled Hadamard gate
+func (a *MachineMatrix128) CH(c []Qubit, t Qubit) Machine {
+	return a.Controlled(HMatrix128(), c, t)
+}
+
+// CU controlled U gate
+func (a *MachineMatrix128) CU(theta, phi, lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(UMatrix128(theta, phi, lambda), c, t)
+}
+
+// CRX controlled rotate X gate
+func (a *MachineMatrix128) CRX(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RXMatrix128(complex(theta/2, 0)), c, t)
+}
+
+// CRY controlled rotate Y gate
+func (a *MachineMatrix128) CRY(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RYMatrix128(complex(theta/2, 0)), c, t)
+}
+
+// CRZ controlled rotate Z gate
+func (a *MachineMatrix128) CRZ(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RZMatrix128(complex(theta/2, 0)), c, t)
+}
+
+// CPhase controlled phase gate
+func (a *MachineMatrix128) CPhase(lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(PMatrix128(lambda), c, t)
+}
+
+// Toffoli controlled controlled not gate
+func (a *MachineMatrix128) Toffoli(c0, c1, t Qubit) Machine {
+	return a.ControlledNot([]Qubit{c0, c1}, t)
+}
+
+// Fredkin controlled swap gate
+func (a *MachineMatrix128) Fredkin(c, t0, t1 Qubit) Machine {
+	a.ControlledNot([]Qubit{t1}, t0)
+	a.ControlledNot([]Qubit{c, t0}, t1)
+	a.ControlledNot([]Qubit{t1}, t0)
+	return a
+}
+
+// UnitaryMatrix128 unitary matrix applied to qubits of an n qubit machine
+func UnitaryMatrix128(n int, u Matrix, qubits ...Qubit) *Matrix128 {
+	d, s := 1<<uint(n), newSubspace(n, qubits)
+	m := 1 << uint(len(qubits))
+	g := Matrix128{
+		R:      d,
+		C:      d,
+		Matrix: make([]interface{}, d),
+	}
+	for i := 0; i < d; i++ {
+		x, base := s.index(i), i&^s.mask
+		for k := 0; k < m; k++ {
+			g.Set(i, base|s.spread(k), u.At(x, k))
+		}
+	}
+	return &g
+}
+
+// ApplyUnitary multiplies the qubits by a unitary matrix, the first qubit is
+// the most significant bit of the matrix index
+func (a *MachineMatrix128) ApplyUnitary(u Matrix, qubits ...Qubit) error {
+	if err := validate(u, a.Qubits, qubits); err != nil {
+		return err
+	}
+	a.unitary(u, qubits...)
+	return nil
+}
+
+// SX multiply by square root of X matrix
+func (a *MachineMatrix128) SX(qubits ...Qubit) Machine {
+	a.Multiply(SXMatrix128(), qubits...)
+	return a
+}
+
+// SXdg multiply by inverse square root of X matrix
+func (a *MachineMatrix128) SXdg(qubits ...Qubit) Machine {
+	a.Multiply(SXdgMatrix128(), qubits...)
+	return a
+}
+
+// Sdg multiply by inverse phase matrix
+func (a *MachineMatrix128) Sdg(qubits ...Qubit) Machine {
+	a.Multiply(SdgMatrix128(), qubits...)
+	return a
+}
+
+// Tdg multiply by inverse T matrix
+func (a *MachineMatrix128) Tdg(qubits ...Qubit) Machine {
+	a.Multiply(TdgMatrix128(), qubits...)
+	return a
+}
+
+// P multiply by phase matrix with angle lambda
+func (a *MachineMatrix128) P(lambda float64, qubits ...Qubit) Machine {
+	a.Multiply(PMatrix128(lambda), qubits...)
+	return a
+}
+
+// U1 multiply by U1 matrix, an alias for P
+func (a *MachineMatrix128) U1(lambda float64, qubits ...Qubit) Machine {
+	return a.P(lambda, qubits...)
+}
+
+// U2 multiply by U2 matrix, an alias for U with theta pi/2
+func (a *MachineMatrix128) U2(phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(math.Pi/2, phi, lambda, qubits...)
+}
+
+// U3 multiply by U3 matrix, an alias for U
+func (a *MachineMatrix128) U3(theta, phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(theta, phi, lambda, qubits...)
+}
+
+// unitary multiplies the qubits by a matrix without validating it
+func (a *MachineMatrix128) unitary(u Matrix, qubits ...Qubit) {
+	a.Vector128 = UnitaryMatrix128(a.Qubits, u, qubits...).MultiplyVector(a.Vector128)
+}
+
+// ISwap iSWAP gate
+func (a *MachineMatrix128) ISwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ISwapDense128(), q0, q1)
+	return a
+}
+
+// SqrtSwap square root of swap gate
+func (a *MachineMatrix128) SqrtSwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(SqrtSwapDense128(), q0, q1)
+	return a
+}
+
+// RXX XX rotation gate
+func (a *MachineMatrix128) RXX(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RXXDense128(theta), q0, q1)
+	return a
+}
+
+// RYY YY rotation gate
+func (a *MachineMatrix128) RYY(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RYYDense128(theta), q0, q1)
+	return a
+}
+
+// RZZ ZZ rotation gate
+func (a *MachineMatrix128) RZZ(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RZZDense128(theta), q0, q1)
+	return a
+}
+
+// ECR echoed cross resonance gate
+func (a *MachineMatrix128) ECR(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ECRDense128(), q0, q1)
+	return a
+}
@@ -0,0 +1,248 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Bitstring formats a basis state index as a string of qubit values with
+// qubit 0 first
+func Bitstring(index, width int) string {
+	var builder strings.Builder
+	for i := width - 1; i >= 0; i-- {
+		if (index>>i)&1 == 1 {
+			builder.WriteByte('1')
+		} else {
+			builder.WriteByte('0')
+		}
+	}
+	return builder.String()
+}
+
+// sample draws shots basis states from the probability distribution, which is
+// accumulated in place
+func sample(probabilities []float64, width, shots int, rng *rand.Rand) map[string]int {
+	counts := make(map[string]int)
+	if len(probabilities) == 0 || shots <= 0 {
+		return counts
+	}
+	cumulative, sum := probabilities, 0.0
+	for i, probability := range probabilities {
+		sum += probability
+		cumulative[i] = sum
+	}
+	total, last := cumulative[len(cumulative)-1], len(cumulative)-1
+	for i := 0; i < shots; i++ {
+		x := rng.Float64() * total
+		index := sort.Search(len(cumulative), func(i int) bool {
+			return cumulative[i] > x
+		})
+		if index > last {
+			index = last
+		}
+		counts[Bitstring(index, width)]++
+	}
+	return counts
+}
+
+// Marginal sums counts over all but the given qubits, the keys of the result
+// list the given qubits in order
+func Marginal(counts map[string]int, qubits ...Qubit) map[string]int {
+	marginal := make(map[string]int)
+	key := make([]byte, len(qubits))
+	for bitstring, count := range counts {
+		for i, qubit := range qubits {
+			key[i] = bitstring[qubit]
+		}
+		marginal[string(key)] += count
+	}
+	return marginal
+}
+
+// Width is the number of qubits represented by the state vector
+func (a Vector64) Width() int {
+	if len(a) == 0 {
+		return 0
+	}
+	return bits.Len(uint(len(a))) - 1
+}
+
+// Measure measures the qubits, collapsing the state vector. A qubit of a zero
+// state vector measures as zero. Measure panics if a qubit is not in the state
+// vector.
+func (a Vector64) Measure(rng *rand.Rand, qubits ...Qubit) []bool {
+	n := a.Width()
+	results := make([]bool, 0, len(qubits))
+	for _, qubit := range qubits {
+		if int(qubit) >= n {
+			panic(fmt.Sprintf("qubit %d is not in a state of %d qubits", qubit, n))
+		}
+		mask := 1 << (Qubit(n-1) - qubit)
+		total, one := 0.0, 0.0
+		for i, value := range a {
+			p := float64(real(value)*real(value) + imag(value)*imag(value))
+			total += p
+			if i&mask != 0 {
+				one += p
+			}
+		}
+		if total == 0 {
+			results = append(results, false)
+			continue
+		}
+		result := rng.Float64()*total < one
+		if result && one == 0 {
+			result = false
+		} else if !result && one == total {
+			result = true
+		}
+		p := total - one
+		if result {
+			p = one
+		}
+		scale := complex64(complex(1/math.Sqrt(p), 0))
+		for i := range a {
+			if (i&mask != 0) == result {
+				a[i] *= scale
+			} else {
+				a[i] = 0
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// MeasureAll measures all of the qubits, collapsing the state vector
+func (a Vector64) MeasureAll(rng *rand.Rand) []bool {
+	qubits := make([]Qubit, a.Width())
+	for i := range qubits {
+		qubits[i] = Qubit(i)
+	}
+	return a.Measure(rng, qubits...)
+}
+
+// Sample draws shots measurements of all of the qubits from the state vector
+// without collapsing it
+func (a Vector64) Sample(shots int, rng *rand.Rand) map[string]int {
+	return sample(a.Probabilities(), a.Width(), shots, rng)
+}
+
+// Width is the number of qubits represented by the state vector
+func (a Vector128) Width() int {
+	if len(a) == 0 {
+		return 0
+	}
+	return bits.Len(uint(len(a))) - 1
+}
+
+// Measure measures the qubits, collapsing the state vector. A qubit of a zero
+// state vector measures as zero. Measure panics if a qubit is not in the state
+// vector.
+func (a Vector128) Measure(rng *rand.Rand, qubits ...Qubit) []bool {
+	n := a.Width()
+	results := make([]bool, 0, len(qubits))
+	for _, qubit := range qubits {
+		if int(qubit) >= n {
+			panic(fmt.Sprintf("qubit %d is not in a state of %d qubits", qubit, n))
+		}
+		mask := 1 << (Qubit(n-1) - qubit)
+		total, one := 0.0, 0.0
+		for i, value := range a {
+			p := real(value)*real(value) + imag(value)*imag(value)
+			total += p
+			if i&mask != 0 {
+				one += p
+			}
+		}
+		if total == 0 {
+			results = append(results, false)
+			continue
+		}
+		result := rng.Float64()*total < one
+		if result && one == 0 {
+			result = false
+		} else if !result && one == total {
+			result = true
+		}
+		p := total - one
+		if result {
+			p = one
+		}
+		scale := complex(1/math.Sqrt(p), 0)
+		for i := range a {
+			if (i&mask != 0) == result {
+				a[i] *= scale
+			} else {
+				a[i] = 0
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// MeasureAll measures all of the qubits, collapsing the state vector
+func (a Vector128) MeasureAll(rng *rand.Rand) []bool {
+	qubits := make([]Qubit, a.Width())
+	for i := range qubits {
+		qubits[i] = Qubit(i)
+	}
+	return a.Measure(rng, qubits...)
+}
+
+// Sample draws shots measurements of all of the qubits from the state vector
+// without collapsing it
+func (a Vector128) Sample(shots int, rng *rand.Rand) map[string]int {
+	return sample(a.Probabilities(), a.Width(), shots, rng)
+}
+
+// Width is the number of qubits in the machine
+func (a *MachineDense64) Width() int {
+	return a.Qubits
+}
+
+// Measure measures the qubits, collapsing the state of the machine
+func (a *MachineDense64) Measure(rng *rand.Rand, qubits ...Qubit) []bool {
+	return Vector64(a.Matrix).Measure(rng, qubits...)
+}
+
+// MeasureAll measures all of the qubits, collapsing the state of the machine
+func (a *MachineDense64) MeasureAll(rng *rand.Rand) []bool {
+	return Vector64(a.Matrix).MeasureAll(rng)
+}
+
+// Sample draws shots measurements of all of the qubits without collapsing the
+// state of the machine
+func (a *MachineDense64) Sample(shots int, rng *rand.Rand) map[string]int {
+	return Vector64(a.Matrix).Sample(shots, rng)
+}
+
+// Width is the number of qubits in the machine
+func (a *MachineDense128) Width() int {
+	return a.Qubits
+}
+
+// Measure measures the qubits, collapsing the state of the machine
+func (a *MachineDense128) Measure(rng *rand.Rand, qubits ...Qubit) []bool {
+	return Vector128(a.Matrix).Measure(rng, qubits...)
+}
+
+// MeasureAll measures all of the qubits, collapsing the state of the machine
+func (a *MachineDense128) MeasureAll(rng *rand.Rand) []bool {
+	return Vector128(a.Matrix).MeasureAll(rng)
+}
+
+// Sample draws shots measurements of all of the qubits without collapsing the
+// state of the machine
+func (a *MachineDense128) Sample(shots int, rng *rand.Rand) map[string]int {
+	return Vector128(a.Matrix).Sample(shots, rng)
+}
@@ -0,0 +1,737 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// GateWeight is the relative frequency of a gate type in random circuits
+type GateWeight struct {
+	GateType GateType
+	Weight   int
+}
+
+// OptimizerOptions are the options of the genetic optimizer
+type OptimizerOptions struct {
+	// Backend is the simulator backend genomes are executed on
+	Backend string
+	// Population is the number of genomes that survive each generation
+	Population int
+	// Generations is the maximum number of generations
+	Generations int
+	// Crossovers is the number of crossovers per generation, each producing
+	// two children
+	Crossovers int
+	// Crossover is the crossover operator
+	Crossover Crossover
+	// Selection is the parent selection strategy
+	Selection Selection
+	// Parents is the number of fittest genomes crossover parents are drawn from
+	// by truncation selection
+	Parents int
+	// TournamentSize is the number of genomes competing in tournament selection
+	TournamentSize int
+	// Elitism is the number of fittest genomes, at most the population, that
+	// survive into the next generation alongside the children and mutants
+	Elitism int
+	// MutationRate is the probability of a genome producing a mutant
+	MutationRate float64
+	// MinDepth and MaxDepth bound the number of gates of genomes if MaxDepth
+	// is positive, otherwise genomes have a fixed number of gates
+	MinDepth, MaxDepth int
+	// Insertion, Deletion and Duplication are the probabilities of a mutation
+	// inserting a random gate, deleting a gate or duplicating a gate instead of
+	// replacing a gate
+	Insertion, Deletion, Duplication float64
+	// Parsimony is added to the fitness for each gate when ranking genomes,
+	// genomes of equal rank are ranked by their number of gates. It is not
+	// used by multi-objective optimization, where the number of gates is an
+	// objective.
+	Parsimony float64
+	// Gates are the gate types of random circuits and their frequencies
+	Gates []GateWeight
+	// MaxControls is the maximum number of controls of a controlled gate
+	MaxControls int
+	// MaxQubits is the maximum number of qubits a single qubit gate is applied to
+	MaxQubits int
+	// Theta, Phi and Lambda are the ranges random angles are drawn from
+	Theta, Phi, Lambda [2]float64
+	// Seed seeds the random number generator if Rand is nil
+	Seed int64
+	// Rand is the random number generator
+	Rand *rand.Rand
+	// FitnessFunction scores genomes, BitError if nil
+	FitnessFunction FitnessFunction
+	// Refinements is the number of fittest genomes whose angles are refined
+	// each generation, see Genome.Refine. A genome is refined once, until it
+	// is changed by crossover or mutation.
+	Refinements int
+	// RefinementEvaluations is the maximum number of executions of a genome
+	// during its refinement
+	RefinementEvaluations int
+	// MultiObjective ranks genomes by non-domination over their objectives and
+	// then by crowding distance, as in NSGA-II. The best genome is taken from
+	// the first front.
+	MultiObjective bool
+	// Target stops the optimization once the best fitness is at most the target
+	Target float64
+	// Workers is the number of goroutines genomes are evaluated with
+	Workers int
+	// Islands is the number of populations evolving in parallel
+	Islands int
+	// MigrationInterval is the number of generations between migrations
+	// of the fittest genomes between the islands
+	MigrationInterval int
+	// Migrants is the number of fittest genomes migrating from each island,
+	// replacing the least fit genomes of the destination islands
+	Migrants int
+	// Topology determines the destination islands of migrations
+	Topology Topology
+	// Observer is called after each generation if it is not nil
+	Observer Observer
+	// Checkpoint is the file the state of the optimization is written to
+	// every CheckpointInterval generations if it is not empty
+	Checkpoint         string
+	CheckpointInterval int
+}
+
+// Observer observes the fittest genome of each generation of an optimization
+type Observer func(generation int, fitness float64, best *Genome)
+
+// NewOptimizerOptions returns the default options of the genetic optimizer
+func NewOptimizerOptions() *OptimizerOptions {
+	return &OptimizerOptions{
+		Backend:      DefaultBackend,
+		Population:   100,
+		Generations:  100,
+		Crossovers:   10,
+		Parents:      10,
+		Elitism:      100,
+		MutationRate: 1,
+		Gates: []GateWeight{
+			{GateTypeControlledNot, 5},
+			{GateTypeI, 2},
+			{GateTypeH, 1},
+			{GateTypeX, 1},
+			{GateTypeY, 1},
+			{GateTypeZ, 1},
+			{GateTypeS, 1},
+			{GateTypeT, 1},
+			{GateTypeU, 1},
+			{GateTypeRX, 1},
+			{GateTypeRY, 1},
+			{GateTypeRZ, 1},
+		},
+		MaxControls: 2,
+		MaxQubits:   2,
+		Theta:       [2]float64{0, 4 * math.Pi},
+		Phi:         [2]float64{0, 1},
+		Lambda:      [2]float64{0, 1},
+		Seed:        1,
+		Workers:     runtime.NumCPU(),
+
+		TournamentSize:        3,
+		Islands:               1,
+		MigrationInterval:     10,
+		Migrants:              2,
+		RefinementEvaluations: 100,
+		CheckpointInterval:    10,
+	}
+}
+
+// Statistics are the fitness statistics of a generation
+type Statistics struct {
+	Best  float64 `json:"best"`
+	Mean  float64 `json:"mean"`
+	Worst float64 `json:"worst"`
+}
+
+// Result is the result of an optimization
+type Result struct {
+	// Best is the fittest genome found
+	Best Genome
+	// Statistics are the fitness statistics of each generation
+	Statistics []Statistics
+	// Generations is the number of generations evaluated
+	Generations int
+	// Duration is the wall time of the optimization
+	Duration time.Duration
+	// Front is the Pareto front of the last generation of a multi-objective
+	// optimization
+	Front []Genome
+}
+
+// operands returns the minimum number of qubits of a randomly generated gate
+func operands(gateType GateType) (int, error) {
+	switch gateType {
+	case GateTypeI, GateTypeH, GateTypeX, GateTypeY, GateTypeZ, GateTypeS, GateTypeT,
+		GateTypeU, GateTypeRX, GateTypeRY, GateTypeRZ, GateTypeSX, GateTypeSXdg,
+		GateTypeSdg, GateTypeTdg, GateTypeP, GateTypeU1, GateTypeU2, GateTypeU3,
+		GateTypeControlledNot, GateTypeCZ, GateTypeCH, GateTypeCU, GateTypeCRX,
+		GateTypeCRY, GateTypeCRZ, GateTypeCPhase:
+		return 1, nil
+	case GateTypeSwap, GateTypeISwap, GateTypeSqrtSwap, GateTypeRXX, GateTypeRYY,
+		GateTypeRZZ, GateTypeECR:
+		return 2, nil
+	case GateTypeCSwap:
+		return 3, nil
+	}
+	return 0, fmt.Errorf("%s gates can not be optimized", gateType)
+}
+
+// Validate checks the options for a circuit of width qubits
+func (o *OptimizerOptions) Validate(width int) error {
+	if _, err := NewMachine(o.Backend); err != nil {
+		return err
+	}
+	if o.Population <= 0 {
+		return errors.New("population must be positive")
+	}
+	if o.Generations <= 0 {
+		return errors.New("generations must be positive")
+	}
+	if o.Crossovers < 0 {
+		return errors.New("crossovers must not be negative")
+	}
+	if o.Crossover < CrossoverSwap || o.Crossover > CrossoverLayer {
+		return fmt.Errorf("unknown crossover %d", o.Crossover)
+	}
+	switch o.Selection {
+	case SelectionTruncation:
+		if o.Crossovers > 0 && o.Parents <= 0 {
+			return errors.New("parents must be positive")
+		}
+	case SelectionTournament:
+		if o.TournamentSize <= 0 {
+			return errors.New("tournament size must be positive")
+		}
+	case SelectionRoulette:
+	default:
+		return fmt.Errorf("unknown selection %d", o.Selection)
+	}
+	if o.Elitism < 0 {
+		return errors.New("elitism must not be negative")
+	}
+	if o.MutationRate < 0 || o.MutationRate > 1 {
+		return errors.New("mutation rate must be between 0 and 1")
+	}
+	if o.MaxDepth > 0 && (o.MinDepth < 1 || o.MinDepth > o.MaxDepth) {
+		return fmt.Errorf("minimum depth must be between 1 and %d", o.MaxDepth)
+	}
+	if o.Insertion < 0 || o.Deletion < 0 || o.Duplication < 0 ||
+		o.Insertion+o.Deletion+o.Duplication > 1 {
+		return errors.New("insertion, deletion and duplication rates must sum to between 0 and 1")
+	}
+	if o.Parsimony < 0 {
+		return errors.New("parsimony must not be negative")
+	}
+	if o.Workers <= 0 {
+		return errors.New("workers must be positive")
+	}
+	if o.Refinements < 0 || o.RefinementEvaluations < 0 {
+		return errors.New("refinements must not be negative")
+	}
+	if o.Islands <= 0 {
+		return errors.New("islands must be positive")
+	}
+	if o.Islands > 1 {
+		if o.MigrationInterval <= 0 {
+			return errors.New("migration interval must be positive")
+		}
+		if o.Migrants < 0 {
+			return errors.New("migrants must not be negative")
+		}
+		if o.Topology < TopologyRing || o.Topology > TopologyRandom {
+			return fmt.Errorf("unknown topology %d", o.Topology)
+		}
+	}
+	if o.Checkpoint != "" {
+		if err := o.checkpoints(); err != nil {
+			return err
+		}
+	}
+	if o.MaxControls < 0 || o.MaxQubits < 0 {
+		return errors.New("qubit limits must not be negative")
+	}
+	total := 0
+	for _, weight := range o.Gates {
+		n, err := operands(weight.GateType)
+		if err != nil {
+			return err
+		}
+		if n > width {
+			return fmt.Errorf("%s gates require %d qubits", weight.GateType, n)
+		}
+		if weight.Weight < 0 {
+			return fmt.Errorf("%s has a negative weight", weight.GateType)
+		}
+		total += weight.Weight
+	}
+	if total == 0 {
+		return errors.New("no gates to optimize")
+	}
+	return nil
+}
+
+// checkpoints validates the options of an optimization that is checkpointed
+// or resumed from a checkpoint
+func (o *OptimizerOptions) checkpoints() error {
+	if o.Rand != nil {
+		return errors.New("checkpoints require a seeded random number generator")
+	}
+	if o.Islands > 1 {
+		return errors.New("checkpoints are not supported with islands")
+	}
+	if o.CheckpointInterval <= 0 {
+		return errors.New("checkpoint interval must be positive")
+	}
+	return nil
+}
+
+// optimizer is a genetic optimizer of circuits
+type optimizer struct {
+	*OptimizerOptions
+	rng           *rand.Rand
+	source        *source
+	width, depth  int
+	probabilities [][2][]float64
+	total         int
+
+	genomes    []Genome
+	islands    []*optimizer
+	evaluated  int
+	generation int
+	result     *Result
+	elapsed    time.Duration
+}
+
+// newOptimizer creates a genetic optimizer
+func newOptimizer(width, depth int, probabilities [][2][]float64, options *OptimizerOptions) (*optimizer, error) {
+	if width <= 0 || depth <= 0 {
+		return nil, errors.New("width and depth must be positive")
+	}
+	if err := options.Validate(width); err != nil {
+		return nil, err
+	}
+	if err := pairs(probabilities, width); err != nil {
+		return nil, err
+	}
+	if options.MaxDepth > 0 && (depth < options.MinDepth || depth > options.MaxDepth) {
+		return nil, fmt.Errorf("depth must be between %d and %d", options.MinDepth, options.MaxDepth)
+	}
+	o := &optimizer{
+		OptimizerOptions: options,
+		rng:              options.Rand,
+		width:            width,
+		depth:            depth,
+		probabilities:    probabilities,
+	}
+	if o.rng == nil {
+		o.source = newSource(options.Seed)
+		o.rng = rand.New(o.source)
+	}
+	for _, weight := range options.Gates {
+		o.total += weight.Weight
+	}
+	return o, nil
+}
+
+// qubit returns a random qubit not in qubits
+func (o *optimizer) qubit(qubits []Qubit) Qubit {
+	qubit := Qubit(0)
+	for {
+		qubit = Qubit(o.rng.Intn(o.width))
+		contains := false
+		for _, value := range qubits {
+			if value == qubit {
+				contains = true
+			}
+		}
+		if !contains {
+			break
+		}
+	}
+	return qubit
+}
+
+// qubits returns up to max distinct random qubits, leaving free qubits
+// unused
+func (o *optimizer) qubits(max, free int) []Qubit {
+	if max > o.width-free {
+		max = o.width - free
+	}
+	var qubits []Qubit
+	q := o.rng.Intn(max + 1)
+	for k := 0; k < q; k++ {
+		qubits = append(qubits, o.qubit(qubits))
+	}
+	return qubits
+}
+
+// angle returns a random angle in the interval
+func (o *optimizer) angle(interval [2]float64) float64 {
+	return interval[0] + (interval[1]-interval[0])*o.rng.Float64()
+}
+
+// gate returns a random gate
+func (o *optimizer) gate() Gate {
+	gate := Gate{}
+	n := o.rng.Intn(o.total)
+	for _, weight := range o.Gates {
+		if n < weight.Weight {
+			gate.GateType = weight.GateType
+			break
+		}
+		n -= weight.Weight
+	}
+	switch gate.GateType {
+	case GateTypeControlledNot, GateTypeCZ, GateTypeCH, GateTypeCU, GateTypeCRX,
+		GateTypeCRY, GateTypeCRZ, GateTypeCPhase:
+		gate.Qubits = o.qubits(o.MaxControls, 1)
+		gate.Target = o.qubit(gate.Qubits)
+	case GateTypeSwap, GateTypeISwap, GateTypeSqrtSwap, GateTypeRXX, GateTypeRYY,
+		GateTypeRZZ, GateTypeECR:
+		first := o.qubit(nil)
+		gate.Qubits = []Qubit{first, o.qubit([]Qubit{first})}
+	case GateTypeCSwap:
+		for i := 0; i < 3; i++ {
+			gate.Qubits = append(gate.Qubits, o.qubit(gate.Qubits))
+		}
+	default:
+		gate.Qubits = o.qubits(o.MaxQubits, 0)
+	}
+	switch gate.GateType {
+	case GateTypeU, GateTypeU3, GateTypeCU:
+		gate.Theta = o.angle(o.Theta)
+		gate.Lambda = o.angle(o.Lambda)
+		gate.Phi = o.angle(o.Phi)
+	case GateTypeU2:
+		gate.Lambda = o.angle(o.Lambda)
+		gate.Phi = o.angle(o.Phi)
+	case GateTypeP, GateTypeU1, GateTypeCPhase:
+		gate.Lambda = o.angle(o.Lambda)
+	case GateTypeRX, GateTypeRY, GateTypeRZ, GateTypeRXX, GateTypeRYY, GateTypeRZZ,
+		GateTypeCRX, GateTypeCRY, GateTypeCRZ:
+		gate.Theta = o.angle(o.Theta)
+	}
+	return gate
+}
+
+// genome returns a random genome
+func (o *optimizer) genome() Genome {
+	gates := make([]Gate, 0, o.depth)
+	for j := 0; j < o.depth; j++ {
+		gates = append(gates, o.gate())
+	}
+	return Genome{
+		Gates:         gates,
+		Width:         o.width,
+		Probabilities: o.probabilities,
+		Backend:       o.Backend,
+
+		FitnessFunction: o.FitnessFunction,
+	}
+}
+
+// concurrently calls f for each index below n with a pool of workers
+func (o *optimizer) concurrently(n int, f func(i int)) {
+	workers := o.Workers
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+	indexes := make(chan int, n)
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	var wait sync.WaitGroup
+	wait.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wait.Done()
+			for i := range indexes {
+				f(i)
+			}
+		}()
+	}
+	wait.Wait()
+}
+
+// evaluate executes the genomes concurrently, the fitness of each genome only
+// depends on its gates so the results do not depend on the scheduling. It
+// returns the error of the first genome that fails to execute.
+func (o *optimizer) evaluate(genomes []Genome) error {
+	errs := make([]error, len(genomes))
+	o.concurrently(len(genomes), func(i int) {
+		errs[i] = genomes[i].Execute()
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bounds returns the minimum and maximum number of gates of a genome
+func (o *optimizer) bounds() (int, int) {
+	if o.MaxDepth > 0 {
+		return o.MinDepth, o.MaxDepth
+	}
+	return o.depth, o.depth
+}
+
+// mutate replaces, inserts, deletes or duplicates a gate of the genome
+func (o *optimizer) mutate(g *Genome) {
+	min, max := o.bounds()
+	if o.Insertion+o.Deletion+o.Duplication > 0 {
+		r, n := o.rng.Float64(), len(g.Gates)
+		switch {
+		case r < o.Insertion && n < max:
+			i := o.rng.Intn(n + 1)
+			g.Gates = append(g.Gates[:i], append([]Gate{o.gate()}, g.Gates[i:]...)...)
+			return
+		case r >= o.Insertion && r < o.Insertion+o.Deletion && n > min:
+			i := o.rng.Intn(n)
+			g.Gates = append(g.Gates[:i], g.Gates[i+1:]...)
+			return
+		case r >= o.Insertion+o.Deletion && r < o.Insertion+o.Deletion+o.Duplication && n < max:
+			i, j := o.rng.Intn(n), o.rng.Intn(n+1)
+			g.Gates = append(g.Gates[:j], append([]Gate{g.Gates[i].Copy()}, g.Gates[j:]...)...)
+			return
+		}
+	}
+	g.Gates[o.rng.Intn(len(g.Gates))] = o.gate()
+}
+
+// rank returns the fitness of a genome with the parsimony pressure of single
+// objective optimization
+func (o *optimizer) rank(g *Genome) float64 {
+	if o.MultiObjective {
+		return g.Fitness
+	}
+	return g.Fitness + o.Parsimony*float64(len(g.Gates))
+}
+
+// less ranks genome a before genome b
+func (o *optimizer) less(a, b *Genome) bool {
+	ra, rb := o.rank(a), o.rank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	if o.MaxDepth > 0 || o.Parsimony > 0 {
+		return len(a.Gates) < len(b.Gates)
+	}
+	return false
+}
+
+// order ranks the genomes with less, or by non-domination and crowding
+// distance for multi-objective optimization
+func (o *optimizer) order(genomes []Genome) {
+	if o.MultiObjective {
+		nsga(genomes)
+		return
+	}
+	sort.Slice(genomes, func(i, j int) bool {
+		return o.less(&genomes[i], &genomes[j])
+	})
+}
+
+// initialize creates the first generation
+func (o *optimizer) initialize() {
+	o.result = &Result{}
+	if o.Islands > 1 {
+		o.populate()
+		return
+	}
+	o.genomes = make([]Genome, o.Population)
+	for i := range o.genomes {
+		o.genomes[i] = o.genome()
+	}
+}
+
+// breed replaces the population with the elite, the children of crossovers
+// and mutants
+func (o *optimizer) breed() {
+	genomes := o.genomes
+	var weights []float64
+	if o.Selection == SelectionRoulette && o.Crossovers > 0 {
+		weights = o.weights(genomes)
+	}
+	children := make([]Genome, 0, 2*o.Crossovers)
+	for i := 0; i < o.Crossovers; i++ {
+		m1, m2 := o.parent(genomes, weights), o.parent(genomes, weights)
+		c1, c2 := o.crossover(&genomes[m1], &genomes[m2])
+		children = append(children, c1, c2)
+	}
+	elitism := o.Elitism
+	if elitism > len(genomes) {
+		elitism = len(genomes)
+	}
+	next := make([]Genome, 0, elitism+2*len(children)+len(genomes))
+	next = append(next, genomes[:elitism]...)
+	next = append(next, children...)
+	for _, parents := range [][]Genome{genomes, children} {
+		for i := range parents {
+			if o.MutationRate < 1 && o.rng.Float64() >= o.MutationRate {
+				continue
+			}
+			cp := parents[i].Copy()
+			o.mutate(&cp)
+			next = append(next, cp)
+		}
+	}
+	o.genomes, o.evaluated = next, elitism
+}
+
+// survive evaluates the population and keeps the fittest genomes
+func (o *optimizer) survive() error {
+	if err := o.evaluate(o.genomes[o.evaluated:]); err != nil {
+		return err
+	}
+	genomes := o.genomes
+	o.order(genomes)
+	if len(genomes) > o.Population {
+		genomes = genomes[:o.Population]
+	}
+	o.genomes, o.evaluated = genomes, len(genomes)
+	if o.Refinements > 0 {
+		return o.refine()
+	}
+	return nil
+}
+
+// record appends the statistics of the ranked populations to the result and
+// updates the best genome, the smallest genome reaching the target if there
+// is one. The best genome of multi-objective optimization is taken from the
+// first front. It returns true if the target has been reached.
+func (o *optimizer) record(populations ...[]Genome) bool {
+	statistics := Statistics{
+		Best:  math.Inf(1),
+		Worst: math.Inf(-1),
+	}
+	count := 0
+	for _, genomes := range populations {
+		for i := range genomes {
+			fitness := genomes[i].Fitness
+			statistics.Best = math.Min(statistics.Best, fitness)
+			statistics.Worst = math.Max(statistics.Worst, fitness)
+			statistics.Mean += fitness
+			count++
+		}
+	}
+	candidates := populations
+	if o.MultiObjective {
+		o.result.Front = front(populations...)
+		candidates = [][]Genome{o.result.Front}
+	}
+	best := &candidates[0][0]
+	for _, genomes := range candidates {
+		for i := range genomes {
+			reached, target := genomes[i].Fitness <= o.Target, best.Fitness <= o.Target
+			if (reached && !target) || (reached && len(genomes[i].Gates) < len(best.Gates)) ||
+				(!reached && !target && o.less(&genomes[i], best)) {
+				best = &genomes[i]
+			}
+		}
+	}
+	statistics.Mean /= float64(count)
+	o.result.Statistics = append(o.result.Statistics, statistics)
+	o.result.Generations++
+	o.result.Best = best.Copy()
+	o.result.Best.Fitness = best.Fitness
+	return best.Fitness <= o.Target
+}
+
+// optimize runs the genetic optimization until the context is done
+func (o *optimizer) optimize(ctx context.Context) (*Result, error) {
+	start, result, first := time.Now(), o.result, o.generation
+	for ; o.generation < o.Generations; o.generation++ {
+		if err := ctx.Err(); err != nil {
+			result.Duration = o.elapsed + time.Since(start)
+			return result, err
+		}
+		if o.Checkpoint != "" && o.generation != first && o.generation%o.CheckpointInterval == 0 {
+			o.elapsed += time.Since(start)
+			start = time.Now()
+			if err := o.checkpoint(o.Checkpoint); err != nil {
+				result.Duration = o.elapsed
+				return result, err
+			}
+		}
+		var reached bool
+		if len(o.islands) > 0 {
+			if err := o.parallel((*optimizer).survive); err != nil {
+				result.Duration = o.elapsed + time.Since(start)
+				return result, err
+			}
+			populations := make([][]Genome, len(o.islands))
+			for i, island := range o.islands {
+				populations[i] = island.genomes
+			}
+			reached = o.record(populations...)
+		} else {
+			if err := o.survive(); err != nil {
+				result.Duration = o.elapsed + time.Since(start)
+				return result, err
+			}
+			reached = o.record(o.genomes)
+		}
+		if o.Observer != nil {
+			o.Observer(o.generation, result.Best.Fitness, &result.Best)
+		}
+		if reached || o.generation == o.Generations-1 {
+			break
+		}
+		if len(o.islands) > 0 {
+			if (o.generation+1)%o.MigrationInterval == 0 {
+				o.migrate()
+			}
+			o.parallel(func(island *optimizer) error {
+				island.breed()
+				return nil
+			})
+		} else {
+			o.breed()
+		}
+	}
+	result.Duration = o.elapsed + time.Since(start)
+	return result, nil
+}
+
+// OptimizeWithOptions optimizes a circuit of width qubits and depth gates
+// to map the inputs of probabilities to their outputs. If the context is done
+// the result so far is returned with the error of the context.
+func OptimizeWithOptions(ctx context.Context, width, depth int, probabilities [][2][]float64, options *OptimizerOptions) (*Result, error) {
+	o, err := newOptimizer(width, depth, probabilities, options)
+	if err != nil {
+		return nil, err
+	}
+	o.initialize()
+	return o.optimize(ctx)
+}
+
+// Optimize is an implementation of genetic optimize
+func Optimize(ctx context.Context, backend string, width, depth int, probabilities [][2][]float64, observer Observer) (*Result, error) {
+	options := NewOptimizerOptions()
+	options.Backend = backend
+	options.Observer = observer
+	return OptimizeWithOptions(ctx, width, depth, probabilities, options)
+}
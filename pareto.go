@@ -0,0 +1,178 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"math"
+	"sort"
+)
+
+// Objectives are the objectives minimized by multi-objective optimization
+type Objectives struct {
+	// Fitness is the fitness of the genome
+	Fitness float64
+	// Gates is the number of gates acting on qubits
+	Gates int
+	// MultiQubit is the number of gates acting jointly on two or more qubits
+	MultiQubit int
+	// Depth is the number of layers of the circuit
+	Depth int
+}
+
+// Objectives returns the objectives of the genome
+func (g *Genome) Objectives() Objectives {
+	circuit := g.Circuit()
+	return Objectives{
+		Fitness:    g.Fitness,
+		Gates:      circuit.Size(),
+		MultiQubit: circuit.MultiQubit(),
+		Depth:      circuit.Depth(),
+	}
+}
+
+// values returns the objectives as a vector
+func (o Objectives) values() [4]float64 {
+	return [4]float64{o.Fitness, float64(o.Gates), float64(o.MultiQubit), float64(o.Depth)}
+}
+
+// Dominates returns true if the objectives are at least as good as b in every
+// objective and better in one
+func (o Objectives) Dominates(b Objectives) bool {
+	x, y := o.values(), b.values()
+	better := false
+	for i := range x {
+		if x[i] > y[i] {
+			return false
+		}
+		if x[i] < y[i] {
+			better = true
+		}
+	}
+	return better
+}
+
+// fronts returns the indexes of the non-dominated fronts of the objectives,
+// the first front is not dominated by any objectives
+func fronts(objectives []Objectives) [][]int {
+	n := len(objectives)
+	dominated, counts := make([][]int, n), make([]int, n)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if objectives[i].Dominates(objectives[j]) {
+				dominated[i] = append(dominated[i], j)
+				counts[j]++
+			} else if objectives[j].Dominates(objectives[i]) {
+				dominated[j] = append(dominated[j], i)
+				counts[i]++
+			}
+		}
+	}
+	fronts, front := [][]int{}, []int{}
+	for i, count := range counts {
+		if count == 0 {
+			front = append(front, i)
+		}
+	}
+	for len(front) > 0 {
+		fronts = append(fronts, front)
+		next := []int{}
+		for _, i := range front {
+			for _, j := range dominated[i] {
+				counts[j]--
+				if counts[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		sort.Ints(next)
+		front = next
+	}
+	return fronts
+}
+
+// crowding returns the crowding distance of each member of a front
+func crowding(objectives []Objectives, front []int) map[int]float64 {
+	distances := make(map[int]float64, len(front))
+	for _, i := range front {
+		distances[i] = 0
+	}
+	members := append([]int(nil), front...)
+	for m := 0; m < 4; m++ {
+		sort.SliceStable(members, func(i, j int) bool {
+			return objectives[members[i]].values()[m] < objectives[members[j]].values()[m]
+		})
+		min := objectives[members[0]].values()[m]
+		max := objectives[members[len(members)-1]].values()[m]
+		distances[members[0]] = math.Inf(1)
+		distances[members[len(members)-1]] = math.Inf(1)
+		if max == min {
+			continue
+		}
+		for k := 1; k < len(members)-1; k++ {
+			previous := objectives[members[k-1]].values()[m]
+			next := objectives[members[k+1]].values()[m]
+			distances[members[k]] += (next - previous) / (max - min)
+		}
+	}
+	return distances
+}
+
+// nsga orders the genomes by non-domination rank and then by decreasing
+// crowding distance
+func nsga(genomes []Genome) {
+	objectives := make([]Objectives, len(genomes))
+	for i := range genomes {
+		objectives[i] = genomes[i].Objectives()
+	}
+	ranks, distances := make([]int, len(genomes)), make([]float64, len(genomes))
+	for rank, front := range fronts(objectives) {
+		for i, distance := range crowding(objectives, front) {
+			ranks[i], distances[i] = rank, distance
+		}
+	}
+	indexes := make([]int, len(genomes))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := indexes[i], indexes[j]
+		if ranks[a] != ranks[b] {
+			return ranks[a] < ranks[b]
+		}
+		return distances[a] > distances[b]
+	})
+	sorted := make([]Genome, len(genomes))
+	for i, index := range indexes {
+		sorted[i] = genomes[index]
+	}
+	copy(genomes, sorted)
+}
+
+// front returns the genomes of the populations not dominated by any other
+// genome, one genome for each distinct set of objectives, ordered by fitness
+func front(populations ...[]Genome) []Genome {
+	genomes, objectives := []*Genome{}, []Objectives{}
+	for _, population := range populations {
+		for i := range population {
+			genomes = append(genomes, &population[i])
+			objectives = append(objectives, population[i].Objectives())
+		}
+	}
+	first := fronts(objectives)[0]
+	members, seen := []Genome{}, map[Objectives]bool{}
+	for _, i := range first {
+		if seen[objectives[i]] {
+			continue
+		}
+		seen[objectives[i]] = true
+		cp := genomes[i].Copy()
+		cp.Fitness = genomes[i].Fitness
+		members = append(members, cp)
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Fitness < members[j].Fitness
+	})
+	return members
+}
@@ -0,0 +1,1272 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tokenKind is a kind of token
+type tokenKind int
+
+const (
+	// tokenEOF is the end of the source
+	tokenEOF tokenKind = iota
+	// tokenIdentifier is a name
+	tokenIdentifier
+	// tokenNumber is a numeric literal
+	tokenNumber
+	// tokenString is a quoted string
+	tokenString
+	// tokenSymbol is an operator or punctuation
+	tokenSymbol
+)
+
+// token is a token of a QASM source
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// symbols are the multi character symbols, longest first
+var symbols = []string{"->", "==", "!=", "<=", ">=", "&&", "||", "++", "+=", "-=", "**"}
+
+// lex splits a QASM source into tokens
+func lex(source string) ([]token, error) {
+	tokens, line := []token{}, 1
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(source[i:], "//"):
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(source[i:i+2+end], "\n")
+			i += end + 4
+		case c == '_' || c == '$' || isLetter(c):
+			j := i + 1
+			for j < len(source) && (source[j] == '_' || isLetter(source[j]) || isDigit(source[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdentifier, text: source[i:j], line: line})
+			i = j
+		case isDigit(c) || (c == '.' && i+1 < len(source) && isDigit(source[i+1])):
+			j := i
+			for j < len(source) && (isDigit(source[j]) || source[j] == '.') {
+				j++
+			}
+			if j < len(source) && (source[j] == 'e' || source[j] == 'E') {
+				k := j + 1
+				if k < len(source) && (source[k] == '+' || source[k] == '-') {
+					k++
+				}
+				if k < len(source) && isDigit(source[k]) {
+					for k < len(source) && isDigit(source[k]) {
+						k++
+					}
+					j = k
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[i:j], line: line})
+			i = j
+		case c == '"':
+			end := strings.IndexByte(source[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: source[i+1 : i+1+end], line: line})
+			i += end + 2
+		default:
+			text := string(c)
+			for _, symbol := range symbols {
+				if strings.HasPrefix(source[i:], symbol) {
+					text = symbol
+					break
+				}
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, text: text, line: line})
+			i += len(text)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, line: line}), nil
+}
+
+// isLetter checks if a byte is a letter, bytes of multi byte characters such
+// as π are treated as letters
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// isDigit checks if a byte is a decimal digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parser reads tokens
+type parser struct {
+	tokens   []token
+	position int
+}
+
+// peek returns the next token without consuming it
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+// next consumes the next token
+func (p *parser) next() token {
+	t := p.tokens[p.position]
+	if t.kind != tokenEOF {
+		p.position++
+	}
+	return t
+}
+
+// errorf formats an error at the line of the next token
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.peek().line, fmt.Sprintf(format, a...))
+}
+
+// is checks if the next token is the symbol or keyword
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokenSymbol || t.kind == tokenIdentifier) && t.text == text
+}
+
+// accept consumes the next token if it is the symbol or keyword
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expect consumes the symbol or keyword
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %s found %s", text, p.peek().text)
+	}
+	return nil
+}
+
+// identifier consumes a name
+func (p *parser) identifier() (string, error) {
+	t := p.peek()
+	if t.kind != tokenIdentifier {
+		return "", p.errorf("expected a name found %s", t.text)
+	}
+	p.next()
+	return t.text, nil
+}
+
+// integer consumes a non negative integer
+func (p *parser) integer() (int, error) {
+	t := p.peek()
+	if t.kind != tokenNumber {
+		return 0, p.errorf("expected an integer found %s", t.text)
+	}
+	value, err := strconv.Atoi(t.text)
+	if err != nil {
+		return 0, p.errorf("expected an integer found %s", t.text)
+	}
+	p.next()
+	return value, nil
+}
+
+// expression is an arithmetic expression evaluated with the values of named
+// variables
+type expression func(variables map[string]float64) (float64, error)
+
+// functions are the functions allowed in expressions
+var functions = map[string]func(float64) float64{
+	"sin":  math.Sin,
+	"cos":  math.Cos,
+	"tan":  math.Tan,
+	"exp":  math.Exp,
+	"ln":   math.Log,
+	"sqrt": math.Sqrt,
+	"asin": math.Asin,
+	"acos": math.Acos,
+	"atan": math.Atan,
+}
+
+// constants are the named constants allowed in expressions
+var constants = map[string]float64{
+	"pi":    math.Pi,
+	"π":     math.Pi,
+	"tau":   2 * math.Pi,
+	"τ":     2 * math.Pi,
+	"euler": math.E,
+	"ℇ":     math.E,
+	"true":  1,
+	"false": 0,
+}
+
+// binary combines two expressions
+func binary(a, b expression, operator func(x, y float64) float64) expression {
+	return func(variables map[string]float64) (float64, error) {
+		x, err := a(variables)
+		if err != nil {
+			return 0, err
+		}
+		y, err := b(variables)
+		if err != nil {
+			return 0, err
+		}
+		return operator(x, y), nil
+	}
+}
+
+// expression parses an expression, comparisons and logical operators result
+// in one for true and zero for false
+func (p *parser) expression() (expression, error) {
+	a, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		b, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		a = binary(a, b, func(x, y float64) float64 { return truth(x != 0 || y != 0) })
+	}
+	return a, nil
+}
+
+// and parses a logical and
+func (p *parser) and() (expression, error) {
+	a, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		b, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		a = binary(a, b, func(x, y float64) float64 { return truth(x != 0 && y != 0) })
+	}
+	return a, nil
+}
+
+// comparisons are the comparison operators
+var comparisons = map[string]func(x, y float64) float64{
+	"==": func(x, y float64) float64 { return truth(x == y) },
+	"!=": func(x, y float64) float64 { return truth(x != y) },
+	"<":  func(x, y float64) float64 { return truth(x < y) },
+	">":  func(x, y float64) float64 { return truth(x > y) },
+	"<=": func(x, y float64) float64 { return truth(x <= y) },
+	">=": func(x, y float64) float64 { return truth(x >= y) },
+}
+
+// truth converts a bool to one or zero
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// comparison parses a comparison
+func (p *parser) comparison() (expression, error) {
+	a, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokenSymbol && comparisons[t.text] != nil {
+		p.next()
+		b, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		a = binary(a, b, comparisons[t.text])
+	}
+	return a, nil
+}
+
+// sum parses a sum
+func (p *parser) sum() (expression, error) {
+	a, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+") || p.is("-") {
+		operator := p.next().text
+		b, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		if operator == "+" {
+			a = binary(a, b, func(x, y float64) float64 { return x + y })
+		} else {
+			a = binary(a, b, func(x, y float64) float64 { return x - y })
+		}
+	}
+	return a, nil
+}
+
+// term parses a product
+func (p *parser) term() (expression, error) {
+	a, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*") || p.is("/") || p.is("%") {
+		operator := p.next().text
+		b, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		switch operator {
+		case "*":
+			a = binary(a, b, func(x, y float64) float64 { return x * y })
+		case "/":
+			a = binary(a, b, func(x, y float64) float64 { return x / y })
+		default:
+			a = binary(a, b, math.Mod)
+		}
+	}
+	return a, nil
+}
+
+// factor parses a power, which binds tighter than a negation on its left
+func (p *parser) factor() (expression, error) {
+	a, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("^") || p.accept("**") {
+		b, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		a = binary(a, b, math.Pow)
+	}
+	return a, nil
+}
+
+// unary parses a negation
+func (p *parser) unary() (expression, error) {
+	if p.accept("!") {
+		a, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(variables map[string]float64) (float64, error) {
+			x, err := a(variables)
+			return truth(x == 0), err
+		}, nil
+	}
+	if p.accept("-") {
+		a, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(variables map[string]float64) (float64, error) {
+			x, err := a(variables)
+			return -x, err
+		}, nil
+	}
+	p.accept("+")
+	return p.factor()
+}
+
+// primary parses a number, name, indexed name, function call or
+// parenthesized expression. The value of the indexed name a[i] is the variable
+// named a[i].
+func (p *parser) primary() (expression, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenNumber:
+		p.next()
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid number %s", t.line, t.text)
+		}
+		return func(map[string]float64) (float64, error) {
+			return value, nil
+		}, nil
+	case t.kind == tokenIdentifier:
+		p.next()
+		if function, ok := functions[t.text]; ok && p.is("(") {
+			p.next()
+			a, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return func(variables map[string]float64) (float64, error) {
+				x, err := a(variables)
+				return function(x), err
+			}, nil
+		}
+		if p.accept("[") {
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			return func(variables map[string]float64) (float64, error) {
+				i, err := index(variables)
+				if err != nil {
+					return 0, err
+				}
+				name := fmt.Sprintf("%s[%d]", t.text, int(i))
+				if value, ok := variables[name]; ok {
+					return value, nil
+				}
+				return 0, fmt.Errorf("line %d: unknown name %s", t.line, name)
+			}, nil
+		}
+		return func(variables map[string]float64) (float64, error) {
+			if value, ok := variables[t.text]; ok {
+				return value, nil
+			}
+			if value, ok := constants[t.text]; ok {
+				return value, nil
+			}
+			return 0, fmt.Errorf("line %d: unknown name %s", t.line, t.text)
+		}, nil
+	case p.accept("("):
+		a, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return a, p.expect(")")
+	}
+	return nil, p.errorf("unexpected %s in expression", t.text)
+}
+
+// qasmGate is the number of parameters and qubits of a gate known by name and
+// the gates it is lowered to
+type qasmGate struct {
+	parameters, qubits int
+	lower              func(parameters []float64, qubits []Qubit) []Gate
+}
+
+// single lowers a single qubit gate
+func single(gateType GateType) func(parameters []float64, qubits []Qubit) []Gate {
+	return func(parameters []float64, qubits []Qubit) []Gate {
+		gate := Gate{GateType: gateType, Qubits: qubits}
+		switch len(parameters) {
+		case 1:
+			if gateType == GateTypeP || gateType == GateTypeU1 {
+				gate.Lambda = parameters[0]
+			} else {
+				gate.Theta = parameters[0]
+			}
+		case 2:
+			gate.Phi, gate.Lambda = parameters[0], parameters[1]
+		case 3:
+			gate.Theta, gate.Phi, gate.Lambda = parameters[0], parameters[1], parameters[2]
+		}
+		return []Gate{gate}
+	}
+}
+
+// controlled lowers a gate with the last qubit as target and the others as
+// controls
+func controlled(gateType GateType) func(parameters []float64, qubits []Qubit) []Gate {
+	return func(parameters []float64, qubits []Qubit) []Gate {
+		gate := single(gateType)(parameters, qubits[:len(qubits)-1])[0]
+		if gateType == GateTypeCPhase {
+			gate.Lambda, gate.Theta = parameters[0], 0
+		}
+		gate.Target = qubits[len(qubits)-1]
+		return []Gate{gate}
+	}
+}
+
+// qasmGates are the gates of qelib1.inc and the other gates known by name
+var qasmGates = map[string]qasmGate{
+	"U":        {3, 1, single(GateTypeU)},
+	"CX":       {0, 2, controlled(GateTypeControlledNot)},
+	"u":        {3, 1, single(GateTypeU)},
+	"u3":       {3, 1, single(GateTypeU3)},
+	"u2":       {2, 1, single(GateTypeU2)},
+	"u1":       {1, 1, single(GateTypeU1)},
+	"p":        {1, 1, single(GateTypeP)},
+	"id":       {0, 1, single(GateTypeI)},
+	"u0":       {1, 1, func([]float64, []Qubit) []Gate { return nil }},
+	"x":        {0, 1, single(GateTypeX)},
+	"y":        {0, 1, single(GateTypeY)},
+	"z":        {0, 1, single(GateTypeZ)},
+	"h":        {0, 1, single(GateTypeH)},
+	"s":        {0, 1, single(GateTypeS)},
+	"sdg":      {0, 1, single(GateTypeSdg)},
+	"t":        {0, 1, single(GateTypeT)},
+	"tdg":      {0, 1, single(GateTypeTdg)},
+	"rx":       {1, 1, single(GateTypeRX)},
+	"ry":       {1, 1, single(GateTypeRY)},
+	"rz":       {1, 1, single(GateTypeRZ)},
+	"sx":       {0, 1, single(GateTypeSX)},
+	"sxdg":     {0, 1, single(GateTypeSXdg)},
+	"cx":       {0, 2, controlled(GateTypeControlledNot)},
+	"cz":       {0, 2, controlled(GateTypeCZ)},
+	"ch":       {0, 2, controlled(GateTypeCH)},
+	"crx":      {1, 2, controlled(GateTypeCRX)},
+	"cry":      {1, 2, controlled(GateTypeCRY)},
+	"crz":      {1, 2, controlled(GateTypeCRZ)},
+	"cp":       {1, 2, controlled(GateTypeCPhase)},
+	"cu1":      {1, 2, controlled(GateTypeCPhase)},
+	"cu3":      {3, 2, controlled(GateTypeCU)},
+	"ccx":      {0, 3, controlled(GateTypeControlledNot)},
+	"c3x":      {0, 4, controlled(GateTypeControlledNot)},
+	"c4x":      {0, 5, controlled(GateTypeControlledNot)},
+	"swap":     {0, 2, single(GateTypeSwap)},
+	"cswap":    {0, 3, single(GateTypeCSwap)},
+	"rxx":      {1, 2, single(GateTypeRXX)},
+	"rzz":      {1, 2, single(GateTypeRZZ)},
+	"ryy":      {1, 2, single(GateTypeRYY)},
+	"iswap":    {0, 2, single(GateTypeISwap)},
+	"ecr":      {0, 2, single(GateTypeECR)},
+	"sqrtswap": {0, 2, single(GateTypeSqrtSwap)},
+	"cy": {0, 2, func(parameters []float64, qubits []Qubit) []Gate {
+		return controlled(GateTypeCU)([]float64{math.Pi, math.Pi / 2, math.Pi / 2}, qubits)
+	}},
+	"csx": {0, 2, func(parameters []float64, qubits []Qubit) []Gate {
+		return append(controlled(GateTypeCU)([]float64{math.Pi / 2, -math.Pi / 2, math.Pi / 2}, qubits),
+			Gate{GateType: GateTypeP, Qubits: []Qubit{qubits[0]}, Lambda: math.Pi / 4})
+	}},
+	"cu": {4, 2, func(parameters []float64, qubits []Qubit) []Gate {
+		gates := controlled(GateTypeCU)(parameters[:3], qubits)
+		if parameters[3] != 0 {
+			gates = append(gates, Gate{GateType: GateTypeP, Qubits: []Qubit{qubits[0]}, Lambda: parameters[3]})
+		}
+		return gates
+	}},
+}
+
+// qasmControlled matches the names of gates with more than one control
+var qasmControlled = regexp.MustCompile(`^c([0-9]+)(x|z|h|u3|rx|ry|rz|p)$`)
+
+// qasmControlledTypes are the gate types of the names matched by qasmControlled
+var qasmControlledTypes = map[string]GateType{
+	"x":  GateTypeControlledNot,
+	"z":  GateTypeCZ,
+	"h":  GateTypeCH,
+	"u3": GateTypeCU,
+	"rx": GateTypeCRX,
+	"ry": GateTypeCRY,
+	"rz": GateTypeCRZ,
+	"p":  GateTypeCPhase,
+}
+
+// qasmParameters is the number of parameters of the controlled gate types
+var qasmParameters = map[GateType]int{
+	GateTypeCU:     3,
+	GateTypeCRX:    1,
+	GateTypeCRY:    1,
+	GateTypeCRZ:    1,
+	GateTypeCPhase: 1,
+}
+
+// lookup finds a gate known by name
+func lookup(name string) (qasmGate, bool) {
+	if gate, ok := qasmGates[name]; ok {
+		return gate, true
+	}
+	match := qasmControlled.FindStringSubmatch(name)
+	if match == nil {
+		return qasmGate{}, false
+	}
+	controls, err := strconv.Atoi(match[1])
+	if err != nil || controls < 2 {
+		return qasmGate{}, false
+	}
+	gateType := qasmControlledTypes[match[2]]
+	return qasmGate{qasmParameters[gateType], controls + 1, controlled(gateType)}, true
+}
+
+// qasmDefinitions are the definitions of the gates known by name that are not
+// in qelib1.inc, in terms of qelib1.inc gates
+var qasmDefinitions = []struct {
+	name, definition string
+}{
+	{"iswap", "gate iswap a,b { s a; s b; h a; cx a,b; cx b,a; h b; }"},
+	{"ryy", "gate ryy(theta) a,b { rx(pi/2) a; rx(pi/2) b; cx a,b; rz(theta) b; cx a,b; rx(-pi/2) a; rx(-pi/2) b; }"},
+	{"ecr", "gate rzx(theta) a,b { h b; cx a,b; rz(theta) b; cx a,b; h b; }\n" +
+		"gate ecr a,b { rzx(pi/4) a,b; x a; rzx(-pi/4) a,b; }"},
+	{"sqrtswap", "gate sqrtswap a,b { cx b,a; csx a,b; cx b,a; }"},
+}
+
+// qasmDefinition is a gate defined in a QASM source
+type qasmDefinition struct {
+	parameters []string
+	qubits     []string
+	body       []qasmCall
+}
+
+// qasmCall is a gate call in the body of a definition
+type qasmCall struct {
+	name       string
+	parameters []expression
+	qubits     []string
+	line       int
+}
+
+// qasmRegister is a register of qubits or classical bits
+type qasmRegister struct {
+	offset, size int
+}
+
+// qasmOperand is a register or one of its elements
+type qasmOperand struct {
+	name  string
+	index int
+}
+
+// qasm2 is an OpenQASM 2.0 parser
+type qasm2 struct {
+	parser
+	circuit     *Circuit
+	qregs       map[string]qasmRegister
+	cregs       map[string]qasmRegister
+	definitions map[string]*qasmDefinition
+	opaque      map[string]bool
+}
+
+// ReadQASM reads an OpenQASM 2.0 circuit. The quantum registers are joined
+// into the qubits of the circuit in the order they are declared, and the
+// classical registers become the registers of the circuit. Gates from
+// qelib1.inc and custom gate definitions are supported, definitions of gates
+// heisenberg knows by name are ignored in favor of the built in gate.
+func ReadQASM(r io.Reader) (*Circuit, error) {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := lex(string(source))
+	if err != nil {
+		return nil, err
+	}
+	q := &qasm2{
+		parser:      parser{tokens: tokens},
+		circuit:     &Circuit{},
+		qregs:       make(map[string]qasmRegister),
+		cregs:       make(map[string]qasmRegister),
+		definitions: make(map[string]*qasmDefinition),
+		opaque:      make(map[string]bool),
+	}
+	if q.accept("OPENQASM") {
+		t := q.next()
+		if t.kind != tokenNumber || !strings.HasPrefix(t.text, "2") {
+			return nil, fmt.Errorf("line %d: unsupported version %s", t.line, t.text)
+		}
+		if err := q.expect(";"); err != nil {
+			return nil, err
+		}
+	}
+	for q.peek().kind != tokenEOF {
+		if err := q.statement(); err != nil {
+			return nil, err
+		}
+	}
+	return q.circuit, nil
+}
+
+// statement parses a top level statement
+func (q *qasm2) statement() error {
+	switch {
+	case q.accept("include"):
+		t := q.next()
+		if t.kind != tokenString {
+			return fmt.Errorf("line %d: expected a file name", t.line)
+		}
+		if t.text != "qelib1.inc" {
+			return fmt.Errorf("line %d: unsupported include %s", t.line, t.text)
+		}
+		return q.expect(";")
+	case q.is("qreg") || q.is("creg"):
+		kind := q.next().text
+		name, err := q.identifier()
+		if err != nil {
+			return err
+		}
+		if err := q.expect("["); err != nil {
+			return err
+		}
+		size, err := q.integer()
+		if err != nil {
+			return err
+		}
+		if size < 1 {
+			return q.errorf("register %s must have a positive size", name)
+		}
+		if err := q.expect("]"); err != nil {
+			return err
+		}
+		if _, ok := q.qregs[name]; ok {
+			return q.errorf("register %s is already declared", name)
+		}
+		if _, ok := q.cregs[name]; ok {
+			return q.errorf("register %s is already declared", name)
+		}
+		if kind == "qreg" {
+			q.qregs[name] = qasmRegister{offset: q.circuit.Width, size: size}
+			q.circuit.Width += size
+		} else {
+			q.cregs[name] = qasmRegister{offset: q.circuit.Bits(), size: size}
+			q.circuit.Register(name, size)
+		}
+		return q.expect(";")
+	case q.is("gate") || q.is("opaque"):
+		return q.definition()
+	case q.accept("measure"):
+		qubits, err := q.operand(q.qregs)
+		if err != nil {
+			return err
+		}
+		if err := q.expect("->"); err != nil {
+			return err
+		}
+		bits, err := q.operand(q.cregs)
+		if err != nil {
+			return err
+		}
+		if len(qubits) != len(bits) {
+			return q.errorf("%d qubits are measured into %d bits", len(qubits), len(bits))
+		}
+		for i := range qubits {
+			q.circuit.Measure(Qubit(qubits[i]), bits[i])
+		}
+		return q.expect(";")
+	case q.accept("barrier"):
+		qubits := []Qubit{}
+		for {
+			operand, err := q.operand(q.qregs)
+			if err != nil {
+				return err
+			}
+			for _, qubit := range operand {
+				qubits = append(qubits, Qubit(qubit))
+			}
+			if !q.accept(",") {
+				break
+			}
+		}
+		q.circuit.Barrier(qubits...)
+		return q.expect(";")
+	case q.is("reset") || q.is("if"):
+		return q.errorf("%s is not supported", q.peek().text)
+	}
+	return q.call()
+}
+
+// operand parses a register or register element and returns its indexes
+func (q *qasm2) operand(registers map[string]qasmRegister) ([]int, error) {
+	name, err := q.identifier()
+	if err != nil {
+		return nil, err
+	}
+	register, ok := registers[name]
+	if !ok {
+		return nil, q.errorf("unknown register %s", name)
+	}
+	if q.accept("[") {
+		index, err := q.integer()
+		if err != nil {
+			return nil, err
+		}
+		if index >= register.size {
+			return nil, q.errorf("index %d is out of range for %s[%d]", index, name, register.size)
+		}
+		return []int{register.offset + index}, q.expect("]")
+	}
+	indexes := make([]int, register.size)
+	for i := range indexes {
+		indexes[i] = register.offset + i
+	}
+	return indexes, nil
+}
+
+// parameters parses an optional parenthesized list of expressions
+func (p *parser) parameters() ([]expression, error) {
+	parameters := []expression{}
+	if !p.accept("(") {
+		return parameters, nil
+	}
+	if p.accept(")") {
+		return parameters, nil
+	}
+	for {
+		parameter, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		parameters = append(parameters, parameter)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return parameters, p.expect(")")
+}
+
+// names parses a comma separated list of names
+func (p *parser) names() ([]string, error) {
+	names := []string{}
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return names, nil
+}
+
+// definition parses a gate definition or opaque declaration
+func (q *qasm2) definition() error {
+	opaque := q.next().text == "opaque"
+	name, err := q.identifier()
+	if err != nil {
+		return err
+	}
+	definition := &qasmDefinition{}
+	if q.accept("(") {
+		if !q.accept(")") {
+			if definition.parameters, err = q.names(); err != nil {
+				return err
+			}
+			if err := q.expect(")"); err != nil {
+				return err
+			}
+		}
+	}
+	if definition.qubits, err = q.names(); err != nil {
+		return err
+	}
+	if opaque {
+		q.opaque[name] = true
+		return q.expect(";")
+	}
+	if err := q.expect("{"); err != nil {
+		return err
+	}
+	for !q.accept("}") {
+		if q.peek().kind == tokenEOF {
+			return q.errorf("unterminated definition of %s", name)
+		}
+		call := qasmCall{line: q.peek().line}
+		if call.name, err = q.identifier(); err != nil {
+			return err
+		}
+		if call.name != "barrier" {
+			if call.parameters, err = q.parameters(); err != nil {
+				return err
+			}
+		}
+		if call.qubits, err = q.names(); err != nil {
+			return err
+		}
+		if err := q.expect(";"); err != nil {
+			return err
+		}
+		definition.body = append(definition.body, call)
+	}
+	if _, ok := lookup(name); !ok {
+		q.definitions[name] = definition
+	}
+	return nil
+}
+
+// call parses a gate call with register operands
+func (q *qasm2) call() error {
+	line := q.peek().line
+	name, err := q.identifier()
+	if err != nil {
+		return err
+	}
+	expressions, err := q.parameters()
+	if err != nil {
+		return err
+	}
+	parameters := make([]float64, len(expressions))
+	for i, expression := range expressions {
+		if parameters[i], err = expression(nil); err != nil {
+			return err
+		}
+	}
+	operands, size := [][]int{}, 1
+	for {
+		operand, err := q.operand(q.qregs)
+		if err != nil {
+			return err
+		}
+		if len(operand) > 1 {
+			if size > 1 && len(operand) != size {
+				return q.errorf("registers of %s have different sizes", name)
+			}
+			size = len(operand)
+		}
+		operands = append(operands, operand)
+		if !q.accept(",") {
+			break
+		}
+	}
+	for i := 0; i < size; i++ {
+		qubits := make([]Qubit, len(operands))
+		for j, operand := range operands {
+			if len(operand) == 1 {
+				qubits[j] = Qubit(operand[0])
+			} else {
+				qubits[j] = Qubit(operand[i])
+			}
+		}
+		if err := q.apply(name, parameters, qubits, line, 0); err != nil {
+			return err
+		}
+	}
+	return q.expect(";")
+}
+
+// apply appends the gates of a call to the circuit
+func (q *qasm2) apply(name string, parameters []float64, qubits []Qubit, line, depth int) error {
+	seen := make(map[Qubit]bool)
+	for _, qubit := range qubits {
+		if seen[qubit] {
+			return fmt.Errorf("line %d: qubit %d is given to %s more than once", line, qubit, name)
+		}
+		seen[qubit] = true
+	}
+	if gate, ok := lookup(name); ok {
+		if len(parameters) != gate.parameters || len(qubits) != gate.qubits {
+			return fmt.Errorf("line %d: %s takes %d parameters and %d qubits", line, name, gate.parameters, gate.qubits)
+		}
+		q.circuit.Gates = append(q.circuit.Gates, gate.lower(parameters, qubits)...)
+		return nil
+	}
+	definition, ok := q.definitions[name]
+	if !ok {
+		if q.opaque[name] {
+			return fmt.Errorf("line %d: opaque gate %s can not be simulated", line, name)
+		}
+		return fmt.Errorf("line %d: unknown gate %s", line, name)
+	}
+	if depth > 64 {
+		return fmt.Errorf("line %d: gate %s is nested too deeply", line, name)
+	}
+	if len(parameters) != len(definition.parameters) || len(qubits) != len(definition.qubits) {
+		return fmt.Errorf("line %d: %s takes %d parameters and %d qubits", line, name,
+			len(definition.parameters), len(definition.qubits))
+	}
+	variables := make(map[string]float64)
+	for i, parameter := range definition.parameters {
+		variables[parameter] = parameters[i]
+	}
+	arguments := make(map[string]Qubit)
+	for i, qubit := range definition.qubits {
+		arguments[qubit] = qubits[i]
+	}
+	for _, call := range definition.body {
+		values := make([]float64, len(call.parameters))
+		for i, expression := range call.parameters {
+			value, err := expression(variables)
+			if err != nil {
+				return err
+			}
+			values[i] = value
+		}
+		targets := make([]Qubit, len(call.qubits))
+		for i, argument := range call.qubits {
+			qubit, ok := arguments[argument]
+			if !ok {
+				return fmt.Errorf("line %d: unknown qubit %s", call.line, argument)
+			}
+			targets[i] = qubit
+		}
+		if call.name == "barrier" {
+			q.circuit.Barrier(targets...)
+			continue
+		}
+		if err := q.apply(call.name, values, targets, call.line, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// angle formats an angle as a multiple of pi when it is one, or with the
+// number of significant digits, -1 being the fewest that parse back exactly
+func angle(theta float64, precision int) string {
+	if theta == 0 {
+		return "0"
+	}
+	for _, d := range []float64{1, 2, 3, 4, 6, 8, 16} {
+		n := theta * d / math.Pi
+		if n != math.Trunc(n) || math.Abs(n) > 64 || math.Pi*n/d != theta {
+			continue
+		}
+		var numerator string
+		switch n {
+		case 1:
+			numerator = "pi"
+		case -1:
+			numerator = "-pi"
+		default:
+			numerator = strconv.FormatFloat(n, 'f', -1, 64) + "*pi"
+		}
+		if d == 1 {
+			return numerator
+		}
+		return numerator + "/" + strconv.FormatFloat(d, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(theta, 'g', precision, 64)
+}
+
+// qasmName returns the name and parameters of a gate with the given number of
+// controls
+func qasmName(g *Gate, controls int) (string, []float64) {
+	var base string
+	var parameters []float64
+	switch g.GateType {
+	case GateTypeControlledNot:
+		base = "x"
+	case GateTypeCZ:
+		base = "z"
+	case GateTypeCH:
+		base = "h"
+	case GateTypeCU:
+		base, parameters = "u3", []float64{g.Theta, g.Phi, g.Lambda}
+	case GateTypeCRX:
+		base, parameters = "rx", []float64{g.Theta}
+	case GateTypeCRY:
+		base, parameters = "ry", []float64{g.Theta}
+	case GateTypeCRZ:
+		base, parameters = "rz", []float64{g.Theta}
+	case GateTypeCPhase:
+		base, parameters = "p", []float64{g.Lambda}
+	}
+	switch {
+	case controls == 0:
+		return base, parameters
+	case controls == 1:
+		return "c" + base, parameters
+	case controls == 2 && base == "x":
+		return "ccx", parameters
+	}
+	return fmt.Sprintf("c%d%s", controls, base), parameters
+}
+
+// qasmNames are the names of the gates that are not controlled
+var qasmNames = map[GateType]string{
+	GateTypeI:        "id",
+	GateTypeH:        "h",
+	GateTypeX:        "x",
+	GateTypeY:        "y",
+	GateTypeZ:        "z",
+	GateTypeS:        "s",
+	GateTypeT:        "t",
+	GateTypeU:        "u",
+	GateTypeRX:       "rx",
+	GateTypeRY:       "ry",
+	GateTypeRZ:       "rz",
+	GateTypeSX:       "sx",
+	GateTypeSXdg:     "sxdg",
+	GateTypeSdg:      "sdg",
+	GateTypeTdg:      "tdg",
+	GateTypeP:        "p",
+	GateTypeU1:       "u1",
+	GateTypeU2:       "u2",
+	GateTypeU3:       "u3",
+	GateTypeSwap:     "swap",
+	GateTypeISwap:    "iswap",
+	GateTypeSqrtSwap: "sqrtswap",
+	GateTypeRXX:      "rxx",
+	GateTypeRYY:      "ryy",
+	GateTypeRZZ:      "rzz",
+	GateTypeECR:      "ecr",
+	GateTypeCSwap:    "cswap",
+}
+
+// qasmStatement is a gate call to write
+type qasmStatement struct {
+	name       string
+	parameters []float64
+	qubits     []Qubit
+}
+
+// statements converts a gate into gate calls
+func (g *Gate) statements() ([]qasmStatement, error) {
+	if g.Controlled() {
+		name, parameters := qasmName(g, len(g.Qubits))
+		return []qasmStatement{{name, parameters, g.Operands()}}, nil
+	}
+	name, ok := qasmNames[g.GateType]
+	if !ok {
+		return nil, fmt.Errorf("gate type %d has no OpenQASM name", g.GateType)
+	}
+	var parameters []float64
+	switch g.GateType {
+	case GateTypeU, GateTypeU3:
+		parameters = []float64{g.Theta, g.Phi, g.Lambda}
+	case GateTypeU2:
+		parameters = []float64{g.Phi, g.Lambda}
+	case GateTypeP, GateTypeU1:
+		parameters = []float64{g.Lambda}
+	case GateTypeRX, GateTypeRY, GateTypeRZ, GateTypeRXX, GateTypeRYY, GateTypeRZZ:
+		parameters = []float64{g.Theta}
+	}
+	statements := []qasmStatement{}
+	switch g.GateType {
+	case GateTypeSwap:
+		for i, j := 0, len(g.Qubits)-1; i < j; i, j = i+1, j-1 {
+			statements = append(statements, qasmStatement{name, nil, []Qubit{g.Qubits[i], g.Qubits[j]}})
+		}
+	case GateTypeISwap, GateTypeSqrtSwap, GateTypeRXX, GateTypeRYY, GateTypeRZZ, GateTypeECR:
+		statements = append(statements, qasmStatement{name, parameters, g.Qubits[:2]})
+	case GateTypeCSwap:
+		statements = append(statements, qasmStatement{name, parameters, g.Qubits[:3]})
+	default:
+		for _, qubit := range g.Qubits {
+			statements = append(statements, qasmStatement{name, parameters, []Qubit{qubit}})
+		}
+	}
+	return statements, nil
+}
+
+// WriteQASM writes the circuit as OpenQASM 2.0 with the qubits in a register
+// named q. Definitions in terms of qelib1.inc gates are written for the other
+// gates heisenberg knows by name, and gates with more controls than
+// qelib1.inc supports are declared opaque.
+func (c *Circuit) WriteQASM(w io.Writer) error {
+	registers, bits := c.Registers, c.Bits()
+	for i := range c.Gates {
+		for _, bit := range c.Gates[i].Bits {
+			if bit >= bits {
+				bits = bit + 1
+			}
+		}
+	}
+	if bits > c.Bits() {
+		if len(registers) > 0 {
+			return fmt.Errorf("bit %d is not in the registers", bits-1)
+		}
+		registers = []ClassicalRegister{{Name: "c", Size: bits}}
+	}
+
+	var body strings.Builder
+	used, opaque := make(map[string]bool), make(map[string]int)
+	for i := range c.Gates {
+		gate := &c.Gates[i]
+		switch gate.GateType {
+		case GateTypeMeasure:
+			for j, qubit := range gate.Qubits {
+				bit, name := gate.Bits[j], ""
+				for _, register := range registers {
+					if bit < register.Size {
+						name = register.Name
+						break
+					}
+					bit -= register.Size
+				}
+				fmt.Fprintf(&body, "measure q[%d] -> %s[%d];\n", qubit, name, bit)
+			}
+			continue
+		case GateTypeBarrier:
+			if len(gate.Qubits) == 0 {
+				body.WriteString("barrier q;\n")
+				continue
+			}
+			operands := make([]string, len(gate.Qubits))
+			for j, qubit := range gate.Qubits {
+				operands[j] = fmt.Sprintf("q[%d]", qubit)
+			}
+			fmt.Fprintf(&body, "barrier %s;\n", strings.Join(operands, ","))
+			continue
+		}
+		statements, err := gate.statements()
+		if err != nil {
+			return err
+		}
+		for _, statement := range statements {
+			used[statement.name] = true
+			if _, ok := qasmGates[statement.name]; !ok {
+				opaque[statement.name] = len(statement.qubits)
+			}
+			body.WriteString(statement.name)
+			if len(statement.parameters) > 0 {
+				parameters := make([]string, len(statement.parameters))
+				for j, parameter := range statement.parameters {
+					parameters[j] = angle(parameter, -1)
+				}
+				fmt.Fprintf(&body, "(%s)", strings.Join(parameters, ","))
+			}
+			operands := make([]string, len(statement.qubits))
+			for j, qubit := range statement.qubits {
+				operands[j] = fmt.Sprintf("q[%d]", qubit)
+			}
+			fmt.Fprintf(&body, " %s;\n", strings.Join(operands, ","))
+		}
+	}
+
+	out := bufio.NewWriter(w)
+	out.WriteString("OPENQASM 2.0;\ninclude \"qelib1.inc\";\n")
+	for _, definition := range qasmDefinitions {
+		if used[definition.name] {
+			fmt.Fprintln(out, definition.definition)
+		}
+	}
+	names := make([]string, 0, len(opaque))
+	for name := range opaque {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		gate, _ := lookup(name)
+		fmt.Fprintf(out, "opaque %s", name)
+		if gate.parameters > 0 {
+			parameters := make([]string, gate.parameters)
+			for i := range parameters {
+				parameters[i] = fmt.Sprintf("p%d", i)
+			}
+			fmt.Fprintf(out, "(%s)", strings.Join(parameters, ","))
+		}
+		qubits := make([]string, opaque[name])
+		for i := range qubits {
+			qubits[i] = fmt.Sprintf("a%d", i)
+		}
+		fmt.Fprintf(out, " %s;\n", strings.Join(qubits, ","))
+	}
+	fmt.Fprintf(out, "qreg q[%d];\n", c.Width)
+	for _, register := range registers {
+		fmt.Fprintf(out, "creg %s[%d];\n", register.Name, register.Size)
+	}
+	out.WriteString(body.String())
+	return out.Flush()
+}
+
+// WriteQASM writes the gates of the genome as OpenQASM 2.0
+func (g *Genome) WriteQASM(w io.Writer) error {
+	return g.Circuit().WriteQASM(w)
+}
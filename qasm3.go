@@ -0,0 +1,1190 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"strings"
+)
+
+// MaxIterations is the largest number of iterations of a while or for loop in
+// an OpenQASM 3 program
+const MaxIterations = 1 << 20
+
+// maxQubits is the largest number of qubits of an OpenQASM 3 program
+const maxQubits = 30
+
+// maxBits is the largest size of a bit register or a classical type
+const maxBits = 64
+
+// qasm3Types are the classical types of OpenQASM 3
+var qasm3Types = map[string]bool{
+	"bit":   true,
+	"bool":  true,
+	"int":   true,
+	"uint":  true,
+	"float": true,
+	"angle": true,
+}
+
+// qasm3Modifier is a gate modifier
+type qasm3Modifier struct {
+	kind     string
+	argument expression
+}
+
+// modifier is an evaluated gate modifier
+type modifier struct {
+	kind  string
+	value float64
+}
+
+// qasm3Operand is a qubit or bit register or one of its elements
+type qasm3Operand struct {
+	name  string
+	index expression
+}
+
+// qasm3Call is a gate call
+type qasm3Call struct {
+	modifiers  []qasm3Modifier
+	name       string
+	parameters []expression
+	qubits     []string
+	line       int
+}
+
+// qasm3Definition is a gate defined in an OpenQASM 3 program
+type qasm3Definition struct {
+	parameters []string
+	qubits     []string
+	body       []qasm3Call
+}
+
+// qasm3State is the state of a running OpenQASM 3 program
+type qasm3State struct {
+	machine   Machine
+	rng       *rand.Rand
+	variables map[string]float64
+	bits      map[string][]bool
+}
+
+// qasm3Statement is a compiled statement
+type qasm3Statement func(s *qasm3State) error
+
+// Program is an OpenQASM 3 program. The supported subset covers qubit and bit
+// declarations, input parameters, classical variables, gate definitions, the
+// ctrl, negctrl, inv and integer pow gate modifiers, measurement, reset,
+// barrier, if and else on classical expressions, for loops over ranges and
+// sets and while loops. The value of a bit register in an expression is the
+// integer with the first bit of the register as the least significant bit.
+type Program struct {
+	// Width is the number of qubits of the program
+	Width int
+	// Inputs are the names of the input parameters
+	Inputs []string
+
+	parser
+	qubits      map[string]qasmRegister
+	bits        map[string]int
+	order       []string
+	types       map[string]string
+	definitions map[string]*qasm3Definition
+	statements  []qasm3Statement
+}
+
+// ReadQASM3 reads an OpenQASM 3 program
+func ReadQASM3(r io.Reader) (*Program, error) {
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := lex(string(source))
+	if err != nil {
+		return nil, err
+	}
+	p := &Program{
+		parser:      parser{tokens: tokens},
+		qubits:      make(map[string]qasmRegister),
+		bits:        make(map[string]int),
+		types:       make(map[string]string),
+		definitions: make(map[string]*qasm3Definition),
+	}
+	if p.accept("OPENQASM") {
+		t := p.next()
+		if t.kind != tokenNumber || !strings.HasPrefix(t.text, "3") {
+			return nil, fmt.Errorf("line %d: unsupported version %s", t.line, t.text)
+		}
+		if err := p.expect(";"); err != nil {
+			return nil, err
+		}
+	}
+	for p.peek().kind != tokenEOF {
+		statement, err := p.statement(true)
+		if err != nil {
+			return nil, err
+		}
+		if statement != nil {
+			p.statements = append(p.statements, statement)
+		}
+	}
+	return p, nil
+}
+
+// Run runs the program on a machine and returns the bit registers by name.
+// Zero qubits are added to the machine until it has the width of the
+// program. Every input parameter must be given a value.
+func (p *Program) Run(machine Machine, rng *rand.Rand, inputs map[string]float64) (map[string][]bool, error) {
+	s := &qasm3State{
+		machine:   machine,
+		rng:       rng,
+		variables: make(map[string]float64),
+		bits:      make(map[string][]bool),
+	}
+	for _, input := range p.Inputs {
+		value, ok := inputs[input]
+		if !ok {
+			return nil, fmt.Errorf("input %s is not given", input)
+		}
+		s.variables[input] = value
+	}
+	for name := range inputs {
+		if _, ok := s.variables[name]; !ok {
+			return nil, fmt.Errorf("%s is not an input", name)
+		}
+	}
+	for _, name := range p.order {
+		s.bits[name] = make([]bool, p.bits[name])
+		s.variables[name] = 0
+		for i := 0; i < p.bits[name]; i++ {
+			s.set(name, i, false)
+		}
+	}
+	for machine.Width() < p.Width {
+		machine.Zero()
+	}
+	if err := run(s, p.statements); err != nil {
+		return nil, err
+	}
+	return s.bits, nil
+}
+
+// run runs statements
+func run(s *qasm3State, statements []qasm3Statement) error {
+	for _, statement := range statements {
+		if err := statement(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// set sets a bit and the variables holding the bit and its register
+func (s *qasm3State) set(name string, index int, value bool) {
+	bits := s.bits[name]
+	if len(bits) == 0 {
+		return
+	}
+	s.variables[name] += (truth(value) - truth(bits[index])) * math.Ldexp(1, index)
+	bits[index] = value
+	s.variables[fmt.Sprintf("%s[%d]", name, index)] = truth(value)
+}
+
+// block parses a braced block of statements or a single statement
+func (p *Program) block() ([]qasm3Statement, error) {
+	statements := []qasm3Statement{}
+	if !p.accept("{") {
+		statement, err := p.statement(false)
+		if err != nil {
+			return nil, err
+		}
+		if statement != nil {
+			statements = append(statements, statement)
+		}
+		return statements, nil
+	}
+	for !p.accept("}") {
+		if p.peek().kind == tokenEOF {
+			return nil, p.errorf("unterminated block")
+		}
+		statement, err := p.statement(false)
+		if err != nil {
+			return nil, err
+		}
+		if statement != nil {
+			statements = append(statements, statement)
+		}
+	}
+	return statements, nil
+}
+
+// designator parses an optional constant size in brackets of at most max
+func (p *Program) designator(max int) (int, bool, error) {
+	if !p.accept("[") {
+		return 0, false, nil
+	}
+	size, err := p.expression()
+	if err != nil {
+		return 0, false, err
+	}
+	line := p.peek().line
+	value, err := size(nil)
+	if err != nil {
+		return 0, false, err
+	}
+	if value != math.Trunc(value) || value < 1 || value > float64(max) {
+		return 0, false, fmt.Errorf("line %d: size %g is not an integer between 1 and %d", line, value, max)
+	}
+	return int(value), true, p.expect("]")
+}
+
+// statement parses a statement, declarations are only allowed at the top
+// level
+func (p *Program) statement(global bool) (qasm3Statement, error) {
+	line := p.peek().line
+	declaration := func() error {
+		if !global {
+			return fmt.Errorf("line %d: declarations are only allowed in the global scope", line)
+		}
+		return nil
+	}
+	switch {
+	case p.accept("include"):
+		t := p.next()
+		if t.kind != tokenString {
+			return nil, fmt.Errorf("line %d: expected a file name", t.line)
+		}
+		if t.text != "stdgates.inc" && t.text != "qelib1.inc" {
+			return nil, fmt.Errorf("line %d: unsupported include %s", t.line, t.text)
+		}
+		return nil, p.expect(";")
+	case p.is("qubit") || p.is("qreg"):
+		if err := declaration(); err != nil {
+			return nil, err
+		}
+		kind := p.next().text
+		size, sized, err := p.designator(maxQubits)
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if kind == "qreg" {
+			if size, sized, err = p.designator(maxQubits); err != nil {
+				return nil, err
+			}
+		}
+		if !sized {
+			size = 1
+		}
+		if p.Width+size > maxQubits {
+			return nil, fmt.Errorf("line %d: programs are limited to %d qubits", line, maxQubits)
+		}
+		if err := p.declare(name); err != nil {
+			return nil, err
+		}
+		p.qubits[name] = qasmRegister{offset: p.Width, size: size}
+		p.Width += size
+		return nil, p.expect(";")
+	case p.is("bit") || p.is("creg"):
+		if err := declaration(); err != nil {
+			return nil, err
+		}
+		kind := p.next().text
+		size, sized, err := p.designator(maxBits)
+		if err != nil {
+			return nil, err
+		}
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if kind == "creg" {
+			if size, sized, err = p.designator(maxBits); err != nil {
+				return nil, err
+			}
+		}
+		if !sized {
+			size = 1
+		}
+		if err := p.declare(name); err != nil {
+			return nil, err
+		}
+		p.bits[name] = size
+		p.order = append(p.order, name)
+		if p.accept("=") {
+			if err := p.expect("measure"); err != nil {
+				return nil, err
+			}
+			return p.measure(line, qasm3Operand{name: name})
+		}
+		return nil, p.expect(";")
+	case p.accept("input"):
+		if err := declaration(); err != nil {
+			return nil, err
+		}
+		kind, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if !qasm3Types[kind] || kind == "bit" {
+			return nil, fmt.Errorf("line %d: unsupported input type %s", line, kind)
+		}
+		if _, _, err := p.designator(maxBits); err != nil {
+			return nil, err
+		}
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.declare(name); err != nil {
+			return nil, err
+		}
+		p.types[name] = kind
+		p.Inputs = append(p.Inputs, name)
+		return nil, p.expect(";")
+	case p.is("const") || (qasm3Types[p.peek().text] && p.peek().kind == tokenIdentifier):
+		if err := declaration(); err != nil {
+			return nil, err
+		}
+		p.accept("const")
+		kind, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if !qasm3Types[kind] || kind == "bit" {
+			return nil, fmt.Errorf("line %d: unsupported type %s", line, kind)
+		}
+		if _, _, err := p.designator(maxBits); err != nil {
+			return nil, err
+		}
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.declare(name); err != nil {
+			return nil, err
+		}
+		p.types[name] = kind
+		value := func(map[string]float64) (float64, error) {
+			return 0, nil
+		}
+		if p.accept("=") {
+			if value, err = p.expression(); err != nil {
+				return nil, err
+			}
+		}
+		return p.assignment(name, "=", value), p.expect(";")
+	case p.is("gate"):
+		if err := declaration(); err != nil {
+			return nil, err
+		}
+		return nil, p.definition()
+	case p.accept("measure"):
+		qubits, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("->"); err != nil {
+			return nil, err
+		}
+		bits, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return p.measure(line, bits, qubits)
+	case p.accept("reset"):
+		operand, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return func(s *qasm3State) error {
+			qubits, err := p.resolve(s, operand, line)
+			if err != nil {
+				return err
+			}
+			for _, qubit := range qubits {
+				if s.rng == nil {
+					return fmt.Errorf("line %d: reset requires a rng", line)
+				}
+				if s.machine.Measure(s.rng, qubit)[0] {
+					s.machine.X(qubit)
+				}
+			}
+			return nil
+		}, p.expect(";")
+	case p.accept("barrier"):
+		for !p.is(";") {
+			if _, err := p.operand(); err != nil {
+				return nil, err
+			}
+			if !p.accept(",") {
+				break
+			}
+		}
+		return nil, p.expect(";")
+	case p.accept("if"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		condition, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		then, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		otherwise := []qasm3Statement{}
+		if p.accept("else") {
+			if otherwise, err = p.block(); err != nil {
+				return nil, err
+			}
+		}
+		return func(s *qasm3State) error {
+			value, err := condition(s.variables)
+			if err != nil {
+				return err
+			}
+			if value != 0 {
+				return run(s, then)
+			}
+			return run(s, otherwise)
+		}, nil
+	case p.accept("for"):
+		return p.loop(line)
+	case p.accept("while"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		condition, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return func(s *qasm3State) error {
+			for i := 0; ; i++ {
+				if i == MaxIterations {
+					return fmt.Errorf("line %d: while loop exceeds %d iterations", line, MaxIterations)
+				}
+				value, err := condition(s.variables)
+				if err != nil {
+					return err
+				}
+				if value == 0 {
+					return nil
+				}
+				if err := run(s, body); err != nil {
+					return err
+				}
+			}
+		}, nil
+	}
+
+	if p.peek().kind == tokenIdentifier {
+		next := p.tokens[p.position+1]
+		if next.kind == tokenSymbol && (next.text == "=" || next.text == "+=" || next.text == "-=" || next.text == "[") {
+			return p.assign(line)
+		}
+	}
+	return p.call(line)
+}
+
+// declare checks that a name is not already declared
+func (p *Program) declare(name string) error {
+	_, qubits := p.qubits[name]
+	_, bits := p.bits[name]
+	_, variable := p.types[name]
+	_, gate := p.definitions[name]
+	if qubits || bits || variable || gate {
+		return p.errorf("%s is already declared", name)
+	}
+	return nil
+}
+
+// assignment creates a statement assigning a value to a classical variable
+func (p *Program) assignment(name, operator string, value expression) qasm3Statement {
+	kind := p.types[name]
+	return func(s *qasm3State) error {
+		x, err := value(s.variables)
+		if err != nil {
+			return err
+		}
+		switch operator {
+		case "+=":
+			x = s.variables[name] + x
+		case "-=":
+			x = s.variables[name] - x
+		}
+		switch kind {
+		case "int", "uint":
+			x = math.Trunc(x)
+		case "bool":
+			x = truth(x != 0)
+		}
+		s.variables[name] = x
+		return nil
+	}
+}
+
+// assign parses an assignment to a classical variable or a measurement into
+// bits
+func (p *Program) assign(line int) (qasm3Statement, error) {
+	operand, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := p.bits[operand.name]; ok {
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		if p.accept("measure") {
+			qubits, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			return p.measure(line, operand, qubits)
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return func(s *qasm3State) error {
+			indexes, err := p.indexes(s, operand, p.bits[operand.name], line)
+			if err != nil {
+				return err
+			}
+			x, err := value(s.variables)
+			if err != nil {
+				return err
+			}
+			bits := int64(x)
+			if len(indexes) == 1 {
+				bits = int64(truth(x != 0))
+			}
+			for i, index := range indexes {
+				s.set(operand.name, index, (bits>>uint(i))&1 == 1)
+			}
+			return nil
+		}, p.expect(";")
+	}
+	if _, ok := p.types[operand.name]; !ok || operand.index != nil {
+		return nil, fmt.Errorf("line %d: %s is not a classical variable", line, operand.name)
+	}
+	operator := p.next().text
+	if operator != "=" && operator != "+=" && operator != "-=" {
+		return nil, fmt.Errorf("line %d: unexpected %s", line, operator)
+	}
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	return p.assignment(operand.name, operator, value), p.expect(";")
+}
+
+// operand parses a register or an indexed element of a register
+func (p *Program) operand() (qasm3Operand, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return qasm3Operand{}, err
+	}
+	operand := qasm3Operand{name: name}
+	if p.accept("[") {
+		if operand.index, err = p.expression(); err != nil {
+			return operand, err
+		}
+		if err := p.expect("]"); err != nil {
+			return operand, err
+		}
+	}
+	return operand, nil
+}
+
+// indexes evaluates the indexes of an operand of a register of the size
+func (p *Program) indexes(s *qasm3State, operand qasm3Operand, size, line int) ([]int, error) {
+	if operand.index == nil {
+		indexes := make([]int, size)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+	value, err := operand.index(s.variables)
+	if err != nil {
+		return nil, err
+	}
+	index := int(value)
+	if value < 0 || index >= size {
+		return nil, fmt.Errorf("line %d: index %d is out of range for %s[%d]", line, index, operand.name, size)
+	}
+	return []int{index}, nil
+}
+
+// resolve evaluates the qubits of an operand
+func (p *Program) resolve(s *qasm3State, operand qasm3Operand, line int) ([]Qubit, error) {
+	register, ok := p.qubits[operand.name]
+	if !ok {
+		return nil, fmt.Errorf("line %d: unknown qubit register %s", line, operand.name)
+	}
+	indexes, err := p.indexes(s, operand, register.size, line)
+	if err != nil {
+		return nil, err
+	}
+	qubits := make([]Qubit, len(indexes))
+	for i, index := range indexes {
+		qubits[i] = Qubit(register.offset + index)
+	}
+	return qubits, nil
+}
+
+// measure creates a statement measuring qubits into bits
+func (p *Program) measure(line int, bits qasm3Operand, operands ...qasm3Operand) (qasm3Statement, error) {
+	if len(operands) == 0 {
+		qubits, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, qubits)
+	}
+	size, ok := p.bits[bits.name]
+	if !ok {
+		return nil, fmt.Errorf("line %d: unknown bit register %s", line, bits.name)
+	}
+	operand := operands[0]
+	return func(s *qasm3State) error {
+		qubits, err := p.resolve(s, operand, line)
+		if err != nil {
+			return err
+		}
+		indexes, err := p.indexes(s, bits, size, line)
+		if err != nil {
+			return err
+		}
+		if len(qubits) != len(indexes) {
+			return fmt.Errorf("line %d: %d qubits are measured into %d bits", line, len(qubits), len(indexes))
+		}
+		if s.rng == nil {
+			return fmt.Errorf("line %d: measurement requires a rng", line)
+		}
+		for i, result := range s.machine.Measure(s.rng, qubits...) {
+			s.set(bits.name, indexes[i], result)
+		}
+		return nil
+	}, p.expect(";")
+}
+
+// loop parses a for loop over a range or a set of values
+func (p *Program) loop(line int) (qasm3Statement, error) {
+	if qasm3Types[p.peek().text] {
+		p.next()
+		if _, _, err := p.designator(maxBits); err != nil {
+			return nil, err
+		}
+	}
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	values := []expression{}
+	ranged := false
+	switch {
+	case p.accept("["):
+		ranged = true
+		for {
+			value, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if !p.accept(":") {
+				break
+			}
+		}
+		if len(values) != 2 && len(values) != 3 {
+			return nil, fmt.Errorf("line %d: a range is [start:end] or [start:step:end]", line)
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	case p.accept("{"):
+		for {
+			value, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect("}"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, p.errorf("expected a range or set")
+	}
+	if _, ok := p.types[name]; ok {
+		return nil, fmt.Errorf("line %d: loop variable %s is already declared", line, name)
+	}
+	p.types[name] = "int"
+	body, err := p.block()
+	delete(p.types, name)
+	if err != nil {
+		return nil, err
+	}
+	return func(s *qasm3State) error {
+		evaluated := make([]float64, len(values))
+		for i, value := range values {
+			x, err := value(s.variables)
+			if err != nil {
+				return err
+			}
+			evaluated[i] = x
+		}
+		iterate := func(x float64) error {
+			s.variables[name] = x
+			return run(s, body)
+		}
+		defer delete(s.variables, name)
+		if !ranged {
+			for _, x := range evaluated {
+				if err := iterate(x); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		start, step, end := evaluated[0], 1.0, evaluated[1]
+		if len(evaluated) == 3 {
+			step, end = evaluated[1], evaluated[2]
+		}
+		if step == 0 {
+			return fmt.Errorf("line %d: range step is zero", line)
+		}
+		for i, x := 0, start; (step > 0 && x <= end) || (step < 0 && x >= end); i, x = i+1, x+step {
+			if i == MaxIterations {
+				return fmt.Errorf("line %d: for loop exceeds %d iterations", line, MaxIterations)
+			}
+			if err := iterate(x); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
+
+// modifiers parses the gate modifiers of a call
+func (p *Program) modifiers() ([]qasm3Modifier, error) {
+	modifiers := []qasm3Modifier{}
+	for p.is("ctrl") || p.is("negctrl") || p.is("inv") || p.is("pow") {
+		modifier := qasm3Modifier{kind: p.next().text}
+		if modifier.kind != "inv" && p.accept("(") {
+			argument, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			modifier.argument = argument
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+		if modifier.kind == "pow" && modifier.argument == nil {
+			return nil, p.errorf("pow requires an exponent")
+		}
+		if err := p.expect("@"); err != nil {
+			return nil, err
+		}
+		modifiers = append(modifiers, modifier)
+	}
+	return modifiers, nil
+}
+
+// evaluate evaluates the modifiers and parameters of a call
+func evaluate(modifiers []qasm3Modifier, parameters []expression, variables map[string]float64) ([]modifier, []float64, error) {
+	evaluated := make([]modifier, len(modifiers))
+	for i, m := range modifiers {
+		evaluated[i] = modifier{kind: m.kind, value: 1}
+		if m.argument != nil {
+			value, err := m.argument(variables)
+			if err != nil {
+				return nil, nil, err
+			}
+			evaluated[i].value = value
+		}
+	}
+	values := make([]float64, len(parameters))
+	for i, parameter := range parameters {
+		value, err := parameter(variables)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[i] = value
+	}
+	return evaluated, values, nil
+}
+
+// definition parses a gate definition
+func (p *Program) definition() error {
+	p.next()
+	name, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	definition := &qasm3Definition{}
+	if p.accept("(") && !p.accept(")") {
+		if definition.parameters, err = p.names(); err != nil {
+			return err
+		}
+		if err := p.expect(")"); err != nil {
+			return err
+		}
+	}
+	if !p.is("{") {
+		if definition.qubits, err = p.names(); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.accept("}") {
+		if p.peek().kind == tokenEOF {
+			return p.errorf("unterminated definition of %s", name)
+		}
+		call := qasm3Call{line: p.peek().line}
+		if p.accept("barrier") {
+			if _, err := p.names(); err != nil {
+				return err
+			}
+			if err := p.expect(";"); err != nil {
+				return err
+			}
+			continue
+		}
+		if call.modifiers, err = p.modifiers(); err != nil {
+			return err
+		}
+		if call.name, err = p.identifier(); err != nil {
+			return err
+		}
+		if call.parameters, err = p.parameters(); err != nil {
+			return err
+		}
+		if !p.is(";") {
+			if call.qubits, err = p.names(); err != nil {
+				return err
+			}
+		}
+		if err := p.expect(";"); err != nil {
+			return err
+		}
+		definition.body = append(definition.body, call)
+	}
+	if _, ok := lookup(name); !ok {
+		if err := p.declare(name); err != nil {
+			return err
+		}
+		p.definitions[name] = definition
+	}
+	return nil
+}
+
+// call parses a gate call on register operands
+func (p *Program) call(line int) (qasm3Statement, error) {
+	modifiers, err := p.modifiers()
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	parameters, err := p.parameters()
+	if err != nil {
+		return nil, err
+	}
+	operands := []qasm3Operand{}
+	for !p.is(";") {
+		operand, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+		if !p.accept(",") {
+			break
+		}
+	}
+	return func(s *qasm3State) error {
+		modifiers, parameters, err := evaluate(modifiers, parameters, s.variables)
+		if err != nil {
+			return err
+		}
+		resolved, size := make([][]Qubit, len(operands)), 1
+		for i, operand := range operands {
+			if resolved[i], err = p.resolve(s, operand, line); err != nil {
+				return err
+			}
+			if len(resolved[i]) > 1 {
+				if size > 1 && len(resolved[i]) != size {
+					return fmt.Errorf("line %d: registers of %s have different sizes", line, name)
+				}
+				size = len(resolved[i])
+			}
+		}
+		for i := 0; i < size; i++ {
+			qubits := make([]Qubit, len(resolved))
+			for j, operand := range resolved {
+				if len(operand) == 1 {
+					qubits[j] = operand[0]
+				} else {
+					qubits[j] = operand[i]
+				}
+			}
+			if err := p.apply(s.machine, modifiers, name, parameters, qubits, line, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, p.expect(";")
+}
+
+// apply applies a gate with modifiers to the qubits of a machine. Controls
+// are applied with Controlled or ApplyUnitary to the unitary of the rest of
+// the gate, which is found by simulating it.
+func (p *Program) apply(machine Machine, modifiers []modifier, name string, parameters []float64, qubits []Qubit, line, depth int) error {
+	if depth > 64 {
+		return fmt.Errorf("line %d: gate %s is nested too deeply", line, name)
+	}
+	seen := make(map[Qubit]bool)
+	for _, qubit := range qubits {
+		if seen[qubit] {
+			return fmt.Errorf("line %d: qubit %d is given to %s more than once", line, qubit, name)
+		}
+		seen[qubit] = true
+	}
+	if len(modifiers) == 0 {
+		return p.gate(machine, name, parameters, qubits, line, depth)
+	}
+	controls, negated, i := 0, []Qubit{}, 0
+	for ; i < len(modifiers) && (modifiers[i].kind == "ctrl" || modifiers[i].kind == "negctrl"); i++ {
+		n := int(modifiers[i].value)
+		if n < 1 || float64(n) != modifiers[i].value || controls+n > len(qubits) {
+			return fmt.Errorf("line %d: invalid number of controls for %s", line, name)
+		}
+		if modifiers[i].kind == "negctrl" {
+			negated = append(negated, qubits[controls:controls+n]...)
+		}
+		controls += n
+	}
+	targets := qubits[controls:]
+	u, err := p.unitary(modifiers[i:], name, parameters, len(targets), line, depth)
+	if err != nil {
+		return err
+	}
+	if len(negated) > 0 {
+		machine.X(negated...)
+	}
+	switch {
+	case controls == 0 && len(targets) == 0:
+		phase(machine, u.Matrix[0])
+	case controls == 0:
+		err = machine.ApplyUnitary(u, targets...)
+	case len(targets) == 1:
+		machine.Controlled(u, qubits[:controls], targets[0])
+	default:
+		err = machine.ApplyUnitary(controlledMatrix(u, controls), qubits...)
+	}
+	if len(negated) > 0 {
+		machine.X(negated...)
+	}
+	return err
+}
+
+// gate applies a gate without modifiers
+func (p *Program) gate(machine Machine, name string, parameters []float64, qubits []Qubit, line, depth int) error {
+	if name == "gphase" {
+		if len(parameters) != 1 || len(qubits) != 0 {
+			return fmt.Errorf("line %d: gphase takes 1 parameter and no qubits", line)
+		}
+		phase(machine, cmplx.Exp(complex(0, parameters[0])))
+		return nil
+	}
+	if gate, ok := lookup(name); ok {
+		if len(parameters) != gate.parameters || len(qubits) != gate.qubits {
+			return fmt.Errorf("line %d: %s takes %d parameters and %d qubits", line, name, gate.parameters, gate.qubits)
+		}
+		gates := gate.lower(parameters, qubits)
+		for i := range gates {
+			gates[i].Apply(machine)
+		}
+		return nil
+	}
+	definition, ok := p.definitions[name]
+	if !ok {
+		return fmt.Errorf("line %d: unknown gate %s", line, name)
+	}
+	if len(parameters) != len(definition.parameters) || len(qubits) != len(definition.qubits) {
+		return fmt.Errorf("line %d: %s takes %d parameters and %d qubits", line, name,
+			len(definition.parameters), len(definition.qubits))
+	}
+	variables := make(map[string]float64)
+	for i, parameter := range definition.parameters {
+		variables[parameter] = parameters[i]
+	}
+	arguments := make(map[string]Qubit)
+	for i, qubit := range definition.qubits {
+		arguments[qubit] = qubits[i]
+	}
+	for _, call := range definition.body {
+		modifiers, values, err := evaluate(call.modifiers, call.parameters, variables)
+		if err != nil {
+			return err
+		}
+		targets := make([]Qubit, len(call.qubits))
+		for i, argument := range call.qubits {
+			qubit, ok := arguments[argument]
+			if !ok {
+				return fmt.Errorf("line %d: unknown qubit %s", call.line, argument)
+			}
+			targets[i] = qubit
+		}
+		if err := p.apply(machine, modifiers, call.name, values, targets, call.line, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unitary finds the unitary of a gate with modifiers on n qubits
+func (p *Program) unitary(modifiers []modifier, name string, parameters []float64, n, line, depth int) (*Dense128, error) {
+	if len(modifiers) > 0 && modifiers[0].kind != "ctrl" && modifiers[0].kind != "negctrl" {
+		u, err := p.unitary(modifiers[1:], name, parameters, n, line, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if modifiers[0].kind == "inv" {
+			return adjoint(u), nil
+		}
+		power := modifiers[0].value
+		if power != math.Trunc(power) {
+			return nil, fmt.Errorf("line %d: only integer powers are supported", line)
+		}
+		if power < 0 {
+			u, power = adjoint(u), -power
+		}
+		result := identity(u.R)
+		for ; power > 0; power-- {
+			result = product(result, u)
+		}
+		return result, nil
+	}
+	d := 1 << uint(n)
+	u := &Dense128{R: d, C: d, Matrix: make([]complex128, d*d)}
+	qubits := make([]Qubit, n)
+	for i := range qubits {
+		qubits[i] = Qubit(i)
+	}
+	for j := 0; j < d; j++ {
+		machine := &MachineVector128{Vector128: make(Vector128, d), Qubits: n}
+		machine.Vector128[j] = 1
+		if err := p.apply(machine, modifiers, name, parameters, qubits, line, depth+1); err != nil {
+			return nil, err
+		}
+		for i, value := range machine.Vector128 {
+			u.Matrix[i*d+j] = value
+		}
+	}
+	return u, nil
+}
+
+// phase multiplies the state by a global phase, which is only observable in
+// the machines used to find the unitaries of controlled gates
+func phase(machine Machine, c complex128) {
+	if m, ok := machine.(*MachineVector128); ok {
+		for i := range m.Vector128 {
+			m.Vector128[i] *= c
+		}
+	}
+}
+
+// identity returns the identity matrix of size d
+func identity(d int) *Dense128 {
+	u := &Dense128{R: d, C: d, Matrix: make([]complex128, d*d)}
+	for i := 0; i < d; i++ {
+		u.Matrix[i*d+i] = 1
+	}
+	return u
+}
+
+// product multiplies square matrices
+func product(a, b *Dense128) *Dense128 {
+	d := a.R
+	c := &Dense128{R: d, C: d, Matrix: make([]complex128, d*d)}
+	for i := 0; i < d; i++ {
+		for k := 0; k < d; k++ {
+			x := a.Matrix[i*d+k]
+			if x == 0 {
+				continue
+			}
+			for j := 0; j < d; j++ {
+				c.Matrix[i*d+j] += x * b.Matrix[k*d+j]
+			}
+		}
+	}
+	return c
+}
+
+// adjoint returns the conjugate transpose of a square matrix
+func adjoint(u *Dense128) *Dense128 {
+	d := u.R
+	a := &Dense128{R: d, C: d, Matrix: make([]complex128, d*d)}
+	for i := 0; i < d; i++ {
+		for j := 0; j < d; j++ {
+			a.Matrix[j*d+i] = cmplx.Conj(u.Matrix[i*d+j])
+		}
+	}
+	return a
+}
+
+// controlledMatrix returns the matrix applying u when the first controls qubits are
+// one
+func controlledMatrix(u *Dense128, controls int) *Dense128 {
+	d := u.R << uint(controls)
+	c := identity(d)
+	offset := d - u.R
+	for i := 0; i < u.R; i++ {
+		c.Matrix[(offset+i)*d+offset+i] = 0
+		for j := 0; j < u.R; j++ {
+			c.Matrix[(offset+i)*d+offset+j] = u.Matrix[i*u.R+j]
+		}
+	}
+	return c
+}
+
+// Bits returns the names of the bit registers in the order they are declared
+func (p *Program) Bits() []string {
+	names := make([]string, len(p.order))
+	copy(names, p.order)
+	return names
+}
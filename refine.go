@@ -0,0 +1,185 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"math"
+	"sort"
+)
+
+// setParameters sets the angles of a gate in the order of parameters
+func (g *Gate) setParameters(values []float64) {
+	switch g.GateType {
+	case GateTypeU, GateTypeU3, GateTypeCU:
+		g.Theta, g.Phi, g.Lambda = values[0], values[1], values[2]
+	case GateTypeU2:
+		g.Phi, g.Lambda = values[0], values[1]
+	case GateTypeP, GateTypeU1, GateTypeCPhase:
+		g.Lambda = values[0]
+	case GateTypeRX, GateTypeRY, GateTypeRZ, GateTypeRXX, GateTypeRYY, GateTypeRZZ,
+		GateTypeCRX, GateTypeCRY, GateTypeCRZ:
+		g.Theta = values[0]
+	}
+}
+
+// angles returns the angles of all of the gates of the genome
+func (g *Genome) angles() []float64 {
+	angles := []float64{}
+	for i := range g.Gates {
+		angles = append(angles, g.Gates[i].parameters()...)
+	}
+	return angles
+}
+
+// setAngles sets the angles of all of the gates of the genome
+func (g *Genome) setAngles(angles []float64) {
+	for i := range g.Gates {
+		n := len(g.Gates[i].parameters())
+		g.Gates[i].setParameters(angles[:n])
+		angles = angles[n:]
+	}
+}
+
+// Refine optimizes the angles of the gates of the genome for a fixed gate
+// structure with the Nelder-Mead method, executing the genome at most
+// evaluations times. The fitness function should change continuously with the
+// angles, such as ExpectedBitError, CrossEntropy or StateFidelity. The genome
+// keeps its angles if they can not be improved or an execution fails.
+func (g *Genome) Refine(evaluations int) error {
+	x := g.angles()
+	n := len(x)
+	if n == 0 || evaluations <= 0 {
+		return nil
+	}
+	if err := g.Execute(); err != nil {
+		return err
+	}
+	work := g.Copy()
+	count := 1
+	var err error
+	f := func(x []float64) float64 {
+		count++
+		work.setAngles(x)
+		if err = work.Execute(); err != nil {
+			count = evaluations
+			return math.Inf(1)
+		}
+		return work.Fitness
+	}
+
+	const (
+		step        = .5
+		reflection  = 1.0
+		expansion   = 2.0
+		contraction = .5
+		shrink      = .5
+	)
+	simplex, values := make([][]float64, n+1), make([]float64, n+1)
+	simplex[0], values[0] = x, g.Fitness
+	built := 1
+	for i := 1; i <= n && count < evaluations; i++ {
+		vertex := append([]float64(nil), x...)
+		vertex[i-1] += step
+		simplex[i], values[i] = vertex, f(vertex)
+		built++
+	}
+	simplex, values = simplex[:built], values[:built]
+	order := func() {
+		indexes := make([]int, len(simplex))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return values[indexes[i]] < values[indexes[j]]
+		})
+		s, v := make([][]float64, len(simplex)), make([]float64, len(simplex))
+		for i, index := range indexes {
+			s[i], v[i] = simplex[index], values[index]
+		}
+		simplex, values = s, v
+	}
+	point := func(a []float64, b []float64, t float64) []float64 {
+		p := make([]float64, n)
+		for i := range p {
+			p[i] = a[i] + t*(b[i]-a[i])
+		}
+		return p
+	}
+	for len(simplex) == n+1 && count < evaluations {
+		order()
+		if math.Abs(values[n]-values[0]) < 1e-12 {
+			break
+		}
+		centroid := make([]float64, n)
+		for _, vertex := range simplex[:n] {
+			for i := range centroid {
+				centroid[i] += vertex[i] / float64(n)
+			}
+		}
+		reflected := point(centroid, simplex[n], -reflection)
+		fr := f(reflected)
+		switch {
+		case fr < values[0]:
+			expanded := point(centroid, simplex[n], -expansion)
+			if count < evaluations {
+				if fe := f(expanded); fe < fr {
+					simplex[n], values[n] = expanded, fe
+					continue
+				}
+			}
+			simplex[n], values[n] = reflected, fr
+		case fr < values[n-1]:
+			simplex[n], values[n] = reflected, fr
+		default:
+			contracted := point(centroid, simplex[n], contraction)
+			if count < evaluations {
+				if fc := f(contracted); fc < values[n] {
+					simplex[n], values[n] = contracted, fc
+					continue
+				}
+			}
+			for i := 1; i <= n && count < evaluations; i++ {
+				simplex[i] = point(simplex[0], simplex[i], shrink)
+				values[i] = f(simplex[i])
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	order()
+	if values[0] < g.Fitness {
+		g.setAngles(simplex[0])
+		g.Fitness = values[0]
+	}
+	return nil
+}
+
+// refine refines the angles of the fittest genomes of the ranked population
+// concurrently and ranks the population again. Genomes that were refined in
+// an earlier generation and have not changed since are not refined again.
+func (o *optimizer) refine() error {
+	genomes := o.genomes
+	refinements := o.Refinements
+	if refinements > len(genomes) {
+		refinements = len(genomes)
+	}
+	errs := make([]error, refinements)
+	o.concurrently(refinements, func(i int) {
+		if genomes[i].refined {
+			return
+		}
+		genomes[i].Gates = genomes[i].Copy().Gates
+		errs[i] = genomes[i].Refine(o.RefinementEvaluations)
+		genomes[i].refined = errs[i] == nil
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	o.order(genomes)
+	return nil
+}
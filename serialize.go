@@ -0,0 +1,392 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the version of the JSON and YAML encoding of genomes and
+// circuits
+const SchemaVersion = 1
+
+// gateTypeNames are the names of the gate types used in encodings
+var gateTypeNames = map[GateType]string{
+	GateTypeControlledNot: "cnot",
+	GateTypeI:             "i",
+	GateTypeH:             "h",
+	GateTypeX:             "x",
+	GateTypeY:             "y",
+	GateTypeZ:             "z",
+	GateTypeS:             "s",
+	GateTypeT:             "t",
+	GateTypeU:             "u",
+	GateTypeRX:            "rx",
+	GateTypeRY:            "ry",
+	GateTypeRZ:            "rz",
+	GateTypeSX:            "sx",
+	GateTypeSXdg:          "sxdg",
+	GateTypeSdg:           "sdg",
+	GateTypeTdg:           "tdg",
+	GateTypeP:             "p",
+	GateTypeU1:            "u1",
+	GateTypeU2:            "u2",
+	GateTypeU3:            "u3",
+	GateTypeSwap:          "swap",
+	GateTypeISwap:         "iswap",
+	GateTypeSqrtSwap:      "sqrtswap",
+	GateTypeRXX:           "rxx",
+	GateTypeRYY:           "ryy",
+	GateTypeRZZ:           "rzz",
+	GateTypeECR:           "ecr",
+	GateTypeCSwap:         "cswap",
+	GateTypeCZ:            "cz",
+	GateTypeCH:            "ch",
+	GateTypeCU:            "cu",
+	GateTypeCRX:           "crx",
+	GateTypeCRY:           "cry",
+	GateTypeCRZ:           "crz",
+	GateTypeCPhase:        "cphase",
+	GateTypeMeasure:       "measure",
+	GateTypeBarrier:       "barrier",
+}
+
+// String returns the name of the gate type
+func (t GateType) String() string {
+	if name, ok := gateTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("GateType(%d)", int(t))
+}
+
+// ParseGateType returns the gate type with the name
+func ParseGateType(name string) (GateType, error) {
+	for gateType, value := range gateTypeNames {
+		if value == name {
+			return gateType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown gate %s", name)
+}
+
+// String formats the gate as its name, parameters and qubits
+func (g Gate) String() string {
+	var builder strings.Builder
+	builder.WriteString(g.GateType.String())
+	switch g.GateType {
+	case GateTypeU, GateTypeU3, GateTypeCU:
+		fmt.Fprintf(&builder, "(%g,%g,%g)", g.Theta, g.Phi, g.Lambda)
+	case GateTypeU2:
+		fmt.Fprintf(&builder, "(%g,%g)", g.Phi, g.Lambda)
+	case GateTypeP, GateTypeU1, GateTypeCPhase:
+		fmt.Fprintf(&builder, "(%g)", g.Lambda)
+	case GateTypeRX, GateTypeRY, GateTypeRZ, GateTypeRXX, GateTypeRYY, GateTypeRZZ,
+		GateTypeCRX, GateTypeCRY, GateTypeCRZ:
+		fmt.Fprintf(&builder, "(%g)", g.Theta)
+	}
+	fmt.Fprintf(&builder, " %v", g.Qubits)
+	if g.Controlled() {
+		fmt.Fprintf(&builder, " -> %d", g.Target)
+	}
+	if g.GateType == GateTypeMeasure {
+		fmt.Fprintf(&builder, " -> %v", g.Bits)
+	}
+	return builder.String()
+}
+
+// gateEncoding is the encoding of a gate
+type gateEncoding struct {
+	Gate   string  `json:"gate" yaml:"gate"`
+	Qubits []Qubit `json:"qubits,omitempty" yaml:"qubits,flow,omitempty"`
+	Target *Qubit  `json:"target,omitempty" yaml:"target,omitempty"`
+	Theta  float64 `json:"theta,omitempty" yaml:"theta,omitempty"`
+	Phi    float64 `json:"phi,omitempty" yaml:"phi,omitempty"`
+	Lambda float64 `json:"lambda,omitempty" yaml:"lambda,omitempty"`
+	Bits   []int   `json:"bits,omitempty" yaml:"bits,flow,omitempty"`
+}
+
+// encode converts a gate to its encoding
+func (g *Gate) encode() (*gateEncoding, error) {
+	name, ok := gateTypeNames[g.GateType]
+	if !ok {
+		return nil, fmt.Errorf("unknown gate type %d", g.GateType)
+	}
+	e := &gateEncoding{
+		Gate:   name,
+		Qubits: g.Qubits,
+		Theta:  g.Theta,
+		Phi:    g.Phi,
+		Lambda: g.Lambda,
+		Bits:   g.Bits,
+	}
+	if g.Controlled() {
+		target := g.Target
+		e.Target = &target
+	}
+	return e, nil
+}
+
+// decode converts an encoding to a gate
+func (g *Gate) decode(e *gateEncoding) error {
+	gateType, err := ParseGateType(e.Gate)
+	if err != nil {
+		return err
+	}
+	*g = Gate{
+		GateType: gateType,
+		Qubits:   e.Qubits,
+		Theta:    e.Theta,
+		Phi:      e.Phi,
+		Lambda:   e.Lambda,
+		Bits:     e.Bits,
+	}
+	if g.Controlled() {
+		if e.Target == nil {
+			return fmt.Errorf("%s requires a target", e.Gate)
+		}
+		g.Target = *e.Target
+	}
+	return g.validate()
+}
+
+// MarshalJSON encodes the gate as JSON
+func (g Gate) MarshalJSON() ([]byte, error) {
+	e, err := g.encode()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// UnmarshalJSON decodes the gate from JSON
+func (g *Gate) UnmarshalJSON(data []byte) error {
+	var e gateEncoding
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	return g.decode(&e)
+}
+
+// MarshalYAML encodes the gate as YAML
+func (g Gate) MarshalYAML() (interface{}, error) {
+	return g.encode()
+}
+
+// UnmarshalYAML decodes the gate from YAML
+func (g *Gate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var e gateEncoding
+	if err := unmarshal(&e); err != nil {
+		return err
+	}
+	return g.decode(&e)
+}
+
+// fit checks that the gates act on the qubits of a circuit of width qubits
+// and measure into its bits classical bits
+func fit(gates []Gate, width, bits int) error {
+	if width < 0 {
+		return fmt.Errorf("width %d is negative", width)
+	}
+	for i := range gates {
+		for _, qubit := range gates[i].Operands() {
+			if int(qubit) >= width {
+				return fmt.Errorf("gate %d: qubit %d is not in a circuit of %d qubits", i, qubit, width)
+			}
+		}
+		for _, bit := range gates[i].Bits {
+			if bit < 0 || bit >= bits {
+				return fmt.Errorf("gate %d: bit %d is not in a circuit of %d bits", i, bit, bits)
+			}
+		}
+	}
+	return nil
+}
+
+// version checks the schema version of an encoding
+func version(v int) error {
+	if v != SchemaVersion {
+		return fmt.Errorf("unsupported schema version %d", v)
+	}
+	return nil
+}
+
+// number is a float64 that is encoded in JSON as a string if it is NaN or
+// infinite
+type number float64
+
+// MarshalJSON encodes the number as JSON
+func (n number) MarshalJSON() ([]byte, error) {
+	f := float64(n)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return json.Marshal(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return json.Marshal(f)
+}
+
+// UnmarshalJSON decodes the number from JSON
+func (n *number) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return json.Unmarshal(data, (*float64)(n))
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	*n = number(f)
+	return nil
+}
+
+// genomeEncoding is the encoding of a genome
+type genomeEncoding struct {
+	Version       int            `json:"version" yaml:"version"`
+	Backend       string         `json:"backend,omitempty" yaml:"backend,omitempty"`
+	Width         int            `json:"width" yaml:"width"`
+	Fitness       number         `json:"fitness" yaml:"fitness"`
+	Gates         []Gate         `json:"gates" yaml:"gates"`
+	Probabilities [][2][]float64 `json:"probabilities,omitempty" yaml:"probabilities,omitempty"`
+}
+
+// encode converts a genome to its encoding
+func (g *Genome) encode() *genomeEncoding {
+	return &genomeEncoding{
+		Version:       SchemaVersion,
+		Backend:       g.Backend,
+		Width:         g.Width,
+		Fitness:       number(g.Fitness),
+		Gates:         g.Gates,
+		Probabilities: g.Probabilities,
+	}
+}
+
+// decode converts an encoding to a genome
+func (g *Genome) decode(e *genomeEncoding) error {
+	if err := version(e.Version); err != nil {
+		return err
+	}
+	if err := fit(e.Gates, e.Width, 0); err != nil {
+		return err
+	}
+	*g = Genome{
+		Backend:       e.Backend,
+		Width:         e.Width,
+		Fitness:       float64(e.Fitness),
+		Gates:         e.Gates,
+		Probabilities: e.Probabilities,
+	}
+	return nil
+}
+
+// MarshalJSON encodes the genome as JSON
+func (g Genome) MarshalJSON() ([]byte, error) {
+	return json.Marshal(g.encode())
+}
+
+// UnmarshalJSON decodes the genome from JSON
+func (g *Genome) UnmarshalJSON(data []byte) error {
+	var e genomeEncoding
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	return g.decode(&e)
+}
+
+// MarshalYAML encodes the genome as YAML
+func (g Genome) MarshalYAML() (interface{}, error) {
+	return g.encode(), nil
+}
+
+// UnmarshalYAML decodes the genome from YAML
+func (g *Genome) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var e genomeEncoding
+	if err := unmarshal(&e); err != nil {
+		return err
+	}
+	return g.decode(&e)
+}
+
+// registerEncoding is the encoding of a classical register
+type registerEncoding struct {
+	Name string `json:"name" yaml:"name"`
+	Size int    `json:"size" yaml:"size"`
+}
+
+// circuitEncoding is the encoding of a circuit
+type circuitEncoding struct {
+	Version   int                `json:"version" yaml:"version"`
+	Width     int                `json:"width" yaml:"width"`
+	Registers []registerEncoding `json:"registers,omitempty" yaml:"registers,omitempty"`
+	Gates     []Gate             `json:"gates" yaml:"gates"`
+}
+
+// encode converts a circuit to its encoding
+func (c *Circuit) encode() *circuitEncoding {
+	e := &circuitEncoding{
+		Version: SchemaVersion,
+		Width:   c.Width,
+		Gates:   c.Gates,
+	}
+	for _, register := range c.Registers {
+		e.Registers = append(e.Registers, registerEncoding{
+			Name: register.Name,
+			Size: register.Size,
+		})
+	}
+	return e
+}
+
+// decode converts an encoding to a circuit
+func (c *Circuit) decode(e *circuitEncoding) error {
+	if err := version(e.Version); err != nil {
+		return err
+	}
+	circuit := Circuit{
+		Width: e.Width,
+		Gates: e.Gates,
+	}
+	for _, register := range e.Registers {
+		if register.Size < 0 {
+			return fmt.Errorf("register %s has a negative size", register.Name)
+		}
+		circuit.Register(register.Name, register.Size)
+	}
+	if err := fit(circuit.Gates, circuit.Width, circuit.Bits()); err != nil {
+		return err
+	}
+	*c = circuit
+	return nil
+}
+
+// MarshalJSON encodes the circuit as JSON
+func (c Circuit) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.encode())
+}
+
+// UnmarshalJSON decodes the circuit from JSON
+func (c *Circuit) UnmarshalJSON(data []byte) error {
+	var e circuitEncoding
+	if err := json.Unmarshal(data, &e); err != nil {
+		return err
+	}
+	return c.decode(&e)
+}
+
+// MarshalYAML encodes the circuit as YAML
+func (c Circuit) MarshalYAML() (interface{}, error) {
+	return c.encode(), nil
+}
+
+// UnmarshalYAML decodes the circuit from YAML
+func (c *Circuit) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var e circuitEncoding
+	if err := unmarshal(&e); err != nil {
+		return err
+	}
+	return c.decode(&e)
+}
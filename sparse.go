@@ -32,6 +32,20 @@ func (a Sparse64) String() string {
 	return output
 }
 
+// Dims returns the dimensions of the matrix
+func (a *Sparse64) Dims() (r, c int) {
+	return a.R, a.C
+}
+
+// At returns the value at row i and column j
+func (a *Sparse64) At(i, j int) complex128 {
+	row := a.Matrix[i]
+	if row == nil {
+		return 0
+	}
+	return complex128(row[j])
+}
+
 // Vector64 is a 64 bit vector
 type Vector64 []complex64
 
@@ -75,6 +89,15 @@ func (a *MachineSparse64) One() Qubit {
 	return qubit
 }
 
+// State returns the state vector of the machine
+func (a *MachineSparse64) State() Vector128 {
+	state := make(Vector128, 0, len(a.Vector64))
+	for _, value := range a.Vector64 {
+		state = append(state, complex128(value))
+	}
+	return state
+}
+
 // Tensor product is the tensor product
 func (a *Sparse64) Tensor(b *Sparse64) *Sparse64 {
 	output := make([]map[int]complex64, a.R*b.R)
@@ -203,9 +226,9 @@ func (a *Sparse64) MultiplyVector(b Vector64) Vector64 {
 	return output
 }
 
-// ControlledNot controlled not gate
-func (a *MachineSparse64) ControlledNot(c []Qubit, t Qubit) *Sparse64 {
-	n := a.Qubits
+// ControlledNotSparse64 controlled not matrix for n qubits
+func ControlledNotSparse64(n int, c []Qubit, t Qubit) *Sparse64 {
+	identity := controlsTarget(c, t)
 	p := &Sparse64{
 		R: 2,
 		C: 2,
@@ -229,7 +252,7 @@ func (a *MachineSparse64) ControlledNot(c []Qubit, t Qubit) *Sparse64 {
 		bits := int64(i)
 
 		// Apply X
-		apply := true
+		apply := !identity
 		for _, j := range c {
 			if (bits>>(Qubit(n-1)-j))&1 == 0 {
 				apply = false
@@ -257,11 +280,16 @@ func (a *MachineSparse64) ControlledNot(c []Qubit, t Qubit) *Sparse64 {
 		g.Matrix[i] = q.Matrix[int(ii)]
 	}
 
-	a.Vector64 = g.MultiplyVector(a.Vector64)
-
 	return &g
 }
 
+// ControlledNot controlled not gate
+func (a *MachineSparse64) ControlledNot(c []Qubit, t Qubit) Machine {
+	g := ControlledNotSparse64(a.Qubits, c, t)
+	a.Vector64 = g.MultiplyVector(a.Vector64)
+	return a
+}
+
 // Multiply multiplies the machine by a matrix
 func (a *MachineSparse64) Multiply(b *Sparse64, qubits ...Qubit) {
 	indexes := make(map[int]bool)
@@ -303,7 +331,7 @@ func ISparse64() *Sparse64 {
 }
 
 // I multiply by identity
-func (a *MachineSparse64) I(qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) I(qubits ...Qubit) Machine {
 	a.Multiply(ISparse64(), qubits...)
 	return a
 }
@@ -328,7 +356,7 @@ func HSparse64() *Sparse64 {
 }
 
 // H multiply by Hadamard gate
-func (a *MachineSparse64) H(qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) H(qubits ...Qubit) Machine {
 	a.Multiply(HSparse64(), qubits...)
 	return a
 }
@@ -350,7 +378,7 @@ func XSparse64() *Sparse64 {
 }
 
 // X multiply by Pauli X matrix
-func (a *MachineSparse64) X(qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) X(qubits ...Qubit) Machine {
 	a.Multiply(XSparse64(), qubits...)
 	return a
 }
@@ -372,7 +400,7 @@ func YSparse64() *Sparse64 {
 }
 
 // Y multiply by Pauli Y matrix
-func (a *MachineSparse64) Y(qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) Y(qubits ...Qubit) Machine {
 	a.Multiply(YSparse64(), qubits...)
 	return a
 }
@@ -394,7 +422,7 @@ func ZSparse64() *Sparse64 {
 }
 
 // Z multiply by Pauli Z matrix
-func (a *MachineSparse64) Z(qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) Z(qubits ...Qubit) Machine {
 	a.Multiply(ZSparse64(), qubits...)
 	return a
 }
@@ -416,7 +444,7 @@ func SSparse64() *Sparse64 {
 }
 
 // S multiply by phase matrix
-func (a *MachineSparse64) S(qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) S(qubits ...Qubit) Machine {
 	a.Multiply(SSparse64(), qubits...)
 	return a
 }
@@ -438,7 +466,7 @@ func TSparse64() *Sparse64 {
 }
 
 // T multiply by T matrix
-func (a *MachineSparse64) T(qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) T(qubits ...Qubit) Machine {
 	a.Multiply(TSparse64(), qubits...)
 	return a
 }
@@ -463,7 +491,7 @@ func USparse64(theta, phi, lambda float64) *Sparse64 {
 }
 
 // U multiply by U matrix
-func (a *MachineSparse64) U(theta, phi, lambda float64, qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) U(theta, phi, lambda float64, qubits ...Qubit) Machine {
 	a.Multiply(USparse64(theta, phi, lambda), qubits...)
 	return a
 }
@@ -487,7 +515,7 @@ func RXSparse64(theta complex128) *Sparse64 {
 }
 
 // RX rotate X gate
-func (a *MachineSparse64) RX(theta float64, qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) RX(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RXSparse64(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -511,7 +539,7 @@ func RYSparse64(theta complex128) *Sparse64 {
 }
 
 // RY rotate Y gate
-func (a *MachineSparse64) RY(theta float64, qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) RY(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RYSparse64(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -523,23 +551,23 @@ func RZSparse64(theta complex128) *Sparse64 {
 		C: 2,
 		Matrix: []map[int]complex64{
 			map[int]complex64{
-				0: complex64(cmplx.Exp(-1 * complex128(theta))),
+				0: complex64(cmplx.Exp(-1i * complex128(theta))),
 			},
 			map[int]complex64{
-				1: complex64(cmplx.Exp(complex128(theta))),
+				1: complex64(cmplx.Exp(1i * complex128(theta))),
 			},
 		},
 	}
 }
 
 // RZ rotate Z gate
-func (a *MachineSparse64) RZ(theta float64, qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) RZ(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RZSparse64(complex(theta/2, 0)), qubits...)
 	return a
 }
 
 // Swap swaps qubits`
-func (a *MachineSparse64) Swap(qubits ...Qubit) *MachineSparse64 {
+func (a *MachineSparse64) Swap(qubits ...Qubit) Machine {
 	length := len(qubits)
 
 	for i := 0; i < length/2; i++ {
@@ -552,6 +580,301 @@ func (a *MachineSparse64) Swap(qubits ...Qubit) *MachineSparse64 {
 	return a
 }
 
+// PSparse64 phase matrix
+func PSparse64(lambda float64) *Sparse64 {
+	return &Sparse64{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex64{
+			map[int]complex64{
+				0: 1,
+			},
+			map[int]complex64{
+				1: complex64(cmplx.Exp(complex(0, lambda))),
+			},
+		},
+	}
+}
+
+// SXSparse64 square root of X matrix
+func SXSparse64() *Sparse64 {
+	return &Sparse64{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex64{
+			map[int]complex64{
+				0: complex(.5, .5),
+				1: complex(.5, -.5),
+			},
+			map[int]complex64{
+				0: complex(.5, -.5),
+				1: complex(.5, .5),
+			},
+		},
+	}
+}
+
+// SXdgSparse64 inverse square root of X matrix
+func SXdgSparse64() *Sparse64 {
+	return &Sparse64{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex64{
+			map[int]complex64{
+				0: complex(.5, -.5),
+				1: complex(.5, .5),
+			},
+			map[int]complex64{
+				0: complex(.5, .5),
+				1: complex(.5, -.5),
+			},
+		},
+	}
+}
+
+// SdgSparse64 inverse phase gate
+func SdgSparse64() *Sparse64 {
+	return &Sparse64{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex64{
+			map[int]complex64{
+				0: 1,
+			},
+			map[int]complex64{
+				1: -1i,
+			},
+		},
+	}
+}
+
+// TdgSparse64 inverse T gate
+func TdgSparse64() *Sparse64 {
+	return &Sparse64{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex64{
+			map[int]complex64{
+				0: 1,
+			},
+			map[int]complex64{
+				1: complex64(cmplx.Exp(-1i * math.Pi / 4)),
+			},
+		},
+	}
+}
+
+// ControlledSparse64 controlled gate matrix for n qubits
+func ControlledSparse64(n int, gate Matrix, c []Qubit, t Qubit) *Sparse64 {
+	identity := controlsTarget(c, t)
+	if rows, cols := gate.Dims(); rows != 2 || cols != 2 {
+		panic("invalid dimensions")
+	}
+	d := 1 << uint(n)
+	controls, target := 0, 1<<(Qubit(n-1)-t)
+	for _, j := range c {
+		controls |= 1 << (Qubit(n-1) - j)
+	}
+	g := Sparse64{
+		R:      d,
+		C:      d,
+		Matrix: make([]map[int]complex64, d),
+	}
+	for i := 0; i < d; i++ {
+		if identity || i&controls != controls {
+			g.Matrix[i] = map[int]complex64{
+				i: 1,
+			}
+			continue
+		}
+		x := 0
+		if i&target != 0 {
+			x = 1
+		}
+		row := make(map[int]complex64)
+		if value := complex64(gate.At(x, 0)); value != 0 {
+			row[i&^target] = value
+		}
+		if value := complex64(gate.At(x, 1)); value != 0 {
+			row[i|target] = value
+		}
+		g.Matrix[i] = row
+	}
+	return &g
+}
+
+// Controlled multiplies the target by a matrix when the controls are one
+func (a *MachineSparse64) Controlled(gate Matrix, c []Qubit, t Qubit) Machine {
+	a.Vector64 = ControlledSparse64(a.Qubits, gate, c, t).MultiplyVector(a.Vector64)
+	return a
+}
+
+// CZ controlled Pauli Z gate
+func (a *MachineSparse64) CZ(c []Qubit, t Qubit) Machine {
+	return a.Controlled(ZSparse64(), c, t)
+}
+
+// CH controlled Hadamard gate
+func (a *MachineSparse64) CH(c []Qubit, t Qubit) Machine {
+	return a.Controlled(HSparse64(), c, t)
+}
+
+// CU controlled U gate
+func (a *MachineSparse64) CU(theta, phi, lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(USparse64(theta, phi, lambda), c, t)
+}
+
+// CRX controlled rotate X gate
+func (a *MachineSparse64) CRX(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RXSparse64(complex(theta/2, 0)), c, t)
+}
+
+// CRY controlled rotate Y gate
+func (a *MachineSparse64) CRY(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RYSparse64(complex(theta/2, 0)), c, t)
+}
+
+// CRZ controlled rotate Z gate
+func (a *MachineSparse64) CRZ(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RZSparse64(complex(theta/2, 0)), c, t)
+}
+
+// CPhase controlled phase gate
+func (a *MachineSparse64) CPhase(lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(PSparse64(lambda), c, t)
+}
+
+// Toffoli controlled controlled not gate
+func (a *MachineSparse64) Toffoli(c0, c1, t Qubit) Machine {
+	return a.ControlledNot([]Qubit{c0, c1}, t)
+}
+
+// Fredkin controlled swap gate
+func (a *MachineSparse64) Fredkin(c, t0, t1 Qubit) Machine {
+	a.ControlledNot([]Qubit{t1}, t0)
+	a.ControlledNot([]Qubit{c, t0}, t1)
+	a.ControlledNot([]Qubit{t1}, t0)
+	return a
+}
+
+// UnitarySparse64 unitary matrix applied to qubits of an n qubit machine
+func UnitarySparse64(n int, u Matrix, qubits ...Qubit) *Sparse64 {
+	d, s := 1<<uint(n), newSubspace(n, qubits)
+	m := 1 << uint(len(qubits))
+	g := Sparse64{
+		R:      d,
+		C:      d,
+		Matrix: make([]map[int]complex64, d),
+	}
+	for i := 0; i < d; i++ {
+		x, base := s.index(i), i&^s.mask
+		row := make(map[int]complex64)
+		for k := 0; k < m; k++ {
+			if value := complex64(u.At(x, k)); value != 0 {
+				row[base|s.spread(k)] = value
+			}
+		}
+		g.Matrix[i] = row
+	}
+	return &g
+}
+
+// ApplyUnitary multiplies the qubits by a unitary matrix, the first qubit is
+// the most significant bit of the matrix index
+func (a *MachineSparse64) ApplyUnitary(u Matrix, qubits ...Qubit) error {
+	if err := validate(u, a.Qubits, qubits); err != nil {
+		return err
+	}
+	a.unitary(u, qubits...)
+	return nil
+}
+
+// SX multiply by square root of X matrix
+func (a *MachineSparse64) SX(qubits ...Qubit) Machine {
+	a.Multiply(SXSparse64(), qubits...)
+	return a
+}
+
+// SXdg multiply by inverse square root of X matrix
+func (a *MachineSparse64) SXdg(qubits ...Qubit) Machine {
+	a.Multiply(SXdgSparse64(), qubits...)
+	return a
+}
+
+// Sdg multiply by inverse phase matrix
+func (a *MachineSparse64) Sdg(qubits ...Qubit) Machine {
+	a.Multiply(SdgSparse64(), qubits...)
+	return a
+}
+
+// Tdg multiply by inverse T matrix
+func (a *MachineSparse64) Tdg(qubits ...Qubit) Machine {
+	a.Multiply(TdgSparse64(), qubits...)
+	return a
+}
+
+// P multiply by phase matrix with angle lambda
+func (a *MachineSparse64) P(lambda float64, qubits ...Qubit) Machine {
+	a.Multiply(PSparse64(lambda), qubits...)
+	return a
+}
+
+// U1 multiply by U1 matrix, an alias for P
+func (a *MachineSparse64) U1(lambda float64, qubits ...Qubit) Machine {
+	return a.P(lambda, qubits...)
+}
+
+// U2 multiply by U2 matrix, an alias for U with theta pi/2
+func (a *MachineSparse64) U2(phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(math.Pi/2, phi, lambda, qubits...)
+}
+
+// U3 multiply by U3 matrix, an alias for U
+func (a *MachineSparse64) U3(theta, phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(theta, phi, lambda, qubits...)
+}
+
+// unitary multiplies the qubits by a matrix without validating it
+func (a *MachineSparse64) unitary(u Matrix, qubits ...Qubit) {
+	a.Vector64 = UnitarySparse64(a.Qubits, u, qubits...).MultiplyVector(a.Vector64)
+}
+
+// ISwap iSWAP gate
+func (a *MachineSparse64) ISwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ISwapDense128(), q0, q1)
+	return a
+}
+
+// SqrtSwap square root of swap gate
+func (a *MachineSparse64) SqrtSwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(SqrtSwapDense128(), q0, q1)
+	return a
+}
+
+// RXX XX rotation gate
+func (a *MachineSparse64) RXX(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RXXDense128(theta), q0, q1)
+	return a
+}
+
+// RYY YY rotation gate
+func (a *MachineSparse64) RYY(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RYYDense128(theta), q0, q1)
+	return a
+}
+
+// RZZ ZZ rotation gate
+func (a *MachineSparse64) RZZ(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RZZDense128(theta), q0, q1)
+	return a
+}
+
+// ECR echoed cross resonance gate
+func (a *MachineSparse64) ECR(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ECRDense128(), q0, q1)
+	return a
+}
+
 // Sparse128 is an algebriac matrix
 type Sparse128 struct {
 	R, C   int
@@ -574,6 +897,20 @@ func (a Sparse128) String() string {
 	return output
 }
 
+// Dims returns the dimensions of the matrix
+func (a *Sparse128) Dims() (r, c int) {
+	return a.R, a.C
+}
+
+// At returns the value at row i and column j
+func (a *Sparse128) At(i, j int) complex128 {
+	row := a.Matrix[i]
+	if row == nil {
+		return 0
+	}
+	return row[j]
+}
+
 // MachineSparse128 is a 128 bit sparse matrix machine
 type MachineSparse128 struct {
 	Vector128
@@ -606,6 +943,13 @@ func (a *MachineSparse128) One() Qubit {
 	return qubit
 }
 
+// State returns the state vector of the machine
+func (a *MachineSparse128) State() Vector128 {
+	state := make(Vector128, len(a.Vector128))
+	copy(state, a.Vector128)
+	return state
+}
+
 // Tensor product is the tensor product
 func (a *Sparse128) Tensor(b *Sparse128) *Sparse128 {
 	output := make([]map[int]complex128, a.R*b.R)
@@ -722,9 +1066,9 @@ func (a *Sparse128) MultiplyVector(b Vector128) Vector128 {
 	return output
 }
 
-// ControlledNot controlled not gate
-func (a *MachineSparse128) ControlledNot(c []Qubit, t Qubit) *Sparse128 {
-	n := a.Qubits
+// ControlledNotSparse128 controlled not matrix for n qubits
+func ControlledNotSparse128(n int, c []Qubit, t Qubit) *Sparse128 {
+	identity := controlsTarget(c, t)
 	p := &Sparse128{
 		R: 2,
 		C: 2,
@@ -748,7 +1092,7 @@ func (a *MachineSparse128) ControlledNot(c []Qubit, t Qubit) *Sparse128 {
 		bits := int64(i)
 
 		// Apply X
-		apply := true
+		apply := !identity
 		for _, j := range c {
 			if (bits>>(Qubit(n-1)-j))&1 == 0 {
 				apply = false
@@ -776,11 +1120,16 @@ func (a *MachineSparse128) ControlledNot(c []Qubit, t Qubit) *Sparse128 {
 		g.Matrix[i] = q.Matrix[int(ii)]
 	}
 
-	a.Vector128 = g.MultiplyVector(a.Vector128)
-
 	return &g
 }
 
+// ControlledNot controlled not gate
+func (a *MachineSparse128) ControlledNot(c []Qubit, t Qubit) Machine {
+	g := ControlledNotSparse128(a.Qubits, c, t)
+	a.Vector128 = g.MultiplyVector(a.Vector128)
+	return a
+}
+
 // Multiply multiplies the machine by a matrix
 func (a *MachineSparse128) Multiply(b *Sparse128, qubits ...Qubit) {
 	indexes := make(map[int]bool)
@@ -822,7 +1171,7 @@ func ISparse128() *Sparse128 {
 }
 
 // I multiply by identity
-func (a *MachineSparse128) I(qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) I(qubits ...Qubit) Machine {
 	a.Multiply(ISparse128(), qubits...)
 	return a
 }
@@ -847,7 +1196,7 @@ func HSparse128() *Sparse128 {
 }
 
 // H multiply by Hadamard gate
-func (a *MachineSparse128) H(qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) H(qubits ...Qubit) Machine {
 	a.Multiply(HSparse128(), qubits...)
 	return a
 }
@@ -869,7 +1218,7 @@ func XSparse128() *Sparse128 {
 }
 
 // X multiply by Pauli X matrix
-func (a *MachineSparse128) X(qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) X(qubits ...Qubit) Machine {
 	a.Multiply(XSparse128(), qubits...)
 	return a
 }
@@ -891,7 +1240,7 @@ func YSparse128() *Sparse128 {
 }
 
 // Y multiply by Pauli Y matrix
-func (a *MachineSparse128) Y(qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) Y(qubits ...Qubit) Machine {
 	a.Multiply(YSparse128(), qubits...)
 	return a
 }
@@ -913,7 +1262,7 @@ func ZSparse128() *Sparse128 {
 }
 
 // Z multiply by Pauli Z matrix
-func (a *MachineSparse128) Z(qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) Z(qubits ...Qubit) Machine {
 	a.Multiply(ZSparse128(), qubits...)
 	return a
 }
@@ -935,7 +1284,7 @@ func SSparse128() *Sparse128 {
 }
 
 // S multiply by phase matrix
-func (a *MachineSparse128) S(qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) S(qubits ...Qubit) Machine {
 	a.Multiply(SSparse128(), qubits...)
 	return a
 }
@@ -957,7 +1306,7 @@ func TSparse128() *Sparse128 {
 }
 
 // T multiply by T matrix
-func (a *MachineSparse128) T(qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) T(qubits ...Qubit) Machine {
 	a.Multiply(TSparse128(), qubits...)
 	return a
 }
@@ -982,7 +1331,7 @@ func USparse128(theta, phi, lambda float64) *Sparse128 {
 }
 
 // U multiply by U matrix
-func (a *MachineSparse128) U(theta, phi, lambda float64, qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) U(theta, phi, lambda float64, qubits ...Qubit) Machine {
 	a.Multiply(USparse128(theta, phi, lambda), qubits...)
 	return a
 }
@@ -1006,7 +1355,7 @@ func RXSparse128(theta complex128) *Sparse128 {
 }
 
 // RX rotate X gate
-func (a *MachineSparse128) RX(theta float64, qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) RX(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RXSparse128(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -1030,7 +1379,7 @@ func RYSparse128(theta complex128) *Sparse128 {
 }
 
 // RY rotate Y gate
-func (a *MachineSparse128) RY(theta float64, qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) RY(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RYSparse128(complex(theta/2, 0)), qubits...)
 	return a
 }
@@ -1042,23 +1391,23 @@ func RZSparse128(theta complex128) *Sparse128 {
 		C: 2,
 		Matrix: []map[int]complex128{
 			map[int]complex128{
-				0: cmplx.Exp(-1 * theta),
+				0: cmplx.Exp(-1i * theta),
 			},
 			map[int]complex128{
-				1: cmplx.Exp(theta),
+				1: cmplx.Exp(1i * theta),
 			},
 		},
 	}
 }
 
 // RZ rotate Z gate
-func (a *MachineSparse128) RZ(theta float64, qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) RZ(theta float64, qubits ...Qubit) Machine {
 	a.Multiply(RZSparse128(complex(theta/2, 0)), qubits...)
 	return a
 }
 
 // Swap swaps qubits`
-func (a *MachineSparse128) Swap(qubits ...Qubit) *MachineSparse128 {
+func (a *MachineSparse128) Swap(qubits ...Qubit) Machine {
 	length := len(qubits)
 
 	for i := 0; i < length/2; i++ {
@@ -1070,3 +1419,298 @@ func (a *MachineSparse128) Swap(qubits ...Qubit) *MachineSparse128 {
 
 	return a
 }
+
+// PSparse128 phase matrix
+func PSparse128(lambda float64) *Sparse128 {
+	return &Sparse128{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex128{
+			map[int]complex128{
+				0: 1,
+			},
+			map[int]complex128{
+				1: cmplx.Exp(complex(0, lambda)),
+			},
+		},
+	}
+}
+
+// SXSparse128 square root of X matrix
+func SXSparse128() *Sparse128 {
+	return &Sparse128{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex128{
+			map[int]complex128{
+				0: complex(.5, .5),
+				1: complex(.5, -.5),
+			},
+			map[int]complex128{
+				0: complex(.5, -.5),
+				1: complex(.5, .5),
+			},
+		},
+	}
+}
+
+// SXdgSparse128 inverse square root of X matrix
+func SXdgSparse128() *Sparse128 {
+	return &Sparse128{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex128{
+			map[int]complex128{
+				0: complex(.5, -.5),
+				1: complex(.5, .5),
+			},
+			map[int]complex128{
+				0: complex(.5, .5),
+				1: complex(.5, -.5),
+			},
+		},
+	}
+}
+
+// SdgSparse128 inverse phase gate
+func SdgSparse128() *Sparse128 {
+	return &Sparse128{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex128{
+			map[int]complex128{
+				0: 1,
+			},
+			map[int]complex128{
+				1: -1i,
+			},
+		},
+	}
+}
+
+// TdgSparse128 inverse T gate
+func TdgSparse128() *Sparse128 {
+	return &Sparse128{
+		R: 2,
+		C: 2,
+		Matrix: []map[int]complex128{
+			map[int]complex128{
+				0: 1,
+			},
+			map[int]complex128{
+				1: cmplx.Exp(-1i * math.Pi / 4),
+			},
+		},
+	}
+}
+
+// ControlledSparse128 controlled gate matrix for n qubits
+func ControlledSparse128(n int, gate Matrix, c []Qubit, t Qubit) *Sparse128 {
+	identity := controlsTarget(c, t)
+	if rows, cols := gate.Dims(); rows != 2 || cols != 2 {
+		panic("invalid dimensions")
+	}
+	d := 1 << uint(n)
+	controls, target := 0, 1<<(Qubit(n-1)-t)
+	for _, j := range c {
+		controls |= 1 << (Qubit(n-1) - j)
+	}
+	g := Sparse128{
+		R:      d,
+		C:      d,
+		Matrix: make([]map[int]complex128, d),
+	}
+	for i := 0; i < d; i++ {
+		if identity || i&controls != controls {
+			g.Matrix[i] = map[int]complex128{
+				i: 1,
+			}
+			continue
+		}
+		x := 0
+		if i&target != 0 {
+			x = 1
+		}
+		row := make(map[int]complex128)
+		if value := gate.At(x, 0); value != 0 {
+			row[i&^target] = value
+		}
+		if value := gate.At(x, 1); value != 0 {
+			row[i|target] = value
+		}
+		g.Matrix[i] = row
+	}
+	return &g
+}
+
+// Controlled multiplies the target by a matrix when the controls are one
+func (a *MachineSparse128) Controlled(gate Matrix, c []Qubit, t Qubit) Machine {
+	a.Vector128 = ControlledSparse128(a.Qubits, gate, c, t).MultiplyVector(a.Vector128)
+	return a
+}
+
+// CZ controlled Pauli Z gate
+func (a *MachineSparse128) CZ(c []Qubit, t Qubit) Machine {
+	return a.Controlled(ZSparse128(), c, t)
+}
+
+// CH controlled Hadamard gate
+func (a *MachineSparse128) CH(c []Qubit, t Qubit) Machine {
+	return a.Controlled(HSparse128(), c, t)
+}
+
+// CU controlled U gate
+func (a *MachineSparse128) CU(theta, phi, lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(USparse128(theta, phi, lambda), c, t)
+}
+
+// CRX controlled rotate X gate
+func (a *MachineSparse128) CRX(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RXSparse128(complex(theta/2, 0)), c, t)
+}
+
+// CRY controlled rotate Y gate
+func (a *MachineSparse128) CRY(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RYSparse128(complex(theta/2, 0)), c, t)
+}
+
+// CRZ controlled rotate Z gate
+func (a *MachineSparse128) CRZ(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RZSparse128(complex(theta/2, 0)), c, t)
+}
+
+// CPhase controlled phase gate
+func (a *MachineSparse128) CPhase(lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(PSparse128(lambda), c, t)
+}
+
+// Toffoli controlled controlled not gate
+func (a *MachineSparse128) Toffoli(c0, c1, t Qubit) Machine {
+	return a.ControlledNot([]Qubit{c0, c1}, t)
+}
+
+// Fredkin controlled swap gate
+func (a *MachineSparse128) Fredkin(c, t0, t1 Qubit) Machine {
+	a.ControlledNot([]Qubit{t1}, t0)
+	a.ControlledNot([]Qubit{c, t0}, t1)
+	a.ControlledNot([]Qubit{t1}, t0)
+	return a
+}
+
+// UnitarySparse128 unitary matrix applied to qubits of an n qubit machine
+func UnitarySparse128(n int, u Matrix, qubits ...Qubit) *Sparse128 {
+	d, s := 1<<uint(n), newSubspace(n, qubits)
+	m := 1 << uint(len(qubits))
+	g := Sparse128{
+		R:      d,
+		C:      d,
+		Matrix: make([]map[int]complex128, d),
+	}
+	for i := 0; i < d; i++ {
+		x, base := s.index(i), i&^s.mask
+		row := make(map[int]complex128)
+		for k := 0; k < m; k++ {
+			if value := u.At(x, k); value != 0 {
+				row[base|s.spread(k)] = value
+			}
+		}
+		g.Matrix[i] = row
+	}
+	return &g
+}
+
+// ApplyUnitary multiplies the qubits by a unitary matrix, the first qubit is
+// the most significant bit of the matrix index
+func (a *MachineSparse128) ApplyUnitary(u Matrix, qubits ...Qubit) error {
+	if err := validate(u, a.Qubits, qubits); err != nil {
+		return err
+	}
+	a.unitary(u, qubits...)
+	return nil
+}
+
+// SX multiply by square root of X matrix
+func (a *MachineSparse128) SX(qubits ...Qubit) Machine {
+	a.Multiply(SXSparse128(), qubits...)
+	return a
+}
+
+// SXdg multiply by inverse square root of X matrix
+func (a *MachineSparse128) SXdg(qubits ...Qubit) Machine {
+	a.Multiply(SXdgSparse128(), qubits...)
+	return a
+}
+
+// Sdg multiply by inverse phase matrix
+func (a *MachineSparse128) Sdg(qubits ...Qubit) Machine {
+	a.Multiply(SdgSparse128(), qubits...)
+	return a
+}
+
+// Tdg multiply by inverse T matrix
+func (a *MachineSparse128) Tdg(qubits ...Qubit) Machine {
+	a.Multiply(TdgSparse128(), qubits...)
+	return a
+}
+
+// P multiply by phase matrix with angle lambda
+func (a *MachineSparse128) P(lambda float64, qubits ...Qubit) Machine {
+	a.Multiply(PSparse128(lambda), qubits...)
+	return a
+}
+
+// U1 multiply by U1 matrix, an alias for P
+func (a *MachineSparse128) U1(lambda float64, qubits ...Qubit) Machine {
+	return a.P(lambda, qubits...)
+}
+
+// U2 multiply by U2 matrix, an alias for U with theta pi/2
+func (a *MachineSparse128) U2(phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(math.Pi/2, phi, lambda, qubits...)
+}
+
+// U3 multiply by U3 matrix, an alias for U
+func (a *MachineSparse128) U3(theta, phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(theta, phi, lambda, qubits...)
+}
+
+// unitary multiplies the qubits by a matrix without validating it
+func (a *MachineSparse128) unitary(u Matrix, qubits ...Qubit) {
+	a.Vector128 = UnitarySparse128(a.Qubits, u, qubits...).MultiplyVector(a.Vector128)
+}
+
+// ISwap iSWAP gate
+func (a *MachineSparse128) ISwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ISwapDense128(), q0, q1)
+	return a
+}
+
+// SqrtSwap square root of swap gate
+func (a *MachineSparse128) SqrtSwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(SqrtSwapDense128(), q0, q1)
+	return a
+}
+
+// RXX XX rotation gate
+func (a *MachineSparse128) RXX(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RXXDense128(theta), q0, q1)
+	return a
+}
+
+// RYY YY rotation gate
+func (a *MachineSparse128) RYY(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RYYDense128(theta), q0, q1)
+	return a
+}
+
+// RZZ ZZ rotation gate
+func (a *MachineSparse128) RZZ(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RZZDense128(theta), q0, q1)
+	return a
+}
+
+// ECR echoed cross resonance gate
+func (a *MachineSparse128) ECR(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ECRDense128(), q0, q1)
+	return a
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// StateCutoff is the magnitude below which amplitudes are left out of a
+// state string
+const StateCutoff = 1e-6
+
+// index converts a bitstring with qubit 0 first to a basis state index
+func index(bitstring string, width int) int {
+	if len(bitstring) != width {
+		panic(fmt.Sprintf("bitstring %s should have %d qubits", bitstring, width))
+	}
+	i, err := strconv.ParseUint(bitstring, 2, 64)
+	if err != nil {
+		panic(fmt.Sprintf("invalid bitstring %s", bitstring))
+	}
+	return int(i)
+}
+
+// ket formats the amplitudes of a state vector in Dirac notation
+func ket(amplitude func(i int) complex128, size, width int) string {
+	var builder strings.Builder
+	for i := 0; i < size; i++ {
+		value := amplitude(i)
+		if math.Hypot(real(value), imag(value)) < StateCutoff {
+			continue
+		}
+		r, c := real(value), imag(value)
+		if math.Abs(c) < StateCutoff {
+			c = 0
+		}
+		if math.Abs(r) < StateCutoff {
+			r = 0
+		}
+		var coefficient string
+		switch {
+		case c == 0:
+			coefficient = fmt.Sprintf("%.3f", r)
+		case r == 0:
+			coefficient = fmt.Sprintf("%.3fi", c)
+		default:
+			coefficient = fmt.Sprintf("(%.3f%+.3fi)", r, c)
+		}
+		if builder.Len() > 0 {
+			if strings.HasPrefix(coefficient, "-") {
+				builder.WriteString(" - ")
+				coefficient = coefficient[1:]
+			} else {
+				builder.WriteString(" + ")
+			}
+		}
+		builder.WriteString(coefficient)
+		builder.WriteString("|")
+		builder.WriteString(Bitstring(i, width))
+		builder.WriteString(">")
+	}
+	if builder.Len() == 0 {
+		return "0"
+	}
+	return builder.String()
+}
+
+// Probabilities returns the probability of each basis state
+func (a Vector64) Probabilities() []float64 {
+	probabilities := make([]float64, 0, len(a))
+	for _, value := range a {
+		probabilities = append(probabilities, float64(real(value)*real(value)+imag(value)*imag(value)))
+	}
+	return probabilities
+}
+
+// Amplitude returns the amplitude of the basis state given as a bitstring
+// with qubit 0 first
+func (a Vector64) Amplitude(bitstring string) complex128 {
+	return complex128(a[index(bitstring, a.Width())])
+}
+
+// Norm returns the euclidean norm of the state vector
+func (a Vector64) Norm() float64 {
+	sum := 0.0
+	for _, value := range a {
+		sum += float64(real(value)*real(value) + imag(value)*imag(value))
+	}
+	return math.Sqrt(sum)
+}
+
+// StateString formats the state vector in Dirac notation
+func (a Vector64) StateString() string {
+	return ket(func(i int) complex128 {
+		return complex128(a[i])
+	}, len(a), a.Width())
+}
+
+// Probabilities returns the probability of each basis state
+func (a Vector128) Probabilities() []float64 {
+	probabilities := make([]float64, 0, len(a))
+	for _, value := range a {
+		probabilities = append(probabilities, real(value)*real(value)+imag(value)*imag(value))
+	}
+	return probabilities
+}
+
+// Amplitude returns the amplitude of the basis state given as a bitstring
+// with qubit 0 first
+func (a Vector128) Amplitude(bitstring string) complex128 {
+	return a[index(bitstring, a.Width())]
+}
+
+// Norm returns the euclidean norm of the state vector
+func (a Vector128) Norm() float64 {
+	sum := 0.0
+	for _, value := range a {
+		sum += real(value)*real(value) + imag(value)*imag(value)
+	}
+	return math.Sqrt(sum)
+}
+
+// StateString formats the state vector in Dirac notation
+func (a Vector128) StateString() string {
+	return ket(func(i int) complex128 {
+		return a[i]
+	}, len(a), a.Width())
+}
+
+// Probabilities returns the probability of each basis state
+func (a *MachineDense64) Probabilities() []float64 {
+	return Vector64(a.Matrix).Probabilities()
+}
+
+// Amplitude returns the amplitude of the basis state given as a bitstring
+// with qubit 0 first
+func (a *MachineDense64) Amplitude(bitstring string) complex128 {
+	return Vector64(a.Matrix).Amplitude(bitstring)
+}
+
+// Norm returns the euclidean norm of the state of the machine
+func (a *MachineDense64) Norm() float64 {
+	return Vector64(a.Matrix).Norm()
+}
+
+// StateString formats the state of the machine in Dirac notation
+func (a *MachineDense64) StateString() string {
+	return Vector64(a.Matrix).StateString()
+}
+
+// Probabilities returns the probability of each basis state
+func (a *MachineDense128) Probabilities() []float64 {
+	return Vector128(a.Matrix).Probabilities()
+}
+
+// Amplitude returns the amplitude of the basis state given as a bitstring
+// with qubit 0 first
+func (a *MachineDense128) Amplitude(bitstring string) complex128 {
+	return Vector128(a.Matrix).Amplitude(bitstring)
+}
+
+// Norm returns the euclidean norm of the state of the machine
+func (a *MachineDense128) Norm() float64 {
+	return Vector128(a.Matrix).Norm()
+}
+
+// StateString formats the state of the machine in Dirac notation
+func (a *MachineDense128) StateString() string {
+	return Vector128(a.Matrix).StateString()
+}
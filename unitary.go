@@ -0,0 +1,110 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import (
+	"errors"
+	"fmt"
+	"math/cmplx"
+)
+
+// UnitaryTolerance is the largest deviation of U^dagger U from the identity
+// for a matrix to be considered unitary
+const UnitaryTolerance = 1e-5
+
+// ErrNotUnitary is returned when a matrix applied to a machine is not unitary
+var ErrNotUnitary = errors.New("matrix is not unitary")
+
+// IsUnitary checks if a square matrix is unitary within the tolerance
+func IsUnitary(u Matrix, tolerance float64) bool {
+	r, c := u.Dims()
+	if r != c {
+		return false
+	}
+	for i := 0; i < c; i++ {
+		for j := 0; j < c; j++ {
+			var sum complex128
+			for k := 0; k < r; k++ {
+				sum += cmplx.Conj(u.At(k, i)) * u.At(k, j)
+			}
+			if i == j {
+				sum--
+			}
+			if cmplx.Abs(sum) > tolerance {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validate checks that u is a unitary matrix for distinct qubits of an n
+// qubit machine
+func validate(u Matrix, n int, qubits []Qubit) error {
+	if len(qubits) == 0 {
+		return errors.New("no qubits given")
+	}
+	seen := make(map[Qubit]bool)
+	for _, qubit := range qubits {
+		if int(qubit) >= n {
+			return fmt.Errorf("qubit %d is not in a machine of %d qubits", qubit, n)
+		}
+		if seen[qubit] {
+			return fmt.Errorf("qubit %d is given more than once", qubit)
+		}
+		seen[qubit] = true
+	}
+	d := 1 << uint(len(qubits))
+	if r, c := u.Dims(); r != d || c != d {
+		return fmt.Errorf("matrix is %dx%d, %d qubits require %dx%d", r, c, len(qubits), d, d)
+	}
+	if !IsUnitary(u, UnitaryTolerance) {
+		return ErrNotUnitary
+	}
+	return nil
+}
+
+// subspace maps between basis state indexes of an n qubit machine and the
+// indexes of a matrix applied to some of its qubits
+type subspace struct {
+	masks []int
+	mask  int
+}
+
+// newSubspace creates a subspace for the qubits, the first qubit is the most
+// significant bit of the matrix index
+func newSubspace(n int, qubits []Qubit) subspace {
+	s := subspace{
+		masks: make([]int, len(qubits)),
+	}
+	for i, qubit := range qubits {
+		s.masks[i] = 1 << (Qubit(n-1) - qubit)
+		s.mask |= s.masks[i]
+	}
+	return s
+}
+
+// index extracts the matrix index from a basis state index
+func (s subspace) index(i int) int {
+	k := 0
+	for _, mask := range s.masks {
+		k <<= 1
+		if i&mask != 0 {
+			k |= 1
+		}
+	}
+	return k
+}
+
+// spread converts a matrix index into the bits of a basis state index
+func (s subspace) spread(k int) int {
+	i, m := 0, len(s.masks)
+	for j, mask := range s.masks {
+		if (k>>uint(m-1-j))&1 == 1 {
+			i |= mask
+		}
+	}
+	return i
+}
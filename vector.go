@@ -0,0 +1,735 @@
+// Copyright 2022 The Heisenberg Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heisenberg
+
+import "math"
+
+// The state vector machines apply gates directly to the state vector with
+// strided pair updates instead of building the 2^n x 2^n operator, so memory
+// and time per gate are linear in the size of the state.
+
+// MachineVector64 is a 64 bit state vector machine
+type MachineVector64 struct {
+	Vector64
+	Qubits int
+}
+
+// Zero adds a zero to the matrix
+func (a *MachineVector64) Zero() Qubit {
+	qubit := Qubit(a.Qubits)
+	a.Qubits++
+	zero := Vector64{1, 0}
+	if qubit == 0 {
+		a.Vector64 = zero
+		return qubit
+	}
+	a.Vector64 = a.Tensor(zero)
+	return qubit
+}
+
+// One adds a one to the matrix
+func (a *MachineVector64) One() Qubit {
+	qubit := Qubit(a.Qubits)
+	a.Qubits++
+	one := Vector64{0, 1}
+	if qubit == 0 {
+		a.Vector64 = one
+		return qubit
+	}
+	a.Vector64 = a.Tensor(one)
+	return qubit
+}
+
+// State returns the state vector of the machine
+func (a *MachineVector64) State() Vector128 {
+	state := make(Vector128, 0, len(a.Vector64))
+	for _, value := range a.Vector64 {
+		state = append(state, complex128(value))
+	}
+	return state
+}
+
+// mask returns the bit of the state index for a qubit
+func (a *MachineVector64) mask(qubit Qubit) int {
+	return 1 << (Qubit(a.Qubits-1) - qubit)
+}
+
+// ControlledNot controlled not gate
+func (a *MachineVector64) ControlledNot(c []Qubit, t Qubit) Machine {
+	if controlsTarget(c, t) {
+		return a
+	}
+	controls, target := 0, a.mask(t)
+	for _, qubit := range c {
+		controls |= a.mask(qubit)
+	}
+	for i := range a.Vector64 {
+		if i&target != 0 || i&controls != controls {
+			continue
+		}
+		j := i | target
+		a.Vector64[i], a.Vector64[j] = a.Vector64[j], a.Vector64[i]
+	}
+	return a
+}
+
+// apply multiplies the target by a matrix when the controls are one
+func (a *MachineVector64) apply(b Matrix, controls int, t Qubit) {
+	if rows, cols := b.Dims(); rows != 2 || cols != 2 {
+		panic("invalid dimensions")
+	}
+	m00, m01 := complex64(b.At(0, 0)), complex64(b.At(0, 1))
+	m10, m11 := complex64(b.At(1, 0)), complex64(b.At(1, 1))
+	stride := a.mask(t)
+	for i := 0; i < len(a.Vector64); i += 2 * stride {
+		for j := i; j < i+stride; j++ {
+			if j&controls != controls {
+				continue
+			}
+			x, y := a.Vector64[j], a.Vector64[j+stride]
+			a.Vector64[j] = m00*x + m01*y
+			a.Vector64[j+stride] = m10*x + m11*y
+		}
+	}
+}
+
+// Multiply multiplies the machine by a matrix
+func (a *MachineVector64) Multiply(b *Dense64, qubits ...Qubit) {
+	indexes := make(map[Qubit]bool)
+	for _, qubit := range qubits {
+		if indexes[qubit] {
+			continue
+		}
+		indexes[qubit] = true
+		a.apply(b, 0, qubit)
+	}
+}
+
+// I multiply by identity
+func (a *MachineVector64) I(qubits ...Qubit) Machine {
+	return a
+}
+
+// H multiply by Hadamard gate
+func (a *MachineVector64) H(qubits ...Qubit) Machine {
+	a.Multiply(HDense64(), qubits...)
+	return a
+}
+
+// X multiply by Pauli X matrix
+func (a *MachineVector64) X(qubits ...Qubit) Machine {
+	a.Multiply(XDense64(), qubits...)
+	return a
+}
+
+// Y multiply by Pauli Y matrix
+func (a *MachineVector64) Y(qubits ...Qubit) Machine {
+	a.Multiply(YDense64(), qubits...)
+	return a
+}
+
+// Z multiply by Pauli Z matrix
+func (a *MachineVector64) Z(qubits ...Qubit) Machine {
+	a.Multiply(ZDense64(), qubits...)
+	return a
+}
+
+// S multiply by phase matrix
+func (a *MachineVector64) S(qubits ...Qubit) Machine {
+	a.Multiply(SDense64(), qubits...)
+	return a
+}
+
+// T multiply by T matrix
+func (a *MachineVector64) T(qubits ...Qubit) Machine {
+	a.Multiply(TDense64(), qubits...)
+	return a
+}
+
+// U multiply by U matrix
+func (a *MachineVector64) U(theta, phi, lambda float64, qubits ...Qubit) Machine {
+	a.Multiply(UDense64(theta, phi, lambda), qubits...)
+	return a
+}
+
+// RX rotate X gate
+func (a *MachineVector64) RX(theta float64, qubits ...Qubit) Machine {
+	a.Multiply(RXDense64(complex(theta/2, 0)), qubits...)
+	return a
+}
+
+// RY rotate Y gate
+func (a *MachineVector64) RY(theta float64, qubits ...Qubit) Machine {
+	a.Multiply(RYDense64(complex(theta/2, 0)), qubits...)
+	return a
+}
+
+// RZ rotate Z gate
+func (a *MachineVector64) RZ(theta float64, qubits ...Qubit) Machine {
+	a.Multiply(RZDense64(complex(theta/2, 0)), qubits...)
+	return a
+}
+
+// Swap swaps qubits
+func (a *MachineVector64) Swap(qubits ...Qubit) Machine {
+	length := len(qubits)
+
+	for i := 0; i < length/2; i++ {
+		x, y := a.mask(qubits[i]), a.mask(qubits[(length-1)-i])
+		if x == y {
+			continue
+		}
+		for j := range a.Vector64 {
+			if j&x == 0 || j&y != 0 {
+				continue
+			}
+			k := j ^ x ^ y
+			a.Vector64[j], a.Vector64[k] = a.Vector64[k], a.Vector64[j]
+		}
+	}
+
+	return a
+}
+
+// Controlled multiplies the target by a matrix when the controls are one
+func (a *MachineVector64) Controlled(gate Matrix, c []Qubit, t Qubit) Machine {
+	if controlsTarget(c, t) {
+		return a
+	}
+	controls := 0
+	for _, qubit := range c {
+		controls |= a.mask(qubit)
+	}
+	a.apply(gate, controls, t)
+	return a
+}
+
+// CZ controlled Pauli Z gate
+func (a *MachineVector64) CZ(c []Qubit, t Qubit) Machine {
+	return a.Controlled(ZDense64(), c, t)
+}
+
+// CH controlled Hadamard gate
+func (a *MachineVector64) CH(c []Qubit, t Qubit) Machine {
+	return a.Controlled(HDense64(), c, t)
+}
+
+// CU controlled U gate
+func (a *MachineVector64) CU(theta, phi, lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(UDense64(theta, phi, lambda), c, t)
+}
+
+// CRX controlled rotate X gate
+func (a *MachineVector64) CRX(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RXDense64(complex(theta/2, 0)), c, t)
+}
+
+// CRY controlled rotate Y gate
+func (a *MachineVector64) CRY(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RYDense64(complex(theta/2, 0)), c, t)
+}
+
+// CRZ controlled rotate Z gate
+func (a *MachineVector64) CRZ(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RZDense64(complex(theta/2, 0)), c, t)
+}
+
+// CPhase controlled phase gate
+func (a *MachineVector64) CPhase(lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(PDense64(lambda), c, t)
+}
+
+// Toffoli controlled controlled not gate
+func (a *MachineVector64) Toffoli(c0, c1, t Qubit) Machine {
+	return a.ControlledNot([]Qubit{c0, c1}, t)
+}
+
+// Fredkin controlled swap gate
+func (a *MachineVector64) Fredkin(c, t0, t1 Qubit) Machine {
+	a.ControlledNot([]Qubit{t1}, t0)
+	a.ControlledNot([]Qubit{c, t0}, t1)
+	a.ControlledNot([]Qubit{t1}, t0)
+	return a
+}
+
+// ApplyUnitary multiplies the qubits by a unitary matrix, the first qubit is
+// the most significant bit of the matrix index
+func (a *MachineVector64) ApplyUnitary(u Matrix, qubits ...Qubit) error {
+	if err := validate(u, a.Qubits, qubits); err != nil {
+		return err
+	}
+	a.unitary(u, qubits...)
+	return nil
+}
+
+// SX multiply by square root of X matrix
+func (a *MachineVector64) SX(qubits ...Qubit) Machine {
+	a.Multiply(SXDense64(), qubits...)
+	return a
+}
+
+// SXdg multiply by inverse square root of X matrix
+func (a *MachineVector64) SXdg(qubits ...Qubit) Machine {
+	a.Multiply(SXdgDense64(), qubits...)
+	return a
+}
+
+// Sdg multiply by inverse phase matrix
+func (a *MachineVector64) Sdg(qubits ...Qubit) Machine {
+	a.Multiply(SdgDense64(), qubits...)
+	return a
+}
+
+// Tdg multiply by inverse T matrix
+func (a *MachineVector64) Tdg(qubits ...Qubit) Machine {
+	a.Multiply(TdgDense64(), qubits...)
+	return a
+}
+
+// P multiply by phase matrix with angle lambda
+func (a *MachineVector64) P(lambda float64, qubits ...Qubit) Machine {
+	a.Multiply(PDense64(lambda), qubits...)
+	return a
+}
+
+// U1 multiply by U1 matrix, an alias for P
+func (a *MachineVector64) U1(lambda float64, qubits ...Qubit) Machine {
+	return a.P(lambda, qubits...)
+}
+
+// U2 multiply by U2 matrix, an alias for U with theta pi/2
+func (a *MachineVector64) U2(phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(math.Pi/2, phi, lambda, qubits...)
+}
+
+// U3 multiply by U3 matrix, an alias for U
+func (a *MachineVector64) U3(theta, phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(theta, phi, lambda, qubits...)
+}
+
+// unitary multiplies the qubits by a matrix without validating it
+func (a *MachineVector64) unitary(u Matrix, qubits ...Qubit) {
+	s, m := newSubspace(a.Qubits, qubits), 1<<uint(len(qubits))
+	g := make([]complex64, m*m)
+	for i := range g {
+		g[i] = complex64(u.At(i/m, i%m))
+	}
+	indexes, x := make([]int, m), make([]complex64, m)
+	for k := range indexes {
+		indexes[k] = s.spread(k)
+	}
+	for base := range a.Vector64 {
+		if base&s.mask != 0 {
+			continue
+		}
+		for k, index := range indexes {
+			x[k] = a.Vector64[base|index]
+		}
+		for k, index := range indexes {
+			var sum complex64
+			for j, value := range x {
+				sum += g[k*m+j] * value
+			}
+			a.Vector64[base|index] = sum
+		}
+	}
+}
+
+// ISwap iSWAP gate
+func (a *MachineVector64) ISwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ISwapDense128(), q0, q1)
+	return a
+}
+
+// SqrtSwap square root of swap gate
+func (a *MachineVector64) SqrtSwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(SqrtSwapDense128(), q0, q1)
+	return a
+}
+
+// RXX XX rotation gate
+func (a *MachineVector64) RXX(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RXXDense128(theta), q0, q1)
+	return a
+}
+
+// RYY YY rotation gate
+func (a *MachineVector64) RYY(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RYYDense128(theta), q0, q1)
+	return a
+}
+
+// RZZ ZZ rotation gate
+func (a *MachineVector64) RZZ(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RZZDense128(theta), q0, q1)
+	return a
+}
+
+// ECR echoed cross resonance gate
+func (a *MachineVector64) ECR(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ECRDense128(), q0, q1)
+	return a
+}
+
+// MachineVector128 is a 128 bit state vector machine
+type MachineVector128 struct {
+	Vector128
+	Qubits int
+}
+
+// Zero adds a zero to the matrix
+func (a *MachineVector128) Zero() Qubit {
+	qubit := Qubit(a.Qubits)
+	a.Qubits++
+	zero := Vector128{1, 0}
+	if qubit == 0 {
+		a.Vector128 = zero
+		return qubit
+	}
+	a.Vector128 = a.Tensor(zero)
+	return qubit
+}
+
+// One adds a one to the matrix
+func (a *MachineVector128) One() Qubit {
+	qubit := Qubit(a.Qubits)
+	a.Qubits++
+	one := Vector128{0, 1}
+	if qubit == 0 {
+		a.Vector128 = one
+		return qubit
+	}
+	a.Vector128 = a.Tensor(one)
+	return qubit
+}
+
+// State returns the state vector of the machine
+func (a *MachineVector128) State() Vector128 {
+	state := make(Vector128, len(a.Vector128))
+	copy(state, a.Vector128)
+	return state
+}
+
+// mask returns the bit of the state index for a qubit
+func (a *MachineVector128) mask(qubit Qubit) int {
+	return 1 << (Qubit(a.Qubits-1) - qubit)
+}
+
+// ControlledNot controlled not gate
+func (a *MachineVector128) ControlledNot(c []Qubit, t Qubit) Machine {
+	if controlsTarget(c, t) {
+		return a
+	}
+	controls, target := 0, a.mask(t)
+	for _, qubit := range c {
+		controls |= a.mask(qubit)
+	}
+	for i := range a.Vector128 {
+		if i&target != 0 || i&controls != controls {
+			continue
+		}
+		j := i | target
+		a.Vector128[i], a.Vector128[j] = a.Vector128[j], a.Vector128[i]
+	}
+	return a
+}
+
+// apply multiplies the target by a matrix when the controls are one
+func (a *MachineVector128) apply(b Matrix, controls int, t Qubit) {
+	if rows, cols := b.Dims(); rows != 2 || cols != 2 {
+		panic("invalid dimensions")
+	}
+	m00, m01 := complex128(b.At(0, 0)), complex128(b.At(0, 1))
+	m10, m11 := complex128(b.At(1, 0)), complex128(b.At(1, 1))
+	stride := a.mask(t)
+	for i := 0; i < len(a.Vector128); i += 2 * stride {
+		for j := i; j < i+stride; j++ {
+			if j&controls != controls {
+				continue
+			}
+			x, y := a.Vector128[j], a.Vector128[j+stride]
+			a.Vector128[j] = m00*x + m01*y
+			a.Vector128[j+stride] = m10*x + m11*y
+		}
+	}
+}
+
+// Multiply multiplies the machine by a matrix
+func (a *MachineVector128) Multiply(b *Dense128, qubits ...Qubit) {
+	indexes := make(map[Qubit]bool)
+	for _, qubit := range qubits {
+		if indexes[qubit] {
+			continue
+		}
+		indexes[qubit] = true
+		a.apply(b, 0, qubit)
+	}
+}
+
+// I multiply by identity
+func (a *MachineVector128) I(qubits ...Qubit) Machine {
+	return a
+}
+
+// H multiply by Hadamard gate
+func (a *MachineVector128) H(qubits ...Qubit) Machine {
+	a.Multiply(HDense128(), qubits...)
+	return a
+}
+
+// X multiply by Pauli X matrix
+func (a *MachineVector128) X(qubits ...Qubit) Machine {
+	a.Multiply(XDense128(), qubits...)
+	return a
+}
+
+// Y multiply by Pauli Y matrix
+func (a *MachineVector128) Y(qubits ...Qubit) Machine {
+	a.Multiply(YDense128(), qubits...)
+	return a
+}
+
+// Z multiply by Pauli Z matrix
+func (a *MachineVector128) Z(qubits ...Qubit) Machine {
+	a.Multiply(ZDense128(), qubits...)
+	return a
+}
+
+// S multiply by phase matrix
+func (a *MachineVector128) S(qubits ...Qubit) Machine {
+	a.Multiply(SDense128(), qubits...)
+	return a
+}
+
+// T multiply by T matrix
+func (a *MachineVector128) T(qubits ...Qubit) Machine {
+	a.Multiply(TDense128(), qubits...)
+	return a
+}
+
+// U multiply by U matrix
+func (a *MachineVector128) U(theta, phi, lambda float64, qubits ...Qubit) Machine {
+	a.Multiply(UDense128(theta, phi, lambda), qubits...)
+	return a
+}
+
+// RX rotate X gate
+func (a *MachineVector128) RX(theta float64, qubits ...Qubit) Machine {
+	a.Multiply(RXDense128(complex(theta/2, 0)), qubits...)
+	return a
+}
+
+// RY rotate Y gate
+func (a *MachineVector128) RY(theta float64, qubits ...Qubit) Machine {
+	a.Multiply(RYDense128(complex(theta/2, 0)), qubits...)
+	return a
+}
+
+// RZ rotate Z gate
+func (a *MachineVector128) RZ(theta float64, qubits ...Qubit) Machine {
+	a.Multiply(RZDense128(complex(theta/2, 0)), qubits...)
+	return a
+}
+
+// Swap swaps qubits
+func (a *MachineVector128) Swap(qubits ...Qubit) Machine {
+	length := len(qubits)
+
+	for i := 0; i < length/2; i++ {
+		x, y := a.mask(qubits[i]), a.mask(qubits[(length-1)-i])
+		if x == y {
+			continue
+		}
+		for j := range a.Vector128 {
+			if j&x == 0 || j&y != 0 {
+				continue
+			}
+			k := j ^ x ^ y
+			a.Vector128[j], a.Vector128[k] = a.Vector128[k], a.Vector128[j]
+		}
+	}
+
+	return a
+}
+
+// Controlled multiplies the target by a matrix when the controls are one
+func (a *MachineVector128) Controlled(gate Matrix, c []Qubit, t Qubit) Machine {
+	if controlsTarget(c, t) {
+		return a
+	}
+	controls := 0
+	for _, qubit := range c {
+		controls |= a.mask(qubit)
+	}
+	a.apply(gate, controls, t)
+	return a
+}
+
+// CZ controlled Pauli Z gate
+func (a *MachineVector128) CZ(c []Qubit, t Qubit) Machine {
+	return a.Controlled(ZDense128(), c, t)
+}
+
+// CH controlled Hadamard gate
+func (a *MachineVector128) CH(c []Qubit, t Qubit) Machine {
+	return a.Controlled(HDense128(), c, t)
+}
+
+// CU controlled U gate
+func (a *MachineVector128) CU(theta, phi, lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(UDense128(theta, phi, lambda), c, t)
+}
+
+// CRX controlled rotate X gate
+func (a *MachineVector128) CRX(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RXDense128(complex(theta/2, 0)), c, t)
+}
+
+// CRY controlled rotate Y gate
+func (a *MachineVector128) CRY(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RYDense128(complex(theta/2, 0)), c, t)
+}
+
+// CRZ controlled rotate Z gate
+func (a *MachineVector128) CRZ(theta float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(RZDense128(complex(theta/2, 0)), c, t)
+}
+
+// CPhase controlled phase gate
+func (a *MachineVector128) CPhase(lambda float64, c []Qubit, t Qubit) Machine {
+	return a.Controlled(PDense128(lambda), c, t)
+}
+
+// Toffoli controlled controlled not gate
+func (a *MachineVector128) Toffoli(c0, c1, t Qubit) Machine {
+	return a.ControlledNot([]Qubit{c0, c1}, t)
+}
+
+// Fredkin controlled swap gate
+func (a *MachineVector128) Fredkin(c, t0, t1 Qubit) Machine {
+	a.ControlledNot([]Qubit{t1}, t0)
+	a.ControlledNot([]Qubit{c, t0}, t1)
+	a.ControlledNot([]Qubit{t1}, t0)
+	return a
+}
+
+// ApplyUnitary multiplies the qubits by a unitary matrix, the first qubit is
+// the most significant bit of the matrix index
+func (a *MachineVector128) ApplyUnitary(u Matrix, qubits ...Qubit) error {
+	if err := validate(u, a.Qubits, qubits); err != nil {
+		return err
+	}
+	a.unitary(u, qubits...)
+	return nil
+}
+
+// SX multiply by square root of X matrix
+func (a *MachineVector128) SX(qubits ...Qubit) Machine {
+	a.Multiply(SXDense128(), qubits...)
+	return a
+}
+
+// SXdg multiply by inverse square root of X matrix
+func (a *MachineVector128) SXdg(qubits ...Qubit) Machine {
+	a.Multiply(SXdgDense128(), qubits...)
+	return a
+}
+
+// Sdg multiply by inverse phase matrix
+func (a *MachineVector128) Sdg(qubits ...Qubit) Machine {
+	a.Multiply(SdgDense128(), qubits...)
+	return a
+}
+
+// Tdg multiply by inverse T matrix
+func (a *MachineVector128) Tdg(qubits ...Qubit) Machine {
+	a.Multiply(TdgDense128(), qubits...)
+	return a
+}
+
+// P multiply by phase matrix with angle lambda
+func (a *MachineVector128) P(lambda float64, qubits ...Qubit) Machine {
+	a.Multiply(PDense128(lambda), qubits...)
+	return a
+}
+
+// U1 multiply by U1 matrix, an alias for P
+func (a *MachineVector128) U1(lambda float64, qubits ...Qubit) Machine {
+	return a.P(lambda, qubits...)
+}
+
+// U2 multiply by U2 matrix, an alias for U with theta pi/2
+func (a *MachineVector128) U2(phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(math.Pi/2, phi, lambda, qubits...)
+}
+
+// U3 multiply by U3 matrix, an alias for U
+func (a *MachineVector128) U3(theta, phi, lambda float64, qubits ...Qubit) Machine {
+	return a.U(theta, phi, lambda, qubits...)
+}
+
+// unitary multiplies the qubits by a matrix without validating it
+func (a *MachineVector128) unitary(u Matrix, qubits ...Qubit) {
+	s, m := newSubspace(a.Qubits, qubits), 1<<uint(len(qubits))
+	g := make([]complex128, m*m)
+	for i := range g {
+		g[i] = complex128(u.At(i/m, i%m))
+	}
+	indexes, x := make([]int, m), make([]complex128, m)
+	for k := range indexes {
+		indexes[k] = s.spread(k)
+	}
+	for base := range a.Vector128 {
+		if base&s.mask != 0 {
+			continue
+		}
+		for k, index := range indexes {
+			x[k] = a.Vector128[base|index]
+		}
+		for k, index := range indexes {
+			var sum complex128
+			for j, value := range x {
+				sum += g[k*m+j] * value
+			}
+			a.Vector128[base|index] = sum
+		}
+	}
+}
+
+// ISwap iSWAP gate
+func (a *MachineVector128) ISwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ISwapDense128(), q0, q1)
+	return a
+}
+
+// SqrtSwap square root of swap gate
+func (a *MachineVector128) SqrtSwap(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(SqrtSwapDense128(), q0, q1)
+	return a
+}
+
+// RXX XX rotation gate
+func (a *MachineVector128) RXX(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RXXDense128(theta), q0, q1)
+	return a
+}
+
+// RYY YY rotation gate
+func (a *MachineVector128) RYY(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RYYDense128(theta), q0, q1)
+	return a
+}
+
+// RZZ ZZ rotation gate
+func (a *MachineVector128) RZZ(theta float64, q0, q1 Qubit) Machine {
+	a.ApplyUnitary(RZZDense128(theta), q0, q1)
+	return a
+}
+
+// ECR echoed cross resonance gate
+func (a *MachineVector128) ECR(q0, q1 Qubit) Machine {
+	a.ApplyUnitary(ECRDense128(), q0, q1)
+	return a
+}